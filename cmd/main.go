@@ -1,31 +1,82 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
+	"dag-project/config"
 	"dag-project/dag"
 	"dag-project/db"
 	"dag-project/handlers"
 	"dag-project/logger"
 	"dag-project/repository"
 	"dag-project/routers"
+	"dag-project/webhook"
 )
 
+// defaultConfigPath is used when neither -config nor DAG_CONFIG is set
+const defaultConfigPath = "config/config.yaml"
+
+// resolveConfigPath picks the config file from the flag, then the DAG_CONFIG env var, then the default
+func resolveConfigPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv("DAG_CONFIG"); env != "" {
+		return env
+	}
+	return defaultConfigPath
+}
+
+// endpointEnabled consults the endpoints config section. A group can be switched off
+// as a whole ("admin: false") or per endpoint ("admin: {flush: false}"); anything
+// not mentioned stays enabled.
+func endpointEnabled(name string) bool {
+	group := strings.SplitN(name, ".", 2)[0]
+	if enabled, ok := viper.Get("endpoints." + group).(bool); ok {
+		return enabled
+	}
+	if viper.IsSet("endpoints." + name) {
+		return viper.GetBool("endpoints." + name)
+	}
+	return true
+}
+
 func main() {
+	configFlag := flag.String("config", "", "path to the config file (overrides DAG_CONFIG)")
+	flag.Parse()
+
 	// Load config
-	viper.SetConfigFile("config/config.yaml")
+	configPath := resolveConfigPath(*configFlag)
+	if _, err := os.Stat(configPath); err != nil {
+		fmt.Println("Config file not found:", configPath, err)
+		os.Exit(1)
+	}
+	viper.SetConfigFile(configPath)
+	viper.SetDefault("leveldb.create_parent", true)
+	viper.SetDefault("http.compression.level", 5)
+	viper.SetDefault("http.compression.min_bytes", 1024)
+	viper.SetDefault("api.default_page_size", 100)
+	viper.SetDefault("api.max_page_size", 1000)
+	viper.SetDefault("dag.min_parents", 1)
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Println("Config file error:", err)
 		os.Exit(1)
 	}
+	if err := config.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	appLogFile := viper.GetString("log.app_log_file")
 	logLevel := viper.GetString("log.level")
@@ -39,24 +90,135 @@ func main() {
 
 	// Connect to LevelDB
 	leveldbPath := viper.GetString("leveldb.path")
-	ldb, err := db.NewLevelDB(leveldbPath)
+	ldb, err := db.NewLevelDBWithOptions(leveldbPath, db.Options{
+		CreateParent: viper.GetBool("leveldb.create_parent"),
+	})
 	if err != nil {
 		logger.Logger.Fatal("Failed to open leveldb", zap.Error(err))
 	}
 	defer ldb.Close()
 
+	// Optional background compaction, stopped before the database is closed
+	var compactor *db.CompactionScheduler
+	if viper.GetBool("leveldb.compaction.enabled") {
+		compactor = ldb.StartCompactionScheduler(db.CompactionSchedule{
+			Interval: viper.GetDuration("leveldb.compaction.interval"),
+			Writes:   viper.GetInt64("leveldb.compaction.after_writes"),
+		})
+		if compactor == nil {
+			logger.Logger.Warn("Compaction enabled without an interval or after_writes trigger")
+		} else {
+			logger.Logger.Info("Background compaction enabled",
+				zap.Duration("interval", viper.GetDuration("leveldb.compaction.interval")),
+				zap.Int64("after_writes", viper.GetInt64("leveldb.compaction.after_writes")))
+		}
+	}
+
 	// Initialize repository
-	nodeRepo := repository.NewNodeRepository(ldb)
+	keyScheme, err := repository.ParseKeyScheme(viper.GetString("leveldb.key_scheme"))
+	if err != nil {
+		logger.Logger.Fatal("Invalid leveldb.key_scheme", zap.Error(err))
+	}
+	nodeRepo := repository.NewNodeRepositoryWithOptions(ldb, repository.Options{KeyScheme: keyScheme})
+	if moved, err := nodeRepo.MigrateLegacyKeys(); err != nil {
+		logger.Logger.Fatal("Failed to migrate legacy node keys", zap.Error(err))
+	} else if moved > 0 {
+		logger.Logger.Info("Migrated legacy node keys", zap.Int("nodes", moved))
+	}
 
 	// Initialize DAG service with repository
-	d := dag.NewDAG(nodeRepo)
+	dagCfg := dag.DefaultConfig()
+	if dagCfg.ListOrder, err = repository.ParseNodeOrder(viper.GetString("dag.list_order")); err != nil {
+		logger.Logger.Fatal("Invalid dag.list_order", zap.Error(err))
+	}
+	if dagCfg.Hasher, err = dag.NewHasher(viper.GetString("checkpoint.hash_algo")); err != nil {
+		logger.Logger.Fatal("Invalid checkpoint.hash_algo", zap.Error(err))
+	}
+	if dagCfg.TipFallback, err = dag.ParseTipFallback(viper.GetString("dag.tip_fallback")); err != nil {
+		logger.Logger.Fatal("Invalid dag.tip_fallback", zap.Error(err))
+	}
+	if dagCfg.CumulativeMode, err = dag.ParseCumulativeMode(viper.GetString("dag.cumulative_mode")); err != nil {
+		logger.Logger.Fatal("Invalid dag.cumulative_mode", zap.Error(err))
+	}
+	dagCfg.MaxDepth = viper.GetInt("dag.max_depth")
+	dagCfg.MaxIDLength = viper.GetInt("dag.max_id_length")
+	dagCfg.MinParents = viper.GetInt("dag.min_parents")
+	dagCfg.MaxParents = viper.GetInt("dag.max_parents")
+	dagCfg.TipSampleSize = viper.GetInt("dag.tip_sample_size")
+	dagCfg.MaxChildrenPerNode = viper.GetInt("dag.max_children_per_node")
+	dagCfg.ApproveTipsOnly = viper.GetBool("dag.approve_tips_only")
+	dagCfg.RequireGenesisReachable = viper.GetBool("dag.require_genesis_reachable")
+	dagCfg.ParkOrphans = viper.GetBool("dag.park_orphans")
+	dagCfg.MaxParkedOrphans = viper.GetInt("dag.max_parked_orphans")
+	dagCfg.ImmutableWeight = viper.GetInt64("dag.immutable_weight")
+	dagCfg.SelfHealOnRead = viper.GetBool("dag.self_heal_on_read")
+	dagCfg.ClientTimestamps = viper.GetBool("dag.client_timestamps")
+	if viper.IsSet("dag.timestamp_skew") {
+		dagCfg.TimestampSkew = viper.GetDuration("dag.timestamp_skew")
+	}
+	dagCfg.ConfirmationWeight = viper.GetInt64("dag.confirmation_weight")
+	dagCfg.ConfirmationDepth = viper.GetInt("dag.confirmation_depth")
+	dagCfg.AsyncPropagation = viper.GetBool("dag.async_propagation")
+	dagCfg.PropagationWorkers = viper.GetInt("dag.propagation_workers")
+	dagCfg.PropagationQueueSize = viper.GetInt("dag.propagation_queue_size")
+	d := dag.NewDAGWithConfig(nodeRepo, dagCfg)
+	if err := d.RestoreFromCheckpoint(); errors.Is(err, dag.ErrCheckpointMismatch) {
+		// the details have already been logged as a warning
+		if viper.GetBool("checkpoint.refuse_mismatch") {
+			logger.Logger.Fatal("Refusing to start on nodes that diverge from the latest checkpoint", zap.Error(err))
+		}
+	} else if err != nil {
+		logger.Logger.Warn("Failed to verify the latest checkpoint", zap.Error(err))
+	}
+
+	// Optional webhook delivery of committed changes
+	var hooks *webhook.Dispatcher
+	if urls := viper.GetStringSlice("webhooks.urls"); len(urls) > 0 {
+		hooks = webhook.NewDispatcher(webhook.Config{
+			URLs:       urls,
+			Events:     viper.GetStringSlice("webhooks.events"),
+			Secret:     viper.GetString("webhooks.secret"),
+			QueueSize:  viper.GetInt("webhooks.queue_size"),
+			MaxRetries: viper.GetInt("webhooks.max_retries"),
+			Timeout:    viper.GetDuration("webhooks.timeout"),
+		})
+		d.SetEventSink(hooks)
+		logger.Logger.Info("Webhook delivery enabled", zap.Strings("urls", urls))
+	}
+
+	if lifetime, err := d.GetLifetimeStats(); err != nil {
+		logger.Logger.Warn("Failed to read lifetime counters", zap.Error(err))
+	} else {
+		logger.Logger.Info("Loaded lifetime counters",
+			zap.Uint64("additions", lifetime.Additions), zap.Uint64("approvals", lifetime.Approvals))
+	}
 
 	// Initialize HTTP handlers
 	h := handlers.NewHandler(d)
+	h.SetReadOnly(viper.GetBool("server.read_only"))
+	h.SetWeightsAsStrings(viper.GetBool("api.weights_as_strings"))
+	h.SetConcurrencyLimits(viper.GetInt("server.max_inflight_reads"), viper.GetInt("server.max_inflight_writes"))
+	h.SetPageSizes(viper.GetInt("api.default_page_size"), viper.GetInt("api.max_page_size"))
+	h.SetParentLimits(viper.GetInt("dag.min_parents"), dag.EffectiveMaxParents(viper.GetInt("dag.max_parents")))
+	emptyGraph, err := handlers.ParseEmptyGraphMode(viper.GetString("api.empty_graph_status"))
+	if err != nil {
+		logger.Logger.Fatal("Invalid api.empty_graph_status", zap.Error(err))
+	}
+	h.SetEmptyGraphMode(emptyGraph)
+	h.SetAdminToken(viper.GetString("admin.token"))
+	if viper.GetBool("debug.enabled") {
+		h.EnableDebug(ldb, viper.GetString("debug.token"))
+	}
 
 	// Setup router
 	r := mux.NewRouter()
-	routers.RegisterRoutes(r, h)
+	r.Use(h.LimitConcurrency)
+	if viper.GetBool("http.compression.enabled") {
+		r.Use(handlers.Compression(viper.GetInt("http.compression.level"), viper.GetInt("http.compression.min_bytes")))
+	}
+	if disabled := routers.RegisterRoutesFiltered(r, h, endpointEnabled); len(disabled) > 0 {
+		logger.Logger.Info("Endpoints disabled by config", zap.Strings("endpoints", disabled))
+	}
 
 	// HTTP Server
 	srv := &http.Server{
@@ -80,4 +242,14 @@ func main() {
 	<-sigCh
 	logger.Logger.Info("Shutdown signal received, exiting...")
 	srv.Close()
+
+	// Apply queued weight propagations before the database is closed
+	d.Close()
+	if hooks != nil {
+		hooks.Close()
+	}
+	// Let a running compaction finish; the deferred close happens after this
+	if compactor != nil {
+		compactor.Stop()
+	}
 }
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+
+	"dag-project/dag"
+	"dag-project/handlers"
+	"dag-project/models"
+	"dag-project/repository"
+)
+
+// Validate checks the loaded configuration up front and reports every problem in a
+// single error, so a bad config fails at startup instead of at first use
+func Validate() error {
+	var problems []string
+	addf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, key := range []string{"server.port", "leveldb.path", "log.app_log_file", "log.level"} {
+		if !viper.IsSet(key) {
+			addf("%s is required", key)
+		}
+	}
+
+	if port := viper.GetInt("server.port"); viper.IsSet("server.port") && (port < 1 || port > 65535) {
+		addf("server.port must be between 1 and 65535, got %d", port)
+	}
+	if viper.IsSet("leveldb.path") && strings.TrimSpace(viper.GetString("leveldb.path")) == "" {
+		addf("leveldb.path must not be empty")
+	}
+	if viper.IsSet("log.app_log_file") && strings.TrimSpace(viper.GetString("log.app_log_file")) == "" {
+		addf("log.app_log_file must not be empty")
+	}
+	if level := viper.GetString("log.level"); viper.IsSet("log.level") {
+		var parsed zapcore.Level
+		if err := parsed.UnmarshalText([]byte(level)); err != nil || level == "" {
+			addf("log.level %q is not a valid level (debug, info, warn, error)", level)
+		}
+	}
+
+	if _, err := repository.ParseNodeOrder(viper.GetString("dag.list_order")); err != nil {
+		addf("dag.list_order: %v", err)
+	}
+	if _, err := repository.ParseKeyScheme(viper.GetString("leveldb.key_scheme")); err != nil {
+		addf("leveldb.key_scheme: %v", err)
+	}
+	if _, err := dag.ParseTipFallback(viper.GetString("dag.tip_fallback")); err != nil {
+		addf("dag.tip_fallback: %v", err)
+	}
+	if _, err := dag.ParseCumulativeMode(viper.GetString("dag.cumulative_mode")); err != nil {
+		addf("dag.cumulative_mode: %v", err)
+	}
+	if _, err := handlers.ParseEmptyGraphMode(viper.GetString("api.empty_graph_status")); err != nil {
+		addf("api.empty_graph_status: %v", err)
+	}
+	if _, err := dag.NewHasher(viper.GetString("checkpoint.hash_algo")); err != nil {
+		addf("checkpoint.hash_algo: %v", err)
+	}
+	for _, key := range []string{
+		"dag.confirmation_weight",
+		"dag.confirmation_depth",
+		"dag.max_depth",
+		"dag.max_id_length",
+		"dag.max_children_per_node",
+		"dag.max_parents",
+		"dag.max_parked_orphans",
+		"dag.tip_sample_size",
+		"dag.immutable_weight",
+		"server.max_inflight_reads",
+		"server.max_inflight_writes",
+		"dag.propagation_workers",
+		"dag.propagation_queue_size",
+		"leveldb.compaction.after_writes",
+	} {
+		if viper.GetInt64(key) < 0 {
+			addf("%s must not be negative", key)
+		}
+	}
+
+	if viper.GetBool("http.compression.enabled") {
+		if level := viper.GetInt("http.compression.level"); level < 1 || level > 9 {
+			addf("http.compression.level must be between 1 and 9, got %d", level)
+		}
+		if viper.GetInt("http.compression.min_bytes") < 0 {
+			addf("http.compression.min_bytes must not be negative")
+		}
+	}
+	for _, event := range viper.GetStringSlice("webhooks.events") {
+		switch event {
+		case models.EventNodeAdded, models.EventNodeApproved, models.EventCheckpointCreated:
+		default:
+			addf("webhooks.events: unknown event %q", event)
+		}
+	}
+	for _, key := range []string{"api.default_page_size", "api.max_page_size"} {
+		if viper.IsSet(key) && viper.GetInt(key) <= 0 {
+			addf("%s must be positive", key)
+		}
+	}
+	if size, maxSize := viper.GetInt("api.default_page_size"), viper.GetInt("api.max_page_size"); size > 0 && maxSize > 0 && size > maxSize {
+		addf("api.default_page_size (%d) must not exceed api.max_page_size (%d)", size, maxSize)
+	}
+	if viper.IsSet("dag.min_parents") && viper.GetInt("dag.min_parents") < 1 {
+		addf("dag.min_parents must be at least 1")
+	}
+	if minParents, maxParents := viper.GetInt("dag.min_parents"), dag.EffectiveMaxParents(viper.GetInt("dag.max_parents")); minParents > maxParents {
+		addf("dag.min_parents (%d) must not exceed dag.max_parents (%d)", minParents, maxParents)
+	}
+	if viper.GetBool("debug.enabled") && strings.TrimSpace(viper.GetString("debug.token")) == "" {
+		addf("debug.token is required when debug.enabled is true")
+	}
+	if viper.GetDuration("dag.timestamp_skew") < 0 {
+		addf("dag.timestamp_skew must not be negative")
+	}
+	if viper.GetDuration("leveldb.compaction.interval") < 0 {
+		addf("leveldb.compaction.interval must not be negative")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid config:\n  - %s", strings.Join(problems, "\n  - "))
+}
@@ -0,0 +1,115 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"dag-project/config"
+)
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("server.port", 70000)
+	viper.Set("log.app_log_file", "app.log")
+	viper.Set("log.level", "loud")
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected validation to fail")
+	}
+	for _, want := range []string{"leveldb.path is required", "server.port must be between", "log.level"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to mention %q, got: %v", want, err)
+		}
+	}
+
+	viper.Set("server.port", 8080)
+	viper.Set("leveldb.path", "./leveldb_data")
+	viper.Set("log.level", "info")
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected valid config, got: %v", err)
+	}
+}
+
+func TestValidate_PageSizes(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("server.port", 8080)
+	viper.Set("leveldb.path", "./leveldb_data")
+	viper.Set("log.app_log_file", "app.log")
+	viper.Set("log.level", "info")
+
+	viper.Set("api.default_page_size", 0)
+	viper.Set("api.max_page_size", 10)
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "api.default_page_size must be positive") {
+		t.Fatalf("expected non-positive page size to be rejected, got: %v", err)
+	}
+
+	viper.Set("api.default_page_size", 20)
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "must not exceed api.max_page_size") {
+		t.Fatalf("expected default above max to be rejected, got: %v", err)
+	}
+
+	viper.Set("api.default_page_size", 10)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected valid page sizes, got: %v", err)
+	}
+}
+
+func TestValidate_ParentLimits(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("server.port", 8080)
+	viper.Set("leveldb.path", "./leveldb_data")
+	viper.Set("log.app_log_file", "app.log")
+	viper.Set("log.level", "info")
+
+	viper.Set("dag.min_parents", 0)
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "dag.min_parents must be at least 1") {
+		t.Fatalf("expected min_parents 0 to be rejected, got: %v", err)
+	}
+
+	viper.Set("dag.min_parents", 3)
+	viper.Set("dag.max_parents", 2)
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "must not exceed dag.max_parents") {
+		t.Fatalf("expected min above max to be rejected, got: %v", err)
+	}
+
+	viper.Set("dag.min_parents", 2)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected valid parent limits, got: %v", err)
+	}
+
+	// max_parents 0 means the DAG's default of 8, not unbounded
+	viper.Set("dag.max_parents", 0)
+	viper.Set("dag.min_parents", 9)
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "dag.min_parents (9) must not exceed dag.max_parents (8)") {
+		t.Fatalf("expected min above the default max to be rejected, got: %v", err)
+	}
+	viper.Set("dag.min_parents", 8)
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected min equal to the default max to pass, got: %v", err)
+	}
+}
+
+func TestValidate_DebugRequiresToken(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("server.port", 8080)
+	viper.Set("leveldb.path", "./leveldb_data")
+	viper.Set("log.app_log_file", "app.log")
+	viper.Set("log.level", "info")
+
+	viper.Set("debug.enabled", true)
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "debug.token is required when debug.enabled is true") {
+		t.Fatalf("expected debugging without a token to be rejected, got: %v", err)
+	}
+
+	viper.Set("debug.token", "secret")
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected debugging with a token to pass, got: %v", err)
+	}
+}
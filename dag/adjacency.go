@@ -0,0 +1,134 @@
+package dag
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"dag-project/models"
+)
+
+// adjacency caches the parent -> children and child -> parents edges of every
+// stored node, so approvals and validation don't rebuild them from a full scan.
+// It is loaded from the repository on first use and then maintained in place by
+// every operation that writes edges. Writers hold DAG.mux and take mux for
+// writing; code holding DAG.mux may read the maps directly, code holding it only
+// for reading goes through indexRLocked, anything else reads through snapshot. Slices are never modified in place, so snapshots stay valid.
+type adjacency struct {
+	mux      sync.RWMutex
+	loaded   bool
+	children map[string][]string
+	parents  map[string][]string
+}
+
+// rebuildIndex loads the adjacency index from the repository, replacing whatever
+// it held; the caller must hold d.mux, at least for reading
+func (d *DAG) rebuildIndex() error {
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return err
+	}
+
+	d.index.mux.Lock()
+	defer d.index.mux.Unlock()
+	d.index.children = childrenOf(nodes)
+	d.index.parents = parentsOf(nodes)
+	d.index.loaded = true
+	return nil
+}
+
+// indexLocked returns the adjacency index, loading it first if needed; the caller
+// must hold d.mux
+func (d *DAG) indexLocked() (*adjacency, error) {
+	if !d.index.loaded {
+		if err := d.rebuildIndex(); err != nil {
+			return nil, err
+		}
+	}
+	return &d.index, nil
+}
+
+// indexRLocked returns the edge maps for a caller holding d.mux only for reading,
+// loading the index first if needed. Writers are shut out by d.mux and a concurrent
+// load swaps in new maps rather than touching these, so they stay valid until the
+// caller releases d.mux.
+func (d *DAG) indexRLocked() (children, parents map[string][]string, err error) {
+	d.index.mux.RLock()
+	loaded := d.index.loaded
+	d.index.mux.RUnlock()
+	if !loaded {
+		if err := d.rebuildIndex(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	d.index.mux.RLock()
+	defer d.index.mux.RUnlock()
+	return d.index.children, d.index.parents, nil
+}
+
+// indexAddLocked records the edges of a stored node. An index that isn't loaded yet
+// is left alone, it picks the node up when it loads. The caller must hold d.mux.
+func (d *DAG) indexAddLocked(node *models.Node) {
+	d.index.mux.Lock()
+	defer d.index.mux.Unlock()
+	if !d.index.loaded {
+		return
+	}
+	for _, pid := range node.Parents {
+		d.index.children[pid] = appendCopy(d.index.children[pid], node.ID)
+	}
+	d.index.parents[node.ID] = slices.Clone(node.Parents)
+}
+
+// indexRemoveLocked forgets the edges node had as a child, e.g. before it is
+// deleted or its parents are replaced; the caller must hold d.mux
+func (d *DAG) indexRemoveLocked(node *models.Node) {
+	d.index.mux.Lock()
+	defer d.index.mux.Unlock()
+	if !d.index.loaded {
+		return
+	}
+	for _, pid := range node.Parents {
+		kept := slices.DeleteFunc(slices.Clone(d.index.children[pid]), func(id string) bool { return id == node.ID })
+		if len(kept) == 0 {
+			delete(d.index.children, pid)
+		} else {
+			d.index.children[pid] = kept
+		}
+	}
+	delete(d.index.parents, node.ID)
+}
+
+// snapshot returns copies of the edge maps for readers that don't hold d.mux, and
+// false when the index isn't loaded yet
+func (a *adjacency) snapshot() (children, parents map[string][]string, ok bool) {
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	if !a.loaded {
+		return nil, nil, false
+	}
+	return maps.Clone(a.children), maps.Clone(a.parents), true
+}
+
+// loadNodes reads the stored nodes among ids into nodesByID, allocating it when nil,
+// and skips IDs that aren't stored
+func (d *DAG) loadNodes(ids []string, nodesByID map[string]*models.Node) map[string]*models.Node {
+	if nodesByID == nil {
+		nodesByID = make(map[string]*models.Node, len(ids))
+	}
+	for _, id := range ids {
+		if node, err := d.repo.GetNode(id); err == nil {
+			nodesByID[id] = node
+		}
+	}
+	return nodesByID
+}
+
+// appendCopy appends id to a copy of ids, leaving the original backing array to
+// any snapshot that still references it
+func appendCopy(ids []string, id string) []string {
+	out := make([]string, len(ids), len(ids)+1)
+	copy(out, ids)
+	return append(out, id)
+}
@@ -0,0 +1,76 @@
+package dag
+
+import (
+	"fmt"
+
+	"dag-project/models"
+)
+
+// Bounds on the operational notes a node may carry
+const (
+	maxAnnotations           = 32
+	maxAnnotationKeyLength   = 64
+	maxAnnotationValueLength = 1024
+)
+
+// validateAnnotations checks the size limits of a node's annotations
+func validateAnnotations(annotations map[string]string) error {
+	if len(annotations) > maxAnnotations {
+		return fmt.Errorf("%w: at most %d annotations per node", ErrInvalidAnnotations, maxAnnotations)
+	}
+	for key, value := range annotations {
+		if key == "" || len(key) > maxAnnotationKeyLength {
+			return fmt.Errorf("%w: key must be 1 to %d characters", ErrInvalidAnnotations, maxAnnotationKeyLength)
+		}
+		if len(value) > maxAnnotationValueLength {
+			return fmt.Errorf("%w: value of %q exceeds %d characters", ErrInvalidAnnotations, key, maxAnnotationValueLength)
+		}
+	}
+	return nil
+}
+
+// AnnotateNode applies patch to a node's annotations: a key mapped to a value sets
+// it, a key mapped to nil removes it. Annotations are operational notes outside the
+// node's content, so they stay editable on confirmed and archived nodes and are
+// left out of root hashes and checkpoint digests. Weights and edges are untouched.
+// The whole patch is rejected if the result breaks the size limits.
+func (d *DAG) AnnotateNode(id string, patch map[string]*string) (*models.Node, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	exists, err := d.repo.HasNode(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNodeNotFound
+	}
+	node, err := d.repo.GetNode(id)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make(map[string]string, len(node.Annotations)+len(patch))
+	for key, value := range node.Annotations {
+		annotations[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(annotations, key)
+		} else {
+			annotations[key] = *value
+		}
+	}
+	if err := validateAnnotations(annotations); err != nil {
+		return nil, err
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+
+	node.Annotations = annotations
+	if err := d.repo.PutNode(node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
@@ -0,0 +1,58 @@
+package dag
+
+import (
+	"dag-project/models"
+)
+
+// ArchiveNode soft-deletes a node by setting its Deleted flag. The node stays stored
+// and its children keep referencing it, but it is no longer a tip, is skipped by the
+// highest-weight queries and can't be approved. Its approval no longer counts
+// towards its parents: their direct weights and every ancestor's cumulative weight
+// are recomputed without it, and a parent left without live children becomes a tip
+// again. Archiving an archived node changes nothing; a node past cfg.ImmutableWeight
+// can't be archived and fails with ErrNodeImmutable.
+func (d *DAG) ArchiveNode(id string) (*models.Node, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	exists, err := d.repo.HasNode(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNodeNotFound
+	}
+	node, err := d.repo.GetNode(id)
+	if err != nil {
+		return nil, err
+	}
+	if node.Deleted {
+		return node, nil
+	}
+	if err := d.checkMutable(node); err != nil {
+		return nil, err
+	}
+
+	node.Deleted = true
+	d.invalidateCountersLocked()
+	if err := d.repo.PutNode(node); err != nil {
+		return nil, err
+	}
+	if err := d.propagateWeights(node.Parents); err != nil {
+		return nil, err
+	}
+	return d.repo.GetNode(id)
+}
+
+// directWeight counts the children in childIDs that still approve their parent,
+// skipping archived ones
+func directWeight(childIDs []string, nodesByID map[string]*models.Node) int {
+	weight := 0
+	for _, id := range childIDs {
+		if child, ok := nodesByID[id]; ok && child.Deleted {
+			continue
+		}
+		weight++
+	}
+	return weight
+}
@@ -0,0 +1,102 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"dag-project/models"
+)
+
+// nodeDigestLength is how many hex characters of a node digest a checkpoint keeps.
+// Digests only detect change between checkpoints, so 64 bits is plenty and keeps
+// the per-checkpoint record small on large graphs.
+const nodeDigestLength = 16
+
+// nodeDigest hashes the parts of a node a checkpoint diff reports as changes: its
+// parents, archive flag, attribution and payload. Weights are left out because
+// every approval below a node changes them.
+func nodeDigest(n *models.Node, hasher Hasher) string {
+	content, _ := json.Marshal(struct {
+		ID        string          `json:"id"`
+		Parents   []string        `json:"parents"`
+		Deleted   bool            `json:"deleted"`
+		CreatedBy string          `json:"created_by"`
+		Data      json.RawMessage `json:"data,omitempty"`
+	}{n.ID, n.Parents, n.Deleted, n.CreatedBy, n.Data})
+	return fmt.Sprintf("%x", hasher.Sum(content))[:nodeDigestLength]
+}
+
+// nodeDigests maps every node ID to its digest for storing with a checkpoint
+func nodeDigests(nodes []*models.Node, hasher Hasher) map[string]string {
+	digests := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		digests[n.ID] = nodeDigest(n, hasher)
+	}
+	return digests
+}
+
+// CheckpointDiff compares two checkpoints. The node-count delta is always reported;
+// the added, removed and changed node IDs (each sorted) only when both checkpoints
+// carry per-node digests computed with the same hash algorithm, which checkpoints
+// created before digests existed don't. Either checkpoint missing fails with
+// ErrCheckpointNotFound.
+func (d *DAG) CheckpointDiff(fromID, toID string) (*models.CheckpointDiff, error) {
+	from, fromNodes, err := d.checkpointWithNodes(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, toNodes, err := d.checkpointWithNodes(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &models.CheckpointDiff{
+		From:           from.ID,
+		To:             to.ID,
+		NodeCountDelta: to.NodeCount - from.NodeCount,
+	}
+	if fromNodes == nil || toNodes == nil || from.HashAlgo != to.HashAlgo {
+		return diff, nil
+	}
+
+	diff.Detailed = true
+	for id, digest := range toNodes {
+		old, ok := fromNodes[id]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, id)
+		case old != digest:
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+	for id := range fromNodes {
+		if _, ok := toNodes[id]; !ok {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff, nil
+}
+
+// checkpointWithNodes loads a checkpoint and its per-node digests, nil if it has none
+func (d *DAG) checkpointWithNodes(id string) (*models.Checkpoint, map[string]string, error) {
+	exists, err := d.repo.HasCheckpoint(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, id)
+	}
+	cp, err := d.repo.GetCheckpoint(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	digests, err := d.repo.GetCheckpointNodes(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cp, digests, nil
+}
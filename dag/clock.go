@@ -0,0 +1,51 @@
+package dag
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of wall-clock time for stored timestamps. Tests can swap in
+// a ManualClock to make time-dependent behaviour deterministic. Measurements of
+// real elapsed time, such as tip-selection budgets and latency, keep using the
+// monotonic system clock: a frozen clock would never end a budgeted walk.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the host clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// ManualClock is a Clock that only moves when told to. It is safe for concurrent use.
+type ManualClock struct {
+	mux sync.Mutex
+	now time.Time
+}
+
+// NewManualClock returns a ManualClock reading now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the clock's current time
+func (c *ManualClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now
+func (c *ManualClock) Set(now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = c.now.Add(d)
+}
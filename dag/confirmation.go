@@ -0,0 +1,98 @@
+package dag
+
+import (
+	"errors"
+	"time"
+
+	"dag-project/models"
+)
+
+// ErrNoThreshold is returned by ConfirmationReport when neither a threshold nor
+// Config.ConfirmationWeight is set
+var ErrNoThreshold = errors.New("no confirmation threshold: pass one or set dag.confirmation_weight")
+
+// tipAgeBuckets are the upper bounds of the unconfirmed tip age histogram; older
+// tips fall into the final "older" bucket
+var tipAgeBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"1m", time.Minute},
+	{"10m", 10 * time.Minute},
+	{"1h", time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// ConfirmationReport measures how well the DAG confirms nodes: the share of live
+// nodes whose cumulative weight reaches threshold, the average cumulative weight,
+// and how long the unconfirmed tips have been waiting. A threshold of 0 uses
+// Config.ConfirmationWeight.
+//
+// The report takes one pass over the stored nodes without building graph maps, so
+// it costs O(nodes) time and constant memory, but it holds the DAG lock for the
+// whole scan. Tips are recognized by a direct weight of 0, which lags behind the
+// graph while async propagations are pending.
+func (d *DAG) ConfirmationReport(threshold int64) (*models.ConfirmationReport, error) {
+	if threshold <= 0 {
+		threshold = d.cfg.ConfirmationWeight
+	}
+	if threshold <= 0 {
+		return nil, ErrNoThreshold
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	report := &models.ConfirmationReport{
+		Threshold: threshold,
+		TipAges:   make(map[string]int, len(tipAgeBuckets)+1),
+	}
+	for _, bucket := range tipAgeBuckets {
+		report.TipAges[bucket.label] = 0
+	}
+	report.TipAges["older"] = 0
+
+	now := d.nowMillis()
+	var totalWeight int64
+	err := d.repo.EachNode(func(n *models.Node) error {
+		if n.Deleted {
+			return nil
+		}
+		report.NodeCount++
+		totalWeight += n.CumulativeWeight
+		if n.CumulativeWeight >= threshold {
+			report.ConfirmedCount++
+			return nil
+		}
+		if n.Weight != 0 {
+			return nil
+		}
+
+		report.UnconfirmedTips++
+		age := now - n.CreatedAt
+		if age < 0 {
+			age = 0
+		}
+		if age > report.OldestUnconfirmedTipAge {
+			report.OldestUnconfirmedTipAge = age
+		}
+		label := "older"
+		for _, bucket := range tipAgeBuckets {
+			if time.Duration(age)*time.Millisecond < bucket.limit {
+				label = bucket.label
+				break
+			}
+		}
+		report.TipAges[label]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if report.NodeCount > 0 {
+		report.ConfirmationRate = float64(report.ConfirmedCount) / float64(report.NodeCount)
+		report.AverageCumulativeWeight = float64(totalWeight) / float64(report.NodeCount)
+	}
+	return report, nil
+}
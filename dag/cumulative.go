@@ -0,0 +1,220 @@
+package dag
+
+import (
+	"math/bits"
+
+	"dag-project/models"
+)
+
+// cumulativePass recomputes the cumulative weights of the nodes affected by one
+// propagation. Children outside the affected set keep their stored cumulative
+// weight in CumulativePerPath mode, since nothing below them changed; there each
+// node's value is derived from its children's values, memoized, so a node is
+// evaluated once no matter how many affected ancestors reach it.
+//
+// CumulativeUnique mode can't add up children's values, a descendant reachable along
+// two paths would count twice. It collects the affected nodes and everything below
+// them and visits them once, children first, building each node's set of distinct
+// descendants as a bitset: the union of its children's sets and the children
+// themselves. An affected node's value is then a sum over its set, taken from its
+// children's sums when their sets are disjoint, as on a chain or tree. A set is
+// dropped as soon as every parent has merged it, so only the frontier's sets are held.
+type cumulativePass struct {
+	d        *DAG
+	children map[string][]string
+	affected map[string]bool
+
+	nodes      map[string]*models.Node // loaded nodes, nil for missing ones
+	cumulative map[string]int64        // cumulative weights evaluated so far
+	visiting   map[string]bool         // guards against cycles in corrupted data
+
+	// changed collects the affected nodes whose cumulative weight moved
+	changed []*models.Node
+}
+
+func (d *DAG) newCumulativePass(children map[string][]string, affected map[string]bool) *cumulativePass {
+	return &cumulativePass{
+		d:          d,
+		children:   children,
+		affected:   affected,
+		nodes:      make(map[string]*models.Node),
+		cumulative: make(map[string]int64),
+		visiting:   make(map[string]bool),
+	}
+}
+
+// run evaluates every affected node
+func (p *cumulativePass) run() {
+	if p.d.cfg.CumulativeMode == CumulativeUnique {
+		p.runUnique()
+		return
+	}
+	for id := range p.affected {
+		p.weightOf(id)
+	}
+}
+
+// node returns the stored node id, reading it at most once per pass
+func (p *cumulativePass) node(id string) *models.Node {
+	if n, ok := p.nodes[id]; ok {
+		return n
+	}
+	n, err := p.d.repo.GetNode(id)
+	if err != nil {
+		n = nil
+	}
+	p.nodes[id] = n
+	return n
+}
+
+// record stores the evaluated cumulative weight w of n
+func (p *cumulativePass) record(n *models.Node, w int64) {
+	p.cumulative[n.ID] = w
+	if n.CumulativeWeight != w {
+		n.CumulativeWeight = w
+		p.changed = append(p.changed, n)
+	}
+}
+
+// weightOf returns the per-path cumulative weight of id, recomputed when id is affected
+func (p *cumulativePass) weightOf(id string) int64 {
+	if w, ok := p.cumulative[id]; ok {
+		return w
+	}
+	n := p.node(id)
+	if n == nil {
+		return 0
+	}
+	if !p.affected[id] || p.visiting[id] {
+		return n.CumulativeWeight
+	}
+
+	p.visiting[id] = true
+	w := int64(n.Weight)
+	for _, childID := range p.children[id] {
+		child := p.node(childID)
+		if child == nil {
+			continue
+		}
+		// a child's value includes its own weight, which an archived child doesn't add
+		w += p.weightOf(childID)
+		if child.Deleted {
+			w -= int64(child.Weight)
+		}
+	}
+	delete(p.visiting, id)
+
+	p.record(n, w)
+	return w
+}
+
+// runUnique evaluates every affected node counting each distinct descendant once.
+// Nodes on a cycle, which only corrupted data can contain, are never reached by the
+// children-first order and keep their stored value.
+func (p *cumulativePass) runUnique() {
+	// number the affected nodes and every stored node below them
+	position := make(map[string]int)
+	var region []*models.Node
+	var stack []string
+	for id := range p.affected {
+		stack = append(stack, id)
+	}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, seen := position[id]; seen {
+			continue
+		}
+		n := p.node(id)
+		if n == nil {
+			continue
+		}
+		position[id] = len(region)
+		region = append(region, n)
+		stack = append(stack, p.children[id]...)
+	}
+
+	// the weight each node adds to its ancestors; an archived node adds none, but its
+	// descendants still count
+	weights := make([]int64, len(region))
+	children := make([][]int, len(region))
+	parents := make([][]int, len(region))
+	for i, n := range region {
+		if !n.Deleted {
+			weights[i] = int64(n.Weight)
+		}
+		for _, childID := range p.children[n.ID] {
+			if c, ok := position[childID]; ok {
+				children[i] = append(children[i], c)
+				parents[c] = append(parents[c], i)
+			}
+		}
+	}
+
+	// Kahn's algorithm upwards from the nodes without children
+	pending := make([]int, len(region))
+	var ready []int
+	for i := range region {
+		if pending[i] = len(children[i]); pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	words := (len(region) + 63) / 64
+	sets := make([][]uint64, len(region))
+	unmerged := make([]int, len(region))
+	for i := range region {
+		unmerged[i] = len(parents[i])
+	}
+	// sizes and sums of the sets, where sums are only known (summed[i]) when needed
+	sizes := make([]int, len(region))
+	sums := make([]int64, len(region))
+	summed := make([]bool, len(region))
+	for len(ready) > 0 {
+		i := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+
+		set := make([]uint64, words)
+		disjointSize, childSums, childSummed := 0, int64(0), true
+		for _, c := range children[i] {
+			for w, word := range sets[c] {
+				set[w] |= word
+			}
+			set[c/64] |= 1 << (c % 64)
+			disjointSize += sizes[c] + 1
+			childSums += sums[c] + weights[c]
+			childSummed = childSummed && summed[c]
+			if unmerged[c]--; unmerged[c] == 0 {
+				sets[c] = nil
+			}
+		}
+		for _, word := range set {
+			sizes[i] += bits.OnesCount64(word)
+		}
+		if unmerged[i] > 0 {
+			sets[i] = set
+		}
+
+		// children whose sets don't overlap share no descendant, so their sums add
+		// up; otherwise an affected node scans its set
+		switch n := region[i]; {
+		case sizes[i] == disjointSize && childSummed:
+			sums[i], summed[i] = childSums, true
+		case p.affected[n.ID]:
+			for base, word := range set {
+				for ; word != 0; word &= word - 1 {
+					sums[i] += weights[base*64+bits.TrailingZeros64(word)]
+				}
+			}
+			summed[i] = true
+		}
+		if n := region[i]; p.affected[n.ID] {
+			p.record(n, int64(n.Weight)+sums[i])
+		}
+
+		for _, q := range parents[i] {
+			if pending[q]--; pending[q] == 0 {
+				ready = append(ready, q)
+			}
+		}
+	}
+}
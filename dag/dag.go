@@ -1,13 +1,14 @@
 package dag
 
 import (
-	"crypto/sha256"
 	"errors"
 	"fmt"
-	"math"
 	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"dag-project/logger"
 	"dag-project/models"
@@ -16,14 +17,259 @@ import (
 	"go.uber.org/zap"
 )
 
+// batchChunkSize bounds how many batch approvals are applied per lock acquisition
+const batchChunkSize = 500
+
+// Config holds the tunable behaviour of a DAG
+type Config struct {
+	// ListOrder is the order used when listing nodes to API clients
+	ListOrder repository.NodeOrder
+	// Hasher computes checkpoint and sync-state root hashes
+	Hasher Hasher
+	// ConfirmationWeight confirms a node once its cumulative weight reaches it (0 disables)
+	ConfirmationWeight int64
+	// ConfirmationDepth confirms a node once it has this many levels of descendants (0 disables)
+	ConfirmationDepth int
+	// AsyncPropagation queues weight propagation to a worker pool instead of
+	// running it inside the approval; weights become eventually consistent
+	AsyncPropagation bool
+	// PropagationWorkers is the async worker pool size (default 1)
+	PropagationWorkers int
+	// ClientTimestamps keeps a non-zero CreatedAt supplied with an approval (for
+	// imports) instead of assigning the server time
+	ClientTimestamps bool
+	// TimestampSkew is how far a client-supplied CreatedAt may precede its newest parent
+	TimestampSkew time.Duration
+	// ImmutableWeight freezes a node's content (parents, archive flag, attribution and
+	// payload) once its cumulative weight reaches it, so UpdateNode and Reparent can
+	// only edit the unconfirmed frontier (0 disables)
+	ImmutableWeight int64
+	// MaxDepth rejects approvals whose depth below genesis would exceed it (0 disables)
+	MaxDepth int
+	// MaxChildrenPerNode rejects approvals that would give a parent more children
+	// than this, spreading approvals across the frontier (0 disables)
+	MaxChildrenPerNode int
+	// ApproveTipsOnly rejects approvals listing a parent that already has children,
+	// so the graph only grows from the frontier
+	ApproveTipsOnly bool
+	// RequireGenesisReachable rejects approvals none of whose parents lead back to a
+	// genesis node, so imports can't extend a detached subgraph
+	RequireGenesisReachable bool
+	// TipFallback decides what tip selection returns when no tips exist
+	TipFallback TipFallback
+	// TipSampleSize runs each MCMC walk over a random subset of at most this many
+	// tips, bounding per-walk cost on huge frontiers (0 uses every tip)
+	TipSampleSize int
+	// CumulativeMode decides how descendants shared by several paths are counted
+	CumulativeMode CumulativeMode
+	// SelfHealOnRead repairs a node's stored weights when a single-node read finds
+	// its direct weight disagreeing with its child count, at the cost of read-path
+	// writes and a graph scan per read
+	SelfHealOnRead bool
+	// PropagationQueueSize bounds queued propagations; a full queue falls back to
+	// propagating synchronously (default 1024)
+	PropagationQueueSize int
+	// ParkOrphans holds approvals whose parents are missing in a pending area and
+	// approves them once the parents arrive, instead of rejecting them
+	ParkOrphans bool
+	// MaxParkedOrphans bounds the pending area (default 1000); beyond it approvals
+	// with missing parents are rejected again
+	MaxParkedOrphans int
+	// Clock supplies the time for stored timestamps (default: the system clock)
+	Clock Clock
+	// MaxIDLength bounds node and checkpoint IDs (default 128)
+	MaxIDLength int
+	// MinParents is how many distinct parents every approval must list (default 1)
+	MinParents int
+	// MaxParents bounds how many parents one approval may list, keeping the cost
+	// of its weight propagation in check (default 8)
+	MaxParents int
+}
+
+var (
+	// ErrNodeNotFound is returned when a referenced node is not stored
+	ErrNodeNotFound = errors.New("node not found")
+	// ErrNodeHasDependents is returned when deleting a node that other nodes approve
+	ErrNodeHasDependents = errors.New("node has dependents and cannot be deleted")
+	// ErrCheckpointNotFound is returned when a referenced checkpoint is not stored
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+	// ErrEmptyGraph is returned by queries that need at least one node
+	ErrEmptyGraph = errors.New("no nodes in DAG")
+	// ErrNodeExists is returned when creating a node whose ID is already stored
+	ErrNodeExists = errors.New("node with ID already exists")
+	// ErrInvalidID is returned when a node or checkpoint ID fails validation
+	ErrInvalidID = errors.New("invalid id")
+	// ErrInvalidAuthor is returned when a node's created_by fails validation
+	ErrInvalidAuthor = errors.New("invalid created_by")
+	// ErrInvalidAnnotations is returned when node annotations exceed their size limits
+	ErrInvalidAnnotations = errors.New("invalid annotations")
+	// ErrCheckpointExists is returned when creating a checkpoint whose ID is already stored
+	ErrCheckpointExists = errors.New("checkpoint with ID already exists")
+	// ErrInvalidParents is returned when a parent list is empty, duplicated, missing or cyclic
+	ErrInvalidParents = errors.New("invalid parents")
+	// ErrMaxDepthExceeded is returned when an approval would make the DAG deeper than allowed
+	ErrMaxDepthExceeded = errors.New("node would exceed the maximum DAG depth")
+	// ErrInvalidTimestamp is returned when a client-supplied CreatedAt predates a parent
+	ErrInvalidTimestamp = errors.New("invalid created_at")
+	// ErrDisconnectedNode is returned when no parent of an approval is reachable from a genesis node
+	ErrDisconnectedNode = errors.New("node would be disconnected from genesis")
+	// ErrNodeImmutable is returned when editing the parents of a confirmed node
+	ErrNodeImmutable = errors.New("node is confirmed and can no longer be modified")
+	// ErrNodeParked is returned when an approval with missing parents was parked
+	ErrNodeParked = errors.New("node parked until its parents arrive")
+	// ErrNoTips is returned by tip selection when every node already has a child
+	ErrNoTips = errors.New("dag has no tips: every node already has a child")
+	// ErrNoQualifyingTips is returned by tip selection when a filter excludes every tip
+	ErrNoQualifyingTips = errors.New("no tip passes the selection filter")
+	// ErrTooFewTips is returned by Submit when fewer than two distinct tips can be selected
+	ErrTooFewTips = errors.New("not enough tips to approve")
+	// ErrNoPath is returned by FindPath when no chain of approvals connects two nodes
+	ErrNoPath = errors.New("no path between nodes")
+	// ErrCheckpointMismatch is returned when the stored nodes no longer hash to the
+	// root recorded by the latest checkpoint
+	ErrCheckpointMismatch = errors.New("stored nodes diverge from the latest checkpoint")
+	// ErrCycleDetected is returned when the stored edges form a cycle, which only
+	// corrupted data can contain
+	ErrCycleDetected = errors.New("cycle detected in DAG")
+)
+
+// defaultMaxIDLength bounds node and checkpoint IDs when Config.MaxIDLength is 0
+const defaultMaxIDLength = 128
+
+// defaultMaxParents bounds the parents of an approval when Config.MaxParents is 0
+const defaultMaxParents = 8
+
+// EffectiveMaxParents returns the parent limit the DAG applies for a configured
+// Config.MaxParents, resolving 0 to the default
+func EffectiveMaxParents(configured int) int {
+	if configured <= 0 {
+		return defaultMaxParents
+	}
+	return configured
+}
+
+// maxAuthorLength bounds the created_by attribution of a node
+const maxAuthorLength = 128
+
+// reservedCheckpointIDs would be shadowed by fixed checkpoint routes
+var reservedCheckpointIDs = map[string]bool{"latest": true, "diff": true}
+
+// DefaultConfig returns the configuration used by NewDAG
+func DefaultConfig() Config {
+	return Config{
+		ListOrder:     repository.OrderCreatedAt,
+		Hasher:        sha256Hasher{},
+		TimestampSkew: time.Second,
+		Clock:         systemClock{},
+	}
+}
+
+// CumulativeMode decides how a descendant reachable along several paths (a diamond
+// below the node) contributes to the node's cumulative weight.
+type CumulativeMode int
+
+const (
+	// CumulativeUnique counts every distinct descendant's weight exactly once, so the
+	// cumulative weight is the node's weight plus the weight of its descendant set
+	CumulativeUnique CumulativeMode = iota
+	// CumulativePerPath counts a descendant's weight once per path leading to it,
+	// the pre-dedup behaviour. It grows with the number of paths, which can be
+	// exponential in the depth of stacked diamonds.
+	CumulativePerPath
+)
+
+// ParseCumulativeMode converts a config value into a CumulativeMode
+func ParseCumulativeMode(s string) (CumulativeMode, error) {
+	switch s {
+	case "", "unique":
+		return CumulativeUnique, nil
+	case "per_path":
+		return CumulativePerPath, nil
+	}
+	return CumulativeUnique, fmt.Errorf("unknown cumulative mode %q", s)
+}
+
 // DAG implements basic DAG operations and tip selection using MCMC (weighted random walk).
 type DAG struct {
 	repo repository.NodeRepositoryInterface
-	mux  sync.Mutex
+	mux  sync.RWMutex
+	cfg  Config
+
+	// tip-selection latency tracking, guarded by statsMux
+	statsMux         sync.Mutex
+	tipLatencyEMA    float64
+	tipSelectionRuns int64
+
+	// async weight propagation, nil in synchronous mode
+	propagation *propagationPool
+
+	// cached counts for Status, guarded by mux
+	counters graphCounters
+
+	// events receives committed changes; nil when nobody subscribes
+	events EventSink
+
+	// parked holds approvals waiting for missing parents, guarded by mux
+	parked map[string]*parkedNode
+
+	// randSource seeds tip-selection randomness when set, guarded by randMux
+	randMux    sync.Mutex
+	randSource rand.Source
+
+	// index caches the graph's edges, see adjacency
+	index adjacency
+}
+
+// EventSink receives events for committed changes. Publish is called with the DAG
+// lock held, so implementations must not block.
+type EventSink interface {
+	Publish(event models.Event)
+}
+
+// SetEventSink subscribes sink to committed changes. Call it before serving requests.
+func (d *DAG) SetEventSink(sink EventSink) {
+	d.events = sink
+}
+
+// publish sends a copy of the changed node or checkpoint to the event sink
+func (d *DAG) publish(eventType string, node *models.Node, cp *models.Checkpoint) {
+	if d.events == nil {
+		return
+	}
+	event := models.Event{Type: eventType, Timestamp: d.nowMillis()}
+	if node != nil {
+		nodeCopy := *node
+		nodeCopy.Parents = append([]string(nil), node.Parents...)
+		event.Node = &nodeCopy
+	}
+	if cp != nil {
+		cpCopy := *cp
+		event.Checkpoint = &cpCopy
+	}
+	d.events.Publish(event)
 }
 
+// NewDAG creates a DAG with the default configuration
 func NewDAG(repo repository.NodeRepositoryInterface) *DAG {
-	return &DAG{repo: repo}
+	return NewDAGWithConfig(repo, DefaultConfig())
+}
+
+// NewDAGWithConfig creates a DAG with the given configuration
+func NewDAGWithConfig(repo repository.NodeRepositoryInterface, cfg Config) *DAG {
+	if cfg.Hasher == nil {
+		cfg.Hasher = sha256Hasher{}
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = systemClock{}
+	}
+	d := &DAG{repo: repo, cfg: cfg}
+	if cfg.AsyncPropagation {
+		d.propagation = newPropagationPool(d, cfg.PropagationWorkers, cfg.PropagationQueueSize)
+	}
+	if err := d.loadParked(); err != nil {
+		logger.Logger.Warn("Failed to reload parked nodes", zap.Error(err))
+	}
+	return d
 }
 
 // AddNode stores a node, with no parents initially
@@ -31,15 +277,31 @@ func (d *DAG) AddNode(node *models.Node) error {
 	d.mux.Lock()
 	defer d.mux.Unlock()
 
+	if err := d.validateID("node", node.ID); err != nil {
+		return err
+	}
+	if err := validateAuthor(node.CreatedBy); err != nil {
+		return err
+	}
+	if err := validateAnnotations(node.Annotations); err != nil {
+		return err
+	}
 	existingNode, err := d.repo.GetNode(node.ID)
 	if err == nil && existingNode != nil {
-		return errors.New("node with ID already exists")
+		return ErrNodeExists
 	}
 
 	node.Weight = 0
 	node.CumulativeWeight = 0
-	node.CreatedAt = nowMillis()
-	return d.repo.PutNode(node)
+	node.CreatedAt = d.nowMillis()
+	if err := d.repo.PutNodeCounted(node, repository.CounterAdditions); err != nil {
+		return err
+	}
+	d.indexAddLocked(node)
+	d.countAddedLocked(0)
+	d.publish(models.EventNodeAdded, node, nil)
+	d.releaseParkedLocked(node.ID)
+	return nil
 }
 
 // ApproveNode adds a new node referencing previous nodes parents
@@ -47,6 +309,33 @@ func (d *DAG) ApproveNode(node *models.Node) error {
 	d.mux.Lock()
 	defer d.mux.Unlock()
 
+	return d.approveNodeLocked(node)
+}
+
+// approveNodeLocked validates and stores an approving node; the caller must hold d.mux
+func (d *DAG) approveNodeLocked(node *models.Node) error {
+	if err := d.validateID("node", node.ID); err != nil {
+		return err
+	}
+	if err := validateAuthor(node.CreatedBy); err != nil {
+		return err
+	}
+	if err := validateAnnotations(node.Annotations); err != nil {
+		return err
+	}
+
+	// a parent listed twice is still one approval of it
+	node.Parents = dedupeParents(node.Parents)
+
+	// the parent limits apply on every approval path: approve, batch, attach, submit
+	// and released parked nodes
+	if minParents := max(d.cfg.MinParents, 1); len(node.Parents) < minParents {
+		return fmt.Errorf("%w: too few parents (min %d)", ErrInvalidParents, minParents)
+	}
+	if maxParents := EffectiveMaxParents(d.cfg.MaxParents); len(node.Parents) > maxParents {
+		return fmt.Errorf("%w: too many parents (max %d)", ErrInvalidParents, maxParents)
+	}
+
 	// Validate that the node doesn't reference itself as a parent
 	for _, pid := range node.Parents {
 		if pid == node.ID {
@@ -54,59 +343,381 @@ func (d *DAG) ApproveNode(node *models.Node) error {
 		}
 	}
 
+	// Approving must never overwrite an existing node; edges change through UpdateNode
+	exists, err := d.repo.HasNode(node.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrNodeExists
+	}
+	if d.cfg.ParkOrphans {
+		if err := d.parkLocked(node); err != nil {
+			return err
+		}
+	}
+
 	// Check for circular references
 	if err := d.checkForCircularReferences(node.ID, node.Parents); err != nil {
 		return err
 	}
 
-	// check all parents exist
+	// check all parents exist, counting the tips this approval covers
+	coveredTips := 0
+	var newestParent int64
 	for _, pid := range node.Parents {
-		_, err := d.repo.GetNode(pid)
+		parent, err := d.repo.GetNode(pid)
 		if err != nil {
 			return errors.New("parent node " + pid + " does not exist")
 		}
+		if parent.Deleted {
+			return fmt.Errorf("%w: parent node %s is archived", ErrInvalidParents, pid)
+		}
+		if parent.Weight == 0 {
+			coveredTips++
+		}
+		if parent.CreatedAt > newestParent {
+			newestParent = parent.CreatedAt
+		}
+	}
+
+	// a client-supplied timestamp must not predate its parents beyond the allowed skew
+	clientTimestamp := d.cfg.ClientTimestamps && node.CreatedAt != 0
+	if clientTimestamp && node.CreatedAt < newestParent-d.cfg.TimestampSkew.Milliseconds() {
+		return fmt.Errorf("%w: %d is before parent created_at %d", ErrInvalidTimestamp, node.CreatedAt, newestParent)
+	}
+
+	if err := d.checkMaxDepth(node.Parents); err != nil {
+		return err
+	}
+	if err := d.checkParentChildren(node.Parents); err != nil {
+		return err
+	}
+	if err := d.checkGenesisReachable(node.Parents); err != nil {
+		return err
 	}
 
 	node.Weight = 0
-	node.CreatedAt = nowMillis()
+	if !clientTimestamp {
+		node.CreatedAt = d.nowMillis()
+	}
 
-	err := d.repo.PutNode(node)
+	err = d.repo.PutNodeCounted(node, repository.CounterApprovals)
 	if err != nil {
 		return err
 	}
+	d.indexAddLocked(node)
+	d.publish(models.EventNodeApproved, node, nil)
 
 	// increase weight of parents and update cumulative weights
-	err = d.propagateWeights(node.Parents)
+	if d.propagation != nil && d.propagation.enqueue(node.Parents) {
+		// queued parents still look like tips, so the covered count can't be trusted
+		d.invalidateCountersLocked()
+	} else {
+		d.countAddedLocked(coveredTips)
+		if err := d.propagateWeights(node.Parents); err != nil {
+			logger.Logger.Warn("Failed to update ancestor weights", zap.Error(err))
+		}
+	}
+
+	d.releaseParkedLocked(node.ID)
+	return nil
+}
+
+// checkMaxDepth rejects a node with parentIDs when its depth, 1 + the deepest
+// parent's depth, would exceed cfg.MaxDepth
+func (d *DAG) checkMaxDepth(parentIDs []string) error {
+	if d.cfg.MaxDepth <= 0 || len(parentIDs) == 0 {
+		return nil
+	}
+	index, err := d.indexLocked()
 	if err != nil {
-		logger.Logger.Warn("Failed to update ancestor weights", zap.Error(err))
+		return err
+	}
+	parents := index.parents
+	memo := make(map[string]int)
+	depth := 0
+	for _, pid := range parentIDs {
+		if parentDepth := ancestorDepth(pid, parents, memo) + 1; parentDepth > depth {
+			depth = parentDepth
+		}
 	}
+	if depth > d.cfg.MaxDepth {
+		return fmt.Errorf("%w: depth %d, limit %d", ErrMaxDepthExceeded, depth, d.cfg.MaxDepth)
+	}
+	return nil
+}
 
+// checkParentChildren applies the policies on how many children a parent may
+// already have: ApproveTipsOnly rejects any parent that isn't a tip, and
+// MaxChildrenPerNode rejects an approval that would push a parent past the limit.
+// A parent's direct weight is its child count once propagation has run; with async
+// propagation it may lag, so the children are counted from the graph instead.
+func (d *DAG) checkParentChildren(parentIDs []string) error {
+	if d.cfg.MaxChildrenPerNode <= 0 && !d.cfg.ApproveTipsOnly {
+		return nil
+	}
+	var children map[string][]string
+	var nodesByID map[string]*models.Node
+	if d.propagation != nil {
+		index, err := d.indexLocked()
+		if err != nil {
+			return err
+		}
+		children = index.children
+		nodesByID = make(map[string]*models.Node)
+		for _, pid := range parentIDs {
+			d.loadNodes(children[pid], nodesByID)
+		}
+	}
+	for _, pid := range parentIDs {
+		count := directWeight(children[pid], nodesByID)
+		if children == nil {
+			parent, err := d.repo.GetNode(pid)
+			if err != nil {
+				return err
+			}
+			count = parent.Weight
+		}
+		if d.cfg.ApproveTipsOnly && count > 0 {
+			return fmt.Errorf("%w: parent %s is not a tip, it already has %d children", ErrInvalidParents, pid, count)
+		}
+		if d.cfg.MaxChildrenPerNode > 0 && count >= d.cfg.MaxChildrenPerNode {
+			return fmt.Errorf("%w: parent %s already has %d children, limit %d",
+				ErrInvalidParents, pid, count, d.cfg.MaxChildrenPerNode)
+		}
+	}
 	return nil
 }
 
-// updateParentNodeWeights recursively updates weights and cumulative weights of all parent nodes
-func (d *DAG) propagateWeights(parentIDs []string) error {
-	if len(parentIDs) == 0 {
+// checkGenesisReachable rejects parentIDs when cfg.RequireGenesisReachable is set and
+// none of them leads back to a genesis node, a stored node without parents. Ancestors
+// missing from the graph are dead ends. The walk up the parent links stops at the
+// first genesis node found.
+func (d *DAG) checkGenesisReachable(parentIDs []string) error {
+	if !d.cfg.RequireGenesisReachable || len(parentIDs) == 0 {
 		return nil
 	}
+	index, err := d.indexLocked()
+	if err != nil {
+		return err
+	}
+
+	visited := make(map[string]bool, len(parentIDs))
+	queue := make([]string, 0, len(parentIDs))
+	for _, pid := range parentIDs {
+		if !visited[pid] {
+			visited[pid] = true
+			queue = append(queue, pid)
+		}
+	}
+	for len(queue) > 0 {
+		parents, stored := index.parents[queue[0]]
+		queue = queue[1:]
+		if !stored {
+			continue
+		}
+		if len(parents) == 0 {
+			return nil
+		}
+		for _, pid := range parents {
+			if !visited[pid] {
+				visited[pid] = true
+				queue = append(queue, pid)
+			}
+		}
+	}
+	return fmt.Errorf("%w: no parent of %v leads back to a genesis node", ErrDisconnectedNode, parentIDs)
+}
+
+// Attach selects parents for node via MCMC tip selection and approves it in a single
+// locked operation, so no other writer can change the frontier in between. Up to
+// parentCount distinct tips are used; fewer are used when the frontier is smaller.
+func (d *DAG) Attach(node *models.Node, parentCount int, params TipSelectionParams) error {
+	if parentCount <= 0 {
+		return errors.New("parent count must be positive")
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
 
-	// Get all nodes to build the graph structure
-	allNodes, err := d.repo.GetAllNodes()
+	tips, err := d.selectDistinctTips(params, parentCount)
 	if err != nil {
 		return err
 	}
 
-	// Build parent-child relationships
-	children := make(map[string][]string)
-	parents := make(map[string][]string)
-	for _, n := range allNodes {
-		for _, p := range n.Parents {
-			children[p] = append(children[p], n.ID)
-			parents[n.ID] = append(parents[n.ID], p)
+	node.Parents = make([]string, 0, len(tips))
+	for _, tip := range tips {
+		node.Parents = append(node.Parents, tip.ID)
+	}
+	return d.approveNodeLocked(node)
+}
+
+// submitParents is the fixed number of tips a submitted node approves
+const submitParents = 2
+
+// Submit is the IOTA-style attach: it selects exactly two distinct tips via MCMC,
+// sets them as the node's parents and approves it under one lock. Unlike Attach it
+// never settles for fewer parents and fails with ErrTooFewTips instead.
+func (d *DAG) Submit(node *models.Node, params TipSelectionParams) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	tips, err := d.selectDistinctTips(params, submitParents)
+	if err != nil {
+		return err
+	}
+	if len(tips) < submitParents {
+		return fmt.Errorf("%w: need %d distinct tips, found %d", ErrTooFewTips, submitParents, len(tips))
+	}
+
+	node.Parents = []string{tips[0].ID, tips[1].ID}
+	return d.approveNodeLocked(node)
+}
+
+// ApproveBatch approves nodes, reporting each outcome through emit. Nodes may
+// reference each other in any order: a node is approved after the batch nodes it
+// references, otherwise input order is kept. The DAG lock is taken per chunk of
+// batchChunkSize nodes so that large imports don't starve other writers. A non-nil
+// error from emit aborts the remaining batch.
+func (d *DAG) ApproveBatch(nodes []*models.Node, emit func(models.BatchResult) error) error {
+	steps, err := d.planBatch(nodes)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(steps); start += batchChunkSize {
+		end := start + batchChunkSize
+		if end > len(steps) {
+			end = len(steps)
+		}
+		if err := d.approveChunk(steps[start:end], emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchStep is one node of a planned batch; a non-nil err rejects it without
+// attempting the approval. index is the node's position in the submitted batch.
+type batchStep struct {
+	index int
+	node  *models.Node
+	err   error
+}
+
+// planBatch orders a batch so every node follows the batch nodes it references,
+// keeping input order otherwise. The batch IDs form a known set: a parent counts as
+// existing when it is stored or in the set, so interrelated nodes can arrive
+// together. Nodes whose parents are neither, that close a cycle through batch edges,
+// or that reference a rejected batch node are rejected up front. Stored nodes never
+// reference batch nodes, so a cycle over the combined graph must run through the
+// batch edges alone.
+func (d *DAG) planBatch(nodes []*models.Node) ([]batchStep, error) {
+	known := make(map[string]int, len(nodes))
+	for i, n := range nodes {
+		if _, dup := known[n.ID]; !dup {
+			known[n.ID] = i
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		planned
+	)
+	state := make([]int, len(nodes))
+	rejected := make([]bool, len(nodes))
+	steps := make([]batchStep, 0, len(nodes))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		state[i] = visiting
+		node := nodes[i]
+		var reject error
+		for _, pid := range node.Parents {
+			j, inBatch := known[pid]
+			if !inBatch || j == i {
+				stored, err := d.repo.HasNode(pid)
+				if err != nil {
+					return err
+				}
+				if !stored && reject == nil && pid != node.ID {
+					reject = fmt.Errorf("%w: parent node %s does not exist", ErrInvalidParents, pid)
+				}
+				continue
+			}
+			switch state[j] {
+			case visiting:
+				if reject == nil {
+					reject = fmt.Errorf("%w: cycle through batch node %s", ErrInvalidParents, pid)
+				}
+				continue
+			case unvisited:
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+			if rejected[j] && reject == nil {
+				reject = fmt.Errorf("%w: parent node %s was rejected", ErrInvalidParents, pid)
+			}
+		}
+		state[i] = planned
+		rejected[i] = reject != nil
+		steps = append(steps, batchStep{index: i, node: node, err: reject})
+		return nil
+	}
+
+	for i := range nodes {
+		if state[i] == unvisited {
+			if err := visit(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return steps, nil
+}
+
+// approveChunk approves one bounded chunk of a batch under the DAG lock
+func (d *DAG) approveChunk(steps []batchStep, emit func(models.BatchResult) error) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	for _, step := range steps {
+		node := step.node
+		result := models.BatchResult{Index: step.index, ID: node.ID, Status: models.BatchStatusApproved}
+		err := step.err
+		if err == nil {
+			if len(node.Parents) == 0 {
+				err = errors.New("approved nodes must reference at least one parent node")
+			} else {
+				err = d.approveNodeLocked(node)
+			}
+		}
+		if err != nil {
+			result.Status = models.BatchStatusFailed
+			result.Error = err.Error()
+		}
+		if err := emit(result); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// updateParentNodeWeights recursively updates weights and cumulative weights of all parent nodes
+func (d *DAG) propagateWeights(parentIDs []string) error {
+	if len(parentIDs) == 0 {
+		return nil
+	}
 
-	// Update direct weights first
+	index, err := d.indexLocked()
+	if err != nil {
+		return err
+	}
+	children, parents := index.children, index.parents
+
+	// Update direct weights first. The weight is derived from the stored edges
+	// rather than incremented, so replaying a queued propagation is harmless.
 	for _, pid := range parentIDs {
 		parentNode, err := d.repo.GetNode(pid)
 		if err != nil {
@@ -114,7 +725,7 @@ func (d *DAG) propagateWeights(parentIDs []string) error {
 				zap.String("parent_id", pid))
 			continue
 		}
-		parentNode.Weight++
+		parentNode.Weight = directWeight(children[pid], d.loadNodes(children[pid], nil))
 		err = d.repo.PutNode(parentNode)
 		if err != nil {
 			logger.Logger.Warn("Failed updating parent weight",
@@ -128,11 +739,13 @@ func (d *DAG) propagateWeights(parentIDs []string) error {
 		d.markDependenciesAffected(pid, parents, affectedNodes)
 	}
 
-	// Recalculate cumulative weights for affected nodes
-	for nodeID := range affectedNodes {
-		if err := d.updateCumulativeWeight(nodeID, children); err != nil {
+	// Recalculate them bottom-up and store the ones that changed
+	pass := d.newCumulativePass(children, affectedNodes)
+	pass.run()
+	for _, node := range pass.changed {
+		if err := d.repo.PutNode(node); err != nil {
 			logger.Logger.Warn("Failed to update cumulative weight",
-				zap.String("node_id", nodeID), zap.Error(err))
+				zap.String("node_id", node.ID), zap.Error(err))
 		}
 	}
 
@@ -141,7 +754,7 @@ func (d *DAG) propagateWeights(parentIDs []string) error {
 
 // checks if adding this node would create a circular reference
 func (d *DAG) checkForCircularReferences(_ string, parentIDs []string) error {
-	allNodes, err := d.repo.GetAllNodes()
+	index, err := d.indexLocked()
 	if err != nil {
 		return err
 	}
@@ -164,14 +777,10 @@ func (d *DAG) checkForCircularReferences(_ string, parentIDs []string) error {
 		// Check if this node would be a parent of the new node
 		for _, pid := range parentIDs {
 			if pid == currentID {
-				for _, existingNode := range allNodes {
-					for _, existingParentID := range existingNode.Parents {
-						if existingParentID == currentID {
-							if hasCycle(existingNode.ID) {
-								recStack[currentID] = false
-								return true
-							}
-						}
+				for _, childID := range index.children[currentID] {
+					if hasCycle(childID) {
+						recStack[currentID] = false
+						return true
 					}
 				}
 			}
@@ -203,206 +812,221 @@ func (d *DAG) markDependenciesAffected(nodeID string, parents map[string][]strin
 	}
 }
 
-// updateCumulativeWeight calculates and stores the cumulative weight for a specific node
-func (d *DAG) updateCumulativeWeight(nodeID string, children map[string][]string) error {
-	node, err := d.repo.GetNode(nodeID)
-	if err != nil {
-		return err
+// countsDescendant reports whether a descendant reached during a cumulative weight
+// walk contributes again. In unique mode only its first visit counts.
+func (d *DAG) countsDescendant(id string, visited map[string]bool) bool {
+	if d.cfg.CumulativeMode == CumulativePerPath {
+		return true
 	}
-
-	// Calculate cumulative weight: direct weight + sum of all descendant weights
-	cumulativeWeight := int64(node.Weight)
-
-	// Add weights of all descendants recursively
-	var calculateDescendantWeight func(string) int64
-	calculateDescendantWeight = func(nID string) int64 {
-		descendantWeight := int64(0)
-		for _, childID := range children[nID] {
-			childNode, err := d.repo.GetNode(childID)
-			if err != nil {
-				continue
-			}
-			descendantWeight += int64(childNode.Weight)
-			descendantWeight += calculateDescendantWeight(childID)
-		}
-		return descendantWeight
+	if visited[id] {
+		return false
 	}
-
-	cumulativeWeight += calculateDescendantWeight(nodeID)
-
-	// Update the node's cumulative weight
-	node.CumulativeWeight = cumulativeWeight
-	return d.repo.PutNode(node)
+	visited[id] = true
+	return true
 }
 
-// GetHighestWeightNode returns node with highest direct weight (unchanged)
+// GetHighestWeightNode returns the live node with highest direct weight
 func (d *DAG) GetHighestWeightNode() (*models.Node, error) {
 	nodes, err := d.repo.GetAllNodes()
 	if err != nil {
 		return nil, err
 	}
-	if len(nodes) == 0 {
-		return nil, errors.New("no nodes in DAG")
-	}
 
-	highest := nodes[0]
+	var highest *models.Node
 	for _, node := range nodes {
-		if node.Weight > highest.Weight {
+		if !node.Deleted && (highest == nil || node.Weight > highest.Weight) {
 			highest = node
 		}
 	}
+	if highest == nil {
+		return nil, ErrEmptyGraph
+	}
 
 	return highest, nil
 }
 
-// GetHighestCumulativeWeightNode returns node with highest cumulative weight
+// GetHighestCumulativeWeightNode returns the live node with highest stored cumulative
+// weight. It is the fast path: one streaming pass over the store that trusts the
+// weights maintained by propagation, without loading or walking the graph. Use
+// GetHighestCumulativeWeightNodeVerified when the stored weights are in doubt.
 func (d *DAG) GetHighestCumulativeWeightNode() (*models.Node, error) {
-	nodes, err := d.repo.GetAllNodes()
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	var highest *models.Node
+	err := d.repo.EachNode(func(node *models.Node) error {
+		if !node.Deleted && (highest == nil || node.CumulativeWeight > highest.CumulativeWeight) {
+			highest = node
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if len(nodes) == 0 {
-		return nil, errors.New("no nodes in DAG")
+	if highest == nil {
+		return nil, ErrEmptyGraph
 	}
 
-	highest := nodes[0]
-	for _, node := range nodes {
-		if node.CumulativeWeight > highest.CumulativeWeight {
-			highest = node
+	if d.cfg.SelfHealOnRead {
+		if err := d.healOnReadLocked(highest); err != nil {
+			return nil, err
 		}
 	}
-
 	return highest, nil
 }
 
-// TipSelection now uses an MCMC-style weighted random walk.
-func (d *DAG) TipSelection() (*models.Node, error) {
-	const defaultAlpha = 0.01
-	const defaultMaxSteps = 10000
-	return d.TipSelectionMCMC(defaultAlpha, defaultMaxSteps)
-}
+// GetHighestCumulativeWeightNodeVerified is the slow path of
+// GetHighestCumulativeWeightNode: it ignores the stored weights, recomputes every
+// live node's direct and cumulative weight from the graph the way VerifyNode does,
+// and returns the maximum with the recomputed weights. That is one descendant walk
+// per node, so it is meant for audits rather than hot paths. Nothing is repaired.
+func (d *DAG) GetHighestCumulativeWeightNodeVerified() (*models.Node, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
 
-// TipSelectionMCMC runs a proper MCMC-style weighted random walk for tip selection.
-func (d *DAG) TipSelectionMCMC(alpha float64, maxSteps int) (*models.Node, error) {
 	nodes, err := d.repo.GetAllNodes()
 	if err != nil {
 		return nil, err
 	}
-	if len(nodes) == 0 {
-		return nil, errors.New("no nodes in DAG")
+	index, err := d.indexLocked()
+	if err != nil {
+		return nil, err
 	}
-
-	// build maps: id -> node, parents map, children map
+	children := index.children
 	nodesByID := make(map[string]*models.Node, len(nodes))
-	children := make(map[string][]string)
-	parents := make(map[string][]string)
-
 	for _, n := range nodes {
 		nodesByID[n.ID] = n
-		for _, p := range n.Parents {
-			children[p] = append(children[p], n.ID)
-			parents[n.ID] = append(parents[n.ID], p)
-		}
+	}
+	expected := make(map[string]*models.Node, len(nodes))
+	for _, n := range nodes {
+		fresh := *n
+		fresh.Weight = directWeight(children[n.ID], nodesByID)
+		expected[n.ID] = &fresh
 	}
 
-	// Find all nodes with no children
-	var tips []*models.Node
+	var highest *models.Node
 	for _, n := range nodes {
-		if len(children[n.ID]) == 0 {
-			tips = append(tips, n)
+		if n.Deleted {
+			continue
+		}
+		fresh := expected[n.ID]
+		fresh.CumulativeWeight = d.calculateCumulativeWeight(n.ID, children, expected)
+		if highest == nil || fresh.CumulativeWeight > highest.CumulativeWeight {
+			highest = fresh
 		}
 	}
-
-	if len(tips) == 0 {
-		// If no tips found, return a random node
-		return nodes[rand.Intn(len(nodes))], nil
+	if highest == nil {
+		return nil, ErrEmptyGraph
 	}
+	return highest, nil
+}
 
-	// Initialize random number generator
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-	// Start from a random tip
-	currentTip := tips[rnd.Intn(len(tips))]
-
-	// Perform MCMC walk
-	for step := 0; step < maxSteps; step++ {
-		currentWeight := d.calculateCumulativeWeight(currentTip.ID, children, nodesByID)
-		// Propose a random selection from all tip
-		proposedTip := tips[rnd.Intn(len(tips))]
-		proposedWeight := d.calculateCumulativeWeight(proposedTip.ID, children, nodesByID)
+// IsAncestor reports whether ancestor is reachable from descendant by following parent
+// links, i.e. descendant directly or indirectly approves it. The search walks the
+// adjacency index down from ancestor and stops as soon as descendant is found.
+func (d *DAG) IsAncestor(ancestor, descendant string) (bool, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
 
-		// Higher cumulative weight = higher probability of acceptance
-		acceptanceProb := math.Exp(alpha * float64(proposedWeight-currentWeight))
+	children, parents, err := d.indexRLocked()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := parents[ancestor]; !ok {
+		return false, ErrNodeNotFound
+	}
+	if _, ok := parents[descendant]; !ok {
+		return false, ErrNodeNotFound
+	}
+	if ancestor == descendant {
+		return false, nil
+	}
 
-		// Accept  the proposal
-		if rnd.Float64() < acceptanceProb {
-			currentTip = proposedTip
-		}
-
-		if step%100 == 0 && len(parents[currentTip.ID]) > 0 {
-			// Randomly walk to a parent node
-			parentID := parents[currentTip.ID][rnd.Intn(len(parents[currentTip.ID]))]
-			if _, exists := nodesByID[parentID]; exists {
-				if len(children[parentID]) > 0 {
-					childIDs := children[parentID]
-					randomChildID := childIDs[rnd.Intn(len(childIDs))]
-					if _, exists := nodesByID[randomChildID]; exists {
-						tipFromChild := d.walkToTip(randomChildID, children, nodesByID, rnd)
-						if tipFromChild != nil {
-							currentTip = tipFromChild
-						}
-					}
-				}
+	visited := map[string]bool{ancestor: true}
+	stack := []string{ancestor}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range children[id] {
+			if child == descendant {
+				return true, nil
+			}
+			if !visited[child] {
+				visited[child] = true
+				stack = append(stack, child)
 			}
 		}
 	}
-
-	return currentTip, nil
+	return false, nil
 }
 
-// calculateCumulativeWeight calculates the cumulative weight for a node
-func (d *DAG) calculateCumulativeWeight(nodeID string, children map[string][]string, nodesByID map[string]*models.Node) int64 {
-	node, exists := nodesByID[nodeID]
-	if !exists {
-		return 0
-	}
+// LongestChain returns the longest path from a genesis node to a tip, genesis first.
+// Lengths are computed by dynamic programming over a topological order. Among equally
+// long candidates the node with the higher cumulative weight wins, then the lower ID,
+// both when choosing the chain's tip and each step's predecessor. Stored edges that
+// form a cycle, which only corrupted data can contain, fail with ErrCycleDetected.
+func (d *DAG) LongestChain() ([]*models.Node, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
 
-	// Start with direct weight
-	cumulativeWeight := int64(node.Weight)
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrEmptyGraph
+	}
+	children, parents, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
 
-	var calculateParentWeight func(string) int64
-	calculateParentWeight = func(nID string) int64 {
-		descendantWeight := int64(0)
-		for _, childID := range children[nID] {
-			if childNode, exists := nodesByID[childID]; exists {
-				descendantWeight += int64(childNode.Weight)
-				descendantWeight += calculateParentWeight(childID)
-			}
+	byID := make(map[string]*models.Node, len(nodes))
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		byID[n.ID] = n
+		ids = append(ids, n.ID)
+	}
+	prefer := func(a, b *models.Node) bool {
+		if a.CumulativeWeight != b.CumulativeWeight {
+			return a.CumulativeWeight > b.CumulativeWeight
 		}
-		return descendantWeight
+		return a.ID < b.ID
 	}
 
-	cumulativeWeight += calculateParentWeight(nodeID)
-	return cumulativeWeight
-}
-
-// walkToTip walks from a given node to one of its parent tips
-func (d *DAG) walkToTip(nodeID string, children map[string][]string, nodesByID map[string]*models.Node, rnd *rand.Rand) *models.Node {
-	currentID := nodeID
+	// parents missing from the graph are ignored
+	order, err := topoOrder(ids, children, parents, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		childIDs := children[currentID]
-		if len(childIDs) == 0 {
-			if tipNode, exists := nodesByID[currentID]; exists {
-				return tipNode
+	length := make(map[string]int, len(nodes))
+	prev := make(map[string]string, len(nodes))
+	var end *models.Node
+	for _, id := range order {
+		node := byID[id]
+		length[id] = 1
+		for _, pid := range node.Parents {
+			parent, ok := byID[pid]
+			if !ok {
+				continue
+			}
+			candidate := length[pid] + 1
+			if candidate > length[id] || candidate == length[id] && prefer(parent, byID[prev[id]]) {
+				length[id] = candidate
+				prev[id] = pid
 			}
-			return nil
 		}
+		if end == nil || length[id] > length[end.ID] || length[id] == length[end.ID] && prefer(node, end) {
+			end = node
+		}
+	}
 
-		// Randomly choose a child
-		nextID := childIDs[rnd.Intn(len(childIDs))]
-		currentID = nextID
+	chain := make([]*models.Node, length[end.ID])
+	for i, id := len(chain)-1, end.ID; i >= 0; i, id = i-1, prev[id] {
+		chain[i] = byID[id]
 	}
+	return chain, nil
 }
 
 // GetNode retrieves a node by ID
@@ -410,7 +1034,27 @@ func (d *DAG) GetNode(id string) (*models.Node, error) {
 	d.mux.Lock()
 	defer d.mux.Unlock()
 
-	return d.repo.GetNode(id)
+	exists, err := d.repo.HasNode(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNodeNotFound
+	}
+	node, err := d.repo.GetNode(id)
+	if err != nil || !d.cfg.SelfHealOnRead {
+		return node, err
+	}
+
+	if err := d.healOnReadLocked(node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// HasNode reports whether a node exists without loading it
+func (d *DAG) HasNode(id string) (bool, error) {
+	return d.repo.HasNode(id)
 }
 
 // GetAllNodes retrieves all nodes from the repository
@@ -421,6 +1065,113 @@ func (d *DAG) GetAllNodes() ([]*models.Node, error) {
 	return d.repo.GetAllNodes()
 }
 
+// StreamNodes calls fn for every node in storage order without loading the whole set.
+// It doesn't take the DAG lock, so long streams never block writers; the underlying
+// iterator still yields a consistent view of the store.
+func (d *DAG) StreamNodes(fn func(*models.Node) error) error {
+	return d.repo.EachNode(fn)
+}
+
+// ListNodes retrieves all nodes in the configured public listing order
+func (d *DAG) ListNodes() ([]*models.Node, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	return d.repo.ListNodes(d.cfg.ListOrder)
+}
+
+// MaxDescendantDepth returns the length of the longest descendant path below a node
+func (d *DAG) MaxDescendantDepth(id string) (int, error) {
+	depth, _, err := d.DepthBelow(id)
+	return depth, err
+}
+
+// IsConfirmed applies the configured confirmation policy: a node is confirmed once
+// its cumulative weight or its descendant depth reaches the respective threshold
+func (d *DAG) IsConfirmed(id string) (bool, error) {
+	_, confirmed, err := d.DepthBelow(id)
+	return confirmed, err
+}
+
+// DepthBelow returns the longest descendant path below a node together with its
+// confirmation status, walking the adjacency index once for both
+func (d *DAG) DepthBelow(id string) (int, bool, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	exists, err := d.repo.HasNode(id)
+	if err != nil {
+		return 0, false, err
+	}
+	if !exists {
+		return 0, false, ErrNodeNotFound
+	}
+	node, err := d.repo.GetNode(id)
+	if err != nil {
+		return 0, false, err
+	}
+	children, _, err := d.indexRLocked()
+	if err != nil {
+		return 0, false, err
+	}
+
+	depth := descendantDepth(id, children, make(map[string]int))
+	confirmed := (d.cfg.ConfirmationWeight > 0 && node.CumulativeWeight >= d.cfg.ConfirmationWeight) ||
+		(d.cfg.ConfirmationDepth > 0 && depth >= d.cfg.ConfirmationDepth)
+	return depth, confirmed, nil
+}
+
+// ancestorDepth computes the longest path from a genesis node down to id, memoized
+// per call. Genesis nodes have depth 0; parents missing from the graph count as genesis.
+func ancestorDepth(id string, parents map[string][]string, memo map[string]int) int {
+	if depth, ok := memo[id]; ok {
+		return depth
+	}
+	depth := 0
+	for _, parentID := range parents[id] {
+		if parentDepth := ancestorDepth(parentID, parents, memo) + 1; parentDepth > depth {
+			depth = parentDepth
+		}
+	}
+	memo[id] = depth
+	return depth
+}
+
+// parentsOf maps each node ID to its parent IDs
+func parentsOf(nodes []*models.Node) map[string][]string {
+	parents := make(map[string][]string, len(nodes))
+	for _, n := range nodes {
+		parents[n.ID] = n.Parents
+	}
+	return parents
+}
+
+// descendantDepth computes the longest path to a tip below id, memoized per call
+func descendantDepth(id string, children map[string][]string, memo map[string]int) int {
+	if depth, ok := memo[id]; ok {
+		return depth
+	}
+	depth := 0
+	for _, childID := range children[id] {
+		if childDepth := descendantDepth(childID, children, memo) + 1; childDepth > depth {
+			depth = childDepth
+		}
+	}
+	memo[id] = depth
+	return depth
+}
+
+// childrenOf builds the parent -> children adjacency for the given nodes
+func childrenOf(nodes []*models.Node) map[string][]string {
+	children := make(map[string][]string)
+	for _, n := range nodes {
+		for _, p := range n.Parents {
+			children[p] = append(children[p], n.ID)
+		}
+	}
+	return children
+}
+
 // UpdateNode updates an existing node in the DAG
 func (d *DAG) UpdateNode(node *models.Node) error {
 	d.mux.Lock()
@@ -432,6 +1183,13 @@ func (d *DAG) UpdateNode(node *models.Node) error {
 		return errors.New("node does not exist")
 	}
 
+	// a confirmed node keeps its content; annotations and weights are not content
+	if nodeDigest(node, d.cfg.Hasher) != nodeDigest(existingNode, d.cfg.Hasher) {
+		if err := d.checkMutable(existingNode); err != nil {
+			return err
+		}
+	}
+
 	// Preserve the original weight if the incoming node has lower weight
 	if node.Weight < existingNode.Weight {
 		node.Weight = existingNode.Weight
@@ -442,45 +1200,190 @@ func (d *DAG) UpdateNode(node *models.Node) error {
 		node.CreatedAt = existingNode.CreatedAt
 	}
 
-	return d.repo.PutNode(node)
+	d.invalidateCountersLocked()
+	if err := d.repo.PutNode(node); err != nil {
+		return err
+	}
+	d.indexRemoveLocked(existingNode)
+	d.indexAddLocked(node)
+	return nil
 }
 
-func (d *DAG) CreateCheckpoint(id string) (*models.Checkpoint, error) {
+// checkMutable rejects edits to a node whose cumulative weight reached
+// cfg.ImmutableWeight. Callers apply it to any change of the node's content, its
+// parents, archive flag, attribution or payload, which are what checkpoints hash.
+func (d *DAG) checkMutable(node *models.Node) error {
+	if d.cfg.ImmutableWeight > 0 && node.CumulativeWeight >= d.cfg.ImmutableWeight {
+		return fmt.Errorf("%w: %s has cumulative weight %d (limit %d)",
+			ErrNodeImmutable, node.ID, node.CumulativeWeight, d.cfg.ImmutableWeight)
+	}
+	return nil
+}
+
+// Reparent replaces the parents of node id and fixes up every weight the edge change
+// affects: the direct weights of the old and new parents and the cumulative weights
+// of all their ancestors. It runs under the DAG lock, so no reader observes the edge
+// change without the matching weights. New parents must exist and must not be the
+// node itself or any of its descendants.
+func (d *DAG) Reparent(id string, parents []string) (*models.Node, error) {
+	if len(parents) == 0 {
+		return nil, fmt.Errorf("%w: at least one parent is required", ErrInvalidParents)
+	}
+
 	d.mux.Lock()
 	defer d.mux.Unlock()
 
-	nodes, err := d.repo.GetAllNodes()
+	exists, err := d.repo.HasNode(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNodeNotFound
+	}
+	node, err := d.repo.GetNode(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkMutable(node); err != nil {
+		return nil, err
+	}
+	index, err := d.indexLocked()
 	if err != nil {
 		return nil, err
 	}
 
-	// Create root hash (simple hash of concatenated node IDs)
-	hash := ""
-	for _, n := range nodes {
-		hash += n.ID
+	// the node and its descendants would close a cycle
+	forbidden := map[string]bool{id: true}
+	children := index.children
+	var markDescendants func(string)
+	markDescendants = func(nID string) {
+		for _, child := range children[nID] {
+			if !forbidden[child] {
+				forbidden[child] = true
+				markDescendants(child)
+			}
+		}
+	}
+	markDescendants(id)
+
+	seen := make(map[string]bool, len(parents))
+	for _, pid := range parents {
+		_, stored := index.parents[pid]
+		switch {
+		case seen[pid]:
+			return nil, fmt.Errorf("%w: parent %s listed twice", ErrInvalidParents, pid)
+		case forbidden[pid]:
+			return nil, fmt.Errorf("%w: parent %s would create a cycle", ErrInvalidParents, pid)
+		case !stored:
+			return nil, fmt.Errorf("%w: parent node %s does not exist", ErrInvalidParents, pid)
+		}
+		seen[pid] = true
+	}
+
+	affected := append(append([]string(nil), node.Parents...), parents...)
+	previous := &models.Node{ID: node.ID, Parents: node.Parents}
+	node.Parents = append([]string(nil), parents...)
+	d.invalidateCountersLocked()
+	if err := d.repo.PutNode(node); err != nil {
+		return nil, err
+	}
+	d.indexRemoveLocked(previous)
+	d.indexAddLocked(node)
+	if err := d.propagateWeights(affected); err != nil {
+		return nil, err
+	}
+	return d.repo.GetNode(id)
+}
+
+// contentCheckpointPrefix marks checkpoint IDs derived from the root hash
+const contentCheckpointPrefix = "cp-"
+
+// CreateCheckpoint records the current DAG state as a checkpoint and reports whether
+// a new one was stored. With an explicit id a duplicate fails with ErrCheckpointExists.
+// With an empty id the checkpoint is content-addressed: its ID is derived from the
+// root hash, so retrying over an unchanged graph returns the existing checkpoint
+// instead of creating another.
+func (d *DAG) CreateCheckpoint(optionalID string) (*models.Checkpoint, bool, error) {
+	if optionalID != "" {
+		if err := d.validateID("checkpoint", optionalID); err != nil {
+			return nil, false, err
+		}
+		if reservedCheckpointIDs[optionalID] {
+			return nil, false, fmt.Errorf("%w: checkpoint id %q is reserved", ErrInvalidID, optionalID)
+		}
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, false, err
+	}
+	rootHash := merkleRoot(nodes, d.cfg.Hasher)
+
+	id := optionalID
+	if id == "" {
+		id = contentCheckpointPrefix + rootHash[:16]
+	}
+
+	exists, err := d.repo.HasCheckpoint(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if exists {
+		if optionalID != "" {
+			return nil, false, ErrCheckpointExists
+		}
+		existing, err := d.repo.GetCheckpoint(id)
+		return existing, false, err
 	}
-	rootHash := fmt.Sprintf("%x", sha256.Sum256([]byte(hash)))
 
 	cp := &models.Checkpoint{
-		ID:        id,
-		Timestamp: nowMillis(),
-		RootHash:  rootHash,
-		NodeCount: len(nodes),
+		ID:         id,
+		Timestamp:  d.nowMillis(),
+		RootHash:   rootHash,
+		HashAlgo:   d.cfg.Hasher.Name(),
+		NodeCount:  len(nodes),
+		RootFormat: RootFormatMerkle,
 	}
 
-	err = d.repo.PutCheckpoint(cp)
+	// the nodes frozen now are the ones whose content startup can hold to the checkpoint
+	var frozen []string
+	for _, n := range nodes {
+		if d.checkMutable(n) != nil {
+			frozen = append(frozen, n.ID)
+		}
+	}
+	sort.Strings(frozen)
+
+	err = d.repo.PutCheckpointWithNodes(cp, nodeDigests(nodes, d.cfg.Hasher), frozen)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return cp, nil
+	d.recordCheckpointLocked(cp)
+	d.publish(models.EventCheckpointCreated, nil, cp)
+	return cp, true, nil
 }
 
 func (d *DAG) GetLatestCheckpoint() (*models.Checkpoint, error) {
 	return d.repo.GetLatestCheckpoint()
 }
 
-// GetSyncState computes and returns the current synchronization state of the DAG
-func (d *DAG) GetSyncState() (*models.SyncState, error) {
+// GetCheckpoint returns the checkpoint with the given ID, or ErrCheckpointNotFound
+func (d *DAG) GetCheckpoint(id string) (*models.Checkpoint, error) {
+	exists, err := d.repo.HasCheckpoint(id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, id)
+	}
+	return d.repo.GetCheckpoint(id)
+}
+
+// Export returns every stored node so another instance can merge them
+func (d *DAG) Export() (*models.Export, error) {
 	d.mux.Lock()
 	defer d.mux.Unlock()
 
@@ -488,28 +1391,206 @@ func (d *DAG) GetSyncState() (*models.SyncState, error) {
 	if err != nil {
 		return nil, err
 	}
+	return &models.Export{Nodes: nodes, ExportedAt: d.nowMillis()}, nil
+}
+
+// MergeOptions tune MergeWithOptions
+type MergeOptions struct {
+	// PreserveWeights stores the exported Weight and CumulativeWeight of added nodes
+	// verbatim instead of recomputing weights from the edges. It is meant for
+	// faithful restores of a snapshot, drift included, and bypasses the weight
+	// invariants; nodes that already exist locally keep their stored weights.
+	PreserveWeights bool
+}
+
+// Merge ingests another instance's export, recomputing weights from the merged edges
+func (d *DAG) Merge(export *models.Export) (*models.MergeResult, error) {
+	return d.MergeWithOptions(export, MergeOptions{})
+}
+
+// MergeWithOptions ingests another instance's export. Nodes missing locally are
+// added in topological order, nodes already stored with the same content are
+// skipped, and nodes whose parents or content differ or whose parents cannot be
+// resolved are reported as conflicts. Weights are
+// recomputed from the merged edges afterwards unless opts.PreserveWeights is set.
+func (d *DAG) MergeWithOptions(export *models.Export, opts MergeOptions) (*models.MergeResult, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	defer d.invalidateCountersLocked()
+
+	local, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	localByID := make(map[string]*models.Node, len(local))
+	for _, n := range local {
+		localByID[n.ID] = n
+	}
 
-	// Build children map to count tips
-	children := make(map[string][]string)
-	for _, n := range nodes {
-		for _, p := range n.Parents {
-			children[p] = append(children[p], n.ID)
+	result := &models.MergeResult{}
+	conflict := func(id, reason string) {
+		result.Conflicted++
+		result.Conflicts = append(result.Conflicts, models.MergeConflict{ID: id, Reason: reason})
+	}
+
+	// Split incoming nodes into known ones and ones to add
+	pending := make(map[string]*models.Node)
+	for _, n := range export.Nodes {
+		if existing, ok := localByID[n.ID]; ok {
+			switch {
+			case !sameParents(existing.Parents, n.Parents):
+				conflict(n.ID, "node exists with different parents")
+			case !sameContent(existing, n, d.cfg.Hasher):
+				conflict(n.ID, "node exists with different content")
+			default:
+				result.Skipped++
+			}
+			continue
+		}
+		if _, dup := pending[n.ID]; dup {
+			conflict(n.ID, "node appears more than once in export")
+			continue
 		}
+		if err := d.validateID("node", n.ID); err != nil {
+			conflict(n.ID, err.Error())
+			continue
+		}
+		pending[n.ID] = n
 	}
 
-	tipCount := 0
-	for _, n := range nodes {
-		if len(children[n.ID]) == 0 {
-			tipCount++
+	// Repeatedly add pending nodes whose parents are all stored (Kahn-style)
+	var added []string
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		for _, id := range sortedKeys(pending) {
+			n := pending[id]
+			ready := true
+			for _, pid := range n.Parents {
+				if _, ok := localByID[pid]; !ok {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+
+			stored := &models.Node{ID: n.ID, Parents: n.Parents, CreatedAt: n.CreatedAt, CreatedBy: n.CreatedBy, Data: n.Data, Annotations: n.Annotations}
+			if opts.PreserveWeights {
+				stored.Weight = n.Weight
+				stored.CumulativeWeight = n.CumulativeWeight
+			}
+			if stored.CreatedAt == 0 {
+				stored.CreatedAt = d.nowMillis()
+			}
+			if err := d.repo.PutNode(stored); err != nil {
+				return nil, err
+			}
+			d.indexAddLocked(stored)
+			localByID[id] = stored
+			delete(pending, id)
+			added = append(added, id)
+			result.Added++
+			progress = true
+		}
+	}
+	for _, id := range sortedKeys(pending) {
+		conflict(id, "parents missing or cyclic")
+	}
+
+	if result.Added > 0 && !opts.PreserveWeights {
+		if err := d.recomputeWeightsLocked(); err != nil {
+			return nil, err
 		}
 	}
+	for _, id := range added {
+		d.releaseParkedLocked(id)
+	}
+	return result, nil
+}
+
+// recomputeWeightsLocked rebuilds direct and cumulative weights for every node from
+// the stored edges; the caller must hold d.mux
+func (d *DAG) recomputeWeightsLocked() error {
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return err
+	}
+
+	index, err := d.indexLocked()
+	if err != nil {
+		return err
+	}
+	children := index.children
+	nodesByID := make(map[string]*models.Node, len(nodes))
+	for _, n := range nodes {
+		nodesByID[n.ID] = n
+	}
 
-	// Compute root hash similar to checkpoints (concat IDs, then sha256)
-	concat := ""
+	// Direct weights first, cumulative weights read them
+	for _, n := range nodes {
+		n.Weight = directWeight(children[n.ID], nodesByID)
+	}
 	for _, n := range nodes {
-		concat += n.ID
+		n.CumulativeWeight = d.calculateCumulativeWeight(n.ID, children, nodesByID)
+		if err := d.repo.PutNode(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameParents reports whether two parent lists reference the same set of IDs
+func sameParents(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	other := make(map[string]bool, len(b))
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+		other[id] = true
+	}
+	return len(set) == len(other)
+}
+
+// sameContent reports whether two versions of a node carry the same archive flag,
+// author and data; parents are compared separately by sameParents
+func sameContent(a, b *models.Node, hasher Hasher) bool {
+	ca, cb := *a, *b
+	ca.Parents, cb.Parents = nil, nil
+	return nodeDigest(&ca, hasher) == nodeDigest(&cb, hasher)
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys(m map[string]*models.Node) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetSyncState computes and returns the current synchronization state of the DAG
+func (d *DAG) GetSyncState() (*models.SyncState, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := d.indexLocked()
+	if err != nil {
+		return nil, err
 	}
-	rootHash := fmt.Sprintf("%x", sha256.Sum256([]byte(concat)))
+	tipCount := len(tipsOf(nodes, index.children))
+
+	rootHash := merkleRoot(nodes, d.cfg.Hasher)
 
 	latest, _ := d.repo.GetLatestCheckpoint()
 
@@ -518,12 +1599,111 @@ func (d *DAG) GetSyncState() (*models.SyncState, error) {
 		NodeCount:        len(nodes),
 		TipCount:         tipCount,
 		RootHash:         rootHash,
-		Timestamp:        nowMillis(),
+		Timestamp:        d.nowMillis(),
+	}
+	if d.propagation != nil {
+		state.PendingPropagations = d.propagation.pendingCount()
 	}
 	return state, nil
 }
 
-// nowMillis returns current time in milliseconds
-func nowMillis() int64 {
-	return time.Now().UnixMilli()
+// GetLifetimeStats returns the durable counters of nodes ever added and approved.
+// Unlike the node count these never decrease.
+func (d *DAG) GetLifetimeStats() (*models.LifetimeStats, error) {
+	additions, err := d.repo.GetCounter(repository.CounterAdditions)
+	if err != nil {
+		return nil, err
+	}
+	approvals, err := d.repo.GetCounter(repository.CounterApprovals)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LifetimeStats{Additions: additions, Approvals: approvals}, nil
+}
+
+// GetStats returns runtime statistics about the DAG service
+func (d *DAG) GetStats() *models.Stats {
+	d.statsMux.Lock()
+	defer d.statsMux.Unlock()
+
+	return &models.Stats{
+		TipSelectionLatencyEMA: d.tipLatencyEMA,
+		TipSelections:          d.tipSelectionRuns,
+	}
+}
+
+// dedupeParents drops repeated IDs from parents, keeping the first occurrence of
+// each so the stored order follows the request
+func dedupeParents(parents []string) []string {
+	if len(parents) < 2 {
+		return parents
+	}
+	seen := make(map[string]bool, len(parents))
+	deduped := make([]string, 0, len(parents))
+	for _, pid := range parents {
+		if !seen[pid] {
+			seen[pid] = true
+			deduped = append(deduped, pid)
+		}
+	}
+	return deduped
+}
+
+// validateID checks the rules shared by node and checkpoint IDs: non-empty, bounded
+// length and no ':' so an ID can never collide with a reserved key prefix such as
+// "checkpoint:"
+func (d *DAG) validateID(kind, id string) error {
+	limit := d.cfg.MaxIDLength
+	if limit <= 0 {
+		limit = defaultMaxIDLength
+	}
+	if id == "" {
+		return fmt.Errorf("%w: %s id must not be empty", ErrInvalidID, kind)
+	}
+	if len(id) > limit {
+		return fmt.Errorf("%w: %s id exceeds %d characters", ErrInvalidID, kind, limit)
+	}
+	if strings.Contains(id, ":") {
+		return fmt.Errorf("%w: %s id must not contain ':'", ErrInvalidID, kind)
+	}
+	return nil
+}
+
+// validateAuthor checks a node's optional created_by: bounded length and no control
+// characters, so it stays printable in logs and unambiguous in the root hash
+func validateAuthor(author string) error {
+	if len(author) > maxAuthorLength {
+		return fmt.Errorf("%w: exceeds %d characters", ErrInvalidAuthor, maxAuthorLength)
+	}
+	for _, r := range author {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: must not contain control characters", ErrInvalidAuthor)
+		}
+	}
+	return nil
+}
+
+// computeRootHash hashes the concatenated node IDs with the given algorithm, the
+// root of checkpoints created before Merkle roots; it is only used to verify those.
+// A node with an author contributes ":<length>:<created_by>" after its ID, so
+// attribution cannot be changed without changing the root, while roots over
+// unattributed nodes stay what they were before authors existed.
+func computeRootHash(nodes []*models.Node, hasher Hasher) string {
+	var concat strings.Builder
+	for _, n := range nodes {
+		concat.WriteString(n.ID)
+		if n.CreatedBy != "" {
+			fmt.Fprintf(&concat, ":%d:%s", len(n.CreatedBy), n.CreatedBy)
+		}
+	}
+	return fmt.Sprintf("%x", hasher.Sum([]byte(concat.String())))
+}
+
+// nowMillis returns the configured clock's time as unix milliseconds. Every stored
+// timestamp (CreatedAt, checkpoints, events, exports) comes from here; epoch
+// milliseconds count from 1970-01-01T00:00:00Z and never depend on the host's time
+// zone, so values from different hosts compare directly. Render them with
+// models.FormatTimestamp.
+func (d *DAG) nowMillis() int64 {
+	return d.cfg.Clock.Now().UTC().UnixMilli()
 }
@@ -0,0 +1,2178 @@
+package dag_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"dag-project/dag"
+	"dag-project/db"
+	"dag-project/logger"
+	"dag-project/models"
+	"dag-project/repository"
+)
+
+// newTestDAG returns a DAG backed by a LevelDB instance in a temporary directory
+func newTestDAG(t testing.TB, cfg dag.Config) (*dag.DAG, *repository.NodeRepository) {
+	t.Helper()
+	logger.Logger = zap.NewNop()
+
+	ldb, err := db.NewLevelDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+	t.Cleanup(func() { ldb.Close() })
+
+	repo := repository.NewNodeRepository(ldb)
+	return dag.NewDAGWithConfig(repo, cfg), repo
+}
+
+func TestSelectTips_DistinctAndProportional(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+
+	// the tip X approves H, which carries far more cumulative weight than L, the
+	// node approved by the tips Y and Z
+	for _, n := range []*models.Node{
+		{ID: "H", CumulativeWeight: 9},
+		{ID: "L"},
+		{ID: "X", Parents: []string{"H"}},
+		{ID: "Y", Parents: []string{"L"}},
+		{ID: "Z", Parents: []string{"L"}},
+	} {
+		if err := repo.PutNode(n); err != nil {
+			t.Fatalf("failed to store node %s: %v", n.ID, err)
+		}
+	}
+
+	tips, err := d.SelectTips(5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tips) != 3 {
+		t.Fatalf("expected all 3 tips when asking for more, got %d", len(tips))
+	}
+
+	const runs = 2000
+	firstPicks := make(map[string]int)
+	for i := 0; i < runs; i++ {
+		tips, err := d.SelectTips(2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tips) != 2 {
+			t.Fatalf("expected 2 tips, got %d", len(tips))
+		}
+		if tips[0].ID == tips[1].ID {
+			t.Fatalf("expected distinct tips, got %s twice", tips[0].ID)
+		}
+		firstPicks[tips[0].ID]++
+	}
+
+	// X should be drawn first about 10/12 of the time
+	if share := float64(firstPicks["X"]) / runs; share < 0.7 || share > 0.95 {
+		t.Fatalf("expected X first in roughly 83%% of runs, got %.2f (%v)", share, firstPicks)
+	}
+	if firstPicks["Y"] == 0 || firstPicks["Z"] == 0 {
+		t.Fatalf("expected light tips to be drawn occasionally, got %v", firstPicks)
+	}
+}
+
+func TestIsConfirmed_ByDepth(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.ConfirmationDepth = 2
+	d, _ := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"B"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	for id, want := range map[string]bool{"A": true, "B": false, "C": false} {
+		confirmed, err := d.IsConfirmed(id)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", id, err)
+		}
+		if confirmed != want {
+			t.Fatalf("expected %s confirmed=%v, got %v", id, want, confirmed)
+		}
+	}
+
+	if depth, confirmed, err := d.DepthBelow("A"); err != nil || depth != 2 || !confirmed {
+		t.Fatalf("expected A 2 deep and confirmed, got %d/%v/%v", depth, confirmed, err)
+	}
+	if _, _, err := d.DepthBelow("missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestLifetimeCounters_SurviveReopen(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	dir := t.TempDir()
+
+	ldb, err := db.NewLevelDB(dir)
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+	d := dag.NewDAG(repository.NewNodeRepository(ldb))
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"B"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+	ldb.Close()
+
+	ldb, err = db.NewLevelDB(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen leveldb: %v", err)
+	}
+	defer ldb.Close()
+	d = dag.NewDAG(repository.NewNodeRepository(ldb))
+
+	stats, err := d.GetLifetimeStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Additions != 1 || stats.Approvals != 2 {
+		t.Fatalf("expected 1 addition and 2 approvals, got %+v", stats)
+	}
+
+	nodes, err := d.GetAllNodes()
+	if err != nil {
+		t.Fatalf("unexpected error listing nodes: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected counters to stay out of the node scan, got %d nodes", len(nodes))
+	}
+}
+
+func TestAsyncPropagation_FlushAndClose(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.AsyncPropagation = true
+	cfg.PropagationWorkers = 2
+	d, repo := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"B", "C"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	if pending := d.Flush(); pending < 0 || pending > 3 {
+		t.Fatalf("expected at most 3 pending propagations flushed, got %d", pending)
+	}
+	if a, _ := repo.GetNode("A"); a.Weight != 2 {
+		t.Fatalf("expected A weight 2 after Flush, got %d", a.Weight)
+	}
+
+	d.Close()
+
+	state, err := d.GetSyncState()
+	if err != nil {
+		t.Fatalf("failed to read sync state: %v", err)
+	}
+	if state.PendingPropagations != 0 {
+		t.Fatalf("expected no pending propagations after Close, got %d", state.PendingPropagations)
+	}
+
+	// A: weight 2 (B, C) + B 1 + C 1 + D 0
+	a, err := repo.GetNode("A")
+	if err != nil {
+		t.Fatalf("failed to read A: %v", err)
+	}
+	if a.Weight != 2 || a.CumulativeWeight != 4 {
+		t.Fatalf("expected A weight 2 cumulative 4, got %d/%d", a.Weight, a.CumulativeWeight)
+	}
+
+	// approvals after Close propagate synchronously
+	if err := d.ApproveNode(&models.Node{ID: "E", Parents: []string{"D"}}); err != nil {
+		t.Fatalf("failed to approve E: %v", err)
+	}
+	dNode, _ := repo.GetNode("D")
+	if dNode.Weight != 1 {
+		t.Fatalf("expected D weight 1 after synchronous approval, got %d", dNode.Weight)
+	}
+}
+
+func TestTipSelection_NoTipsFallback(t *testing.T) {
+	// A and B approve each other, so the graph has no frontier
+	cyclic := []*models.Node{
+		{ID: "A", Parents: []string{"B"}, CumulativeWeight: 5, CreatedAt: 1},
+		{ID: "B", Parents: []string{"A"}, CumulativeWeight: 2, CreatedAt: 2},
+	}
+
+	cases := []struct {
+		fallback dag.TipFallback
+		want     string
+	}{
+		{dag.TipFallbackHighestCumulative, "A"},
+		{dag.TipFallbackNewest, "B"},
+	}
+	for _, tc := range cases {
+		cfg := dag.DefaultConfig()
+		cfg.TipFallback = tc.fallback
+		d, repo := newTestDAG(t, cfg)
+		for _, n := range cyclic {
+			if err := repo.PutNode(n); err != nil {
+				t.Fatalf("failed to store node %s: %v", n.ID, err)
+			}
+		}
+		tip, err := d.TipSelection()
+		if err != nil {
+			t.Fatalf("unexpected error for fallback %d: %v", tc.fallback, err)
+		}
+		if tip.ID != tc.want {
+			t.Fatalf("expected fallback %d to return %s, got %s", tc.fallback, tc.want, tip.ID)
+		}
+	}
+
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+	for _, n := range cyclic {
+		if err := repo.PutNode(n); err != nil {
+			t.Fatalf("failed to store node %s: %v", n.ID, err)
+		}
+	}
+	if _, err := d.TipSelection(); !errors.Is(err, dag.ErrNoTips) {
+		t.Fatalf("expected ErrNoTips by default, got %v", err)
+	}
+}
+
+func TestTipSelection_TimeBudget(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, id := range []string{"B", "C"} {
+		if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); err != nil {
+			t.Fatalf("failed to approve %s: %v", id, err)
+		}
+	}
+
+	budget := 20 * time.Millisecond
+	start := time.Now()
+	tip, err := d.TipSelectionWithParams(dag.TipSelectionParams{Alpha: 0.01, Budget: budget})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tip.ID != "B" && tip.ID != "C" {
+		t.Fatalf("expected a tip, got %s", tip.ID)
+	}
+	if elapsed < budget {
+		t.Fatalf("expected the walk to use its %s budget, returned after %s", budget, elapsed)
+	}
+
+	// the step bound wins when it is reached first
+	start = time.Now()
+	if _, err := d.TipSelectionWithParams(dag.TipSelectionParams{Alpha: 0.01, MaxSteps: 1, Budget: time.Minute}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected max steps to end the walk early, took %s", elapsed)
+	}
+}
+
+func TestReparent_MatchesRecompute(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"B"}},
+		{ID: "E", Parents: []string{"D"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	// D moves from B to C, taking E with it
+	if _, err := d.Reparent("D", []string{"C"}); err != nil {
+		t.Fatalf("failed to reparent D: %v", err)
+	}
+	if _, err := d.Reparent("C", []string{"E"}); !errors.Is(err, dag.ErrInvalidParents) {
+		t.Fatalf("expected a cycle to be rejected, got %v", err)
+	}
+	if _, err := d.Reparent("missing", []string{"A"}); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+
+	// merging the export into an empty DAG recomputes every weight from the edges
+	export, err := d.Export()
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	fresh, freshRepo := newTestDAG(t, dag.DefaultConfig())
+	if _, err := fresh.Merge(export); err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+
+	for _, id := range []string{"A", "B", "C", "D", "E"} {
+		got, _ := repo.GetNode(id)
+		want, _ := freshRepo.GetNode(id)
+		if got.Weight != want.Weight || got.CumulativeWeight != want.CumulativeWeight {
+			t.Fatalf("node %s: reparented weights %d/%d, recomputed %d/%d",
+				id, got.Weight, got.CumulativeWeight, want.Weight, want.CumulativeWeight)
+		}
+	}
+	if b, _ := repo.GetNode("B"); b.Weight != 0 {
+		t.Fatalf("expected B to lose its approval, weight %d", b.Weight)
+	}
+}
+
+func TestApproveNode_MaxDepth(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.MaxDepth = 2
+	d, _ := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"B"}},
+		{ID: "D", Parents: []string{"A", "B"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	err := d.ApproveNode(&models.Node{ID: "E", Parents: []string{"A", "C"}})
+	if !errors.Is(err, dag.ErrMaxDepthExceeded) {
+		t.Fatalf("expected ErrMaxDepthExceeded for depth 3, got %v", err)
+	}
+	if exists, _ := d.HasNode("E"); exists {
+		t.Fatal("rejected node must not be stored")
+	}
+}
+
+func TestApproveNode_ClientTimestampSkew(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.ClientTimestamps = true
+	cfg.TimestampSkew = 100 * time.Millisecond
+	d, repo := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	a, _ := repo.GetNode("A")
+
+	err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}, CreatedAt: a.CreatedAt - 500})
+	if !errors.Is(err, dag.ErrInvalidTimestamp) {
+		t.Fatalf("expected ErrInvalidTimestamp, got %v", err)
+	}
+
+	// within the skew the client timestamp is kept as supplied
+	if err := d.ApproveNode(&models.Node{ID: "C", Parents: []string{"A"}, CreatedAt: a.CreatedAt - 50}); err != nil {
+		t.Fatalf("expected skewed timestamp to be accepted, got %v", err)
+	}
+	if c, _ := repo.GetNode("C"); c.CreatedAt != a.CreatedAt-50 {
+		t.Fatalf("expected client created_at %d, got %d", a.CreatedAt-50, c.CreatedAt)
+	}
+
+	// without a supplied timestamp the server assigns one
+	if err := d.ApproveNode(&models.Node{ID: "D", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve D: %v", err)
+	}
+	if dNode, _ := repo.GetNode("D"); dNode.CreatedAt < a.CreatedAt {
+		t.Fatalf("expected server-assigned created_at, got %d", dNode.CreatedAt)
+	}
+}
+
+// recordingSink collects published events
+type recordingSink struct {
+	events []models.Event
+}
+
+func (s *recordingSink) Publish(event models.Event) {
+	s.events = append(s.events, event)
+}
+
+func TestEventSink_ReceivesCommittedChanges(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+	sink := &recordingSink{}
+	d.SetEventSink(sink)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve B: %v", err)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "C", Parents: []string{"missing"}}); err == nil {
+		t.Fatal("expected approval with a missing parent to fail")
+	}
+	if _, _, err := d.CreateCheckpoint("cp1"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	var types []string
+	for _, e := range sink.events {
+		types = append(types, e.Type)
+	}
+	want := []string{models.EventNodeAdded, models.EventNodeApproved, models.EventCheckpointCreated}
+	if len(types) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, types)
+		}
+	}
+	if sink.events[1].Node.ID != "B" || sink.events[2].Checkpoint.ID != "cp1" {
+		t.Fatalf("unexpected event payloads: %+v", sink.events)
+	}
+}
+
+func TestShapeReport(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	for _, id := range []string{"A", "X"} {
+		if err := d.AddNode(&models.Node{ID: id}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"B", "C"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	report, err := d.ShapeReport()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.NodeCount != 5 || report.Components != 2 || report.Diameter != 2 || !report.DiameterComputed {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	// A has 2 children, B and C 1 each, D and X none
+	if report.OutDegrees[0] != 2 || report.OutDegrees[1] != 2 || report.OutDegrees[2] != 1 {
+		t.Fatalf("unexpected out-degree distribution %v", report.OutDegrees)
+	}
+}
+
+func TestConfirmedNode_IsImmutable(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.ImmutableWeight = 2
+	d, repo := newTestDAG(t, cfg)
+
+	for _, id := range []string{"A", "X"} {
+		if err := d.AddNode(&models.Node{ID: id}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"B"}},
+		{ID: "D", Parents: []string{"C"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	// B carries C and D, so its cumulative weight reached the threshold
+	if _, err := d.Reparent("B", []string{"X"}); !errors.Is(err, dag.ErrNodeImmutable) {
+		t.Fatalf("expected ErrNodeImmutable from Reparent, got %v", err)
+	}
+	b, _ := repo.GetNode("B")
+	b.Parents = []string{"X"}
+	if err := d.UpdateNode(b); !errors.Is(err, dag.ErrNodeImmutable) {
+		t.Fatalf("expected ErrNodeImmutable from UpdateNode, got %v", err)
+	}
+
+	if _, err := d.ArchiveNode("B"); !errors.Is(err, dag.ErrNodeImmutable) {
+		t.Fatalf("expected ErrNodeImmutable from ArchiveNode, got %v", err)
+	}
+	if stored, _ := repo.GetNode("B"); stored.Deleted {
+		t.Fatal("expected B to stay live")
+	}
+
+	// the payload and attribution are frozen as well, annotations are not
+	for _, edit := range []func(n *models.Node){
+		func(n *models.Node) { n.Data = json.RawMessage(`{"amount":2}`) },
+		func(n *models.Node) { n.CreatedBy = "mallory" },
+	} {
+		b, _ := repo.GetNode("B")
+		edit(b)
+		if err := d.UpdateNode(b); !errors.Is(err, dag.ErrNodeImmutable) {
+			t.Fatalf("expected ErrNodeImmutable for a content change, got %v", err)
+		}
+	}
+	b, _ = repo.GetNode("B")
+	b.Annotations = map[string]string{"status": "reviewed"}
+	if err := d.UpdateNode(b); err != nil {
+		t.Fatalf("expected annotations to stay editable, got %v", err)
+	}
+	if stored, _ := repo.GetNode("B"); stored.Data != nil || stored.CreatedBy != "" {
+		t.Fatalf("expected B's content to be unchanged, got %+v", stored)
+	}
+
+	// the unconfirmed frontier stays editable
+	if _, err := d.Reparent("D", []string{"X"}); err != nil {
+		t.Fatalf("expected tip D to be reparentable, got %v", err)
+	}
+}
+
+func TestLineage(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add genesis: %v", err)
+	}
+	// D reaches A both through C -> B (three hops) and through a direct edge,
+	// so A must be reported once at its shortest distance
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"B"}},
+		{ID: "D", Parents: []string{"C", "A"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	lineage, err := d.Lineage("D")
+	if err != nil {
+		t.Fatalf("Lineage failed: %v", err)
+	}
+	want := []struct {
+		id       string
+		distance int
+	}{{"A", 1}, {"C", 1}, {"B", 2}}
+	if len(lineage) != len(want) {
+		t.Fatalf("expected %d ancestors, got %d", len(want), len(lineage))
+	}
+	for i, w := range want {
+		if lineage[i].Node.ID != w.id || lineage[i].Distance != w.distance {
+			t.Fatalf("entry %d: expected %s@%d, got %s@%d", i, w.id, w.distance, lineage[i].Node.ID, lineage[i].Distance)
+		}
+	}
+
+	genesis, err := d.Lineage("A")
+	if err != nil || len(genesis) != 0 {
+		t.Fatalf("expected empty lineage for genesis, got %v (err %v)", genesis, err)
+	}
+	if _, err := d.Lineage("missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestGetSiblings(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	for _, id := range []string{"A", "B"} {
+		if err := d.AddNode(&models.Node{ID: id}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	// D shares both A and B with C, so it must be listed once; F has its own parent
+	for _, n := range []*models.Node{
+		{ID: "C", Parents: []string{"A", "B"}},
+		{ID: "D", Parents: []string{"A", "B"}},
+		{ID: "E", Parents: []string{"B"}},
+		{ID: "F", Parents: []string{"D"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	siblings, err := d.GetSiblings("C")
+	if err != nil {
+		t.Fatalf("GetSiblings failed: %v", err)
+	}
+	if len(siblings) != 2 || siblings[0].ID != "D" || siblings[1].ID != "E" {
+		t.Fatalf("expected siblings [D E], got %v", siblings)
+	}
+
+	unique, err := d.GetSiblings("F")
+	if err != nil || len(unique) != 0 {
+		t.Fatalf("expected no siblings for unique parentage, got %v (err %v)", unique, err)
+	}
+	if _, err := d.GetSiblings("missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestArchiveNode_SkipsArchivedTips(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"C"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	archived, err := d.ArchiveNode("B")
+	if err != nil || !archived.Deleted {
+		t.Fatalf("expected B to be archived, got %+v (err %v)", archived, err)
+	}
+	params := dag.TipSelectionParams{Alpha: 0.01, MaxSteps: 200}
+	for i := 0; i < 20; i++ {
+		tip, err := d.TipSelectionWithParams(params)
+		if err != nil {
+			t.Fatalf("tip selection failed: %v", err)
+		}
+		if tip.ID != "D" {
+			t.Fatalf("expected only live tip D, got %s", tip.ID)
+		}
+	}
+	a, _ := d.GetNode("A")
+	if a.Weight != 1 || a.CumulativeWeight != 2 {
+		t.Fatalf("expected A to lose B's approval (weight 1, cumulative 2), got %d/%d", a.Weight, a.CumulativeWeight)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "E", Parents: []string{"B"}}); !errors.Is(err, dag.ErrInvalidParents) {
+		t.Fatalf("expected ErrInvalidParents for an archived parent, got %v", err)
+	}
+
+	// C's only child is archived, so C is a tip again
+	if _, err := d.ArchiveNode("D"); err != nil {
+		t.Fatalf("failed to archive D: %v", err)
+	}
+	tip, err := d.TipSelectionWithParams(params)
+	if err != nil || tip.ID != "C" {
+		t.Fatalf("expected C to become the tip, got %v (err %v)", tip, err)
+	}
+	if _, err := d.ArchiveNode("missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+// buildDiamond creates A <- B, C <- D <- E, where D approves both B and C
+func buildDiamond(t *testing.T, d *dag.DAG) {
+	t.Helper()
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add genesis: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"B", "C"}},
+		{ID: "E", Parents: []string{"D"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+}
+
+func TestCumulativeMode_Diamond(t *testing.T) {
+	// Direct weights: A=2, B=1, C=1, D=1, E=0
+	cases := []struct {
+		mode dag.CumulativeMode
+		want int64
+	}{
+		// A + B + C + D + E, each once
+		{dag.CumulativeUnique, 5},
+		// A + (B + D + E) + (C + D + E): D is reached along two paths
+		{dag.CumulativePerPath, 6},
+	}
+	for _, tc := range cases {
+		cfg := dag.DefaultConfig()
+		cfg.CumulativeMode = tc.mode
+		d, repo := newTestDAG(t, cfg)
+		buildDiamond(t, d)
+
+		a, err := repo.GetNode("A")
+		if err != nil {
+			t.Fatalf("failed to read A: %v", err)
+		}
+		if a.CumulativeWeight != tc.want {
+			t.Fatalf("mode %d: expected cumulative weight %d, got %d", tc.mode, tc.want, a.CumulativeWeight)
+		}
+	}
+}
+
+func TestPropagation_MatchesFullRecomputation(t *testing.T) {
+	for _, mode := range []dag.CumulativeMode{dag.CumulativeUnique, dag.CumulativePerPath} {
+		cfg := dag.DefaultConfig()
+		cfg.CumulativeMode = mode
+		d, _ := newTestDAG(t, cfg)
+		if err := d.AddNode(&models.Node{ID: "n000"}); err != nil {
+			t.Fatalf("failed to add genesis: %v", err)
+		}
+
+		// chains, diamonds and an occasional archive, all through the incremental path
+		rnd := rand.New(rand.NewSource(int64(mode) + 1))
+		ids := []string{"n000"}
+		for i := 1; i < 60; i++ {
+			parents := map[string]bool{}
+			for k := rnd.Intn(3); k >= 0; k-- {
+				parents[ids[len(ids)-1-rnd.Intn(min(len(ids), 8))]] = true
+			}
+			node := &models.Node{ID: fmt.Sprintf("n%03d", i)}
+			for pid := range parents {
+				node.Parents = append(node.Parents, pid)
+			}
+			sort.Strings(node.Parents)
+			if err := d.ApproveNode(node); err != nil {
+				t.Fatalf("failed to approve %s: %v", node.ID, err)
+			}
+			ids = append(ids, node.ID)
+			if i%20 == 0 {
+				// archived nodes can't be approved, so they leave the candidates
+				archived := len(ids) - 3
+				if _, err := d.ArchiveNode(ids[archived]); err != nil {
+					t.Fatalf("failed to archive %s: %v", ids[archived], err)
+				}
+				ids = append(ids[:archived], ids[archived+1:]...)
+			}
+		}
+
+		nodes, _ := d.GetAllNodes()
+		for _, n := range nodes {
+			_, consistency, err := d.VerifyNode(n.ID)
+			if err != nil {
+				t.Fatalf("failed to verify %s: %v", n.ID, err)
+			}
+			if !consistency.Consistent {
+				t.Fatalf("mode %d: %s stored %d/%d, recomputed %d/%d", mode, n.ID,
+					consistency.StoredWeight, consistency.StoredCumulativeWeight,
+					consistency.ExpectedWeight, consistency.ExpectedCumulativeWeight)
+			}
+		}
+	}
+}
+
+func TestCumulativeWeight_DiamondCountsSharedDescendantOnce(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+
+	// A <- B, A <- C, B <- D, C <- D
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"B", "C"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+
+	// D's approval raises B and C by one each; A adds both once: 2 + 1 + 1 + 0
+	want := map[string][2]int64{"A": {2, 4}, "B": {1, 1}, "C": {1, 1}, "D": {0, 0}}
+	for id, w := range want {
+		n, err := repo.GetNode(id)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", id, err)
+		}
+		if int64(n.Weight) != w[0] || n.CumulativeWeight != w[1] {
+			t.Fatalf("expected %s weights %d/%d, got %d/%d", id, w[0], w[1], n.Weight, n.CumulativeWeight)
+		}
+	}
+}
+
+func TestApproveBatch_InterrelatedNodes(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add genesis: %v", err)
+	}
+
+	// C references B, which only arrives later in the batch; X and Y reference each
+	// other, and Z depends on that cycle
+	batch := []*models.Node{
+		{ID: "C", Parents: []string{"B"}},
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "X", Parents: []string{"Y"}},
+		{ID: "Y", Parents: []string{"X"}},
+		{ID: "Z", Parents: []string{"X"}},
+		{ID: "M", Parents: []string{"missing"}},
+	}
+	var results []models.BatchResult
+	err := d.ApproveBatch(batch, func(r models.BatchResult) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ApproveBatch failed: %v", err)
+	}
+
+	want := []struct {
+		id     string
+		status string
+	}{
+		{"B", models.BatchStatusApproved},
+		{"C", models.BatchStatusApproved},
+		{"Y", models.BatchStatusFailed},
+		{"X", models.BatchStatusFailed},
+		{"Z", models.BatchStatusFailed},
+		{"M", models.BatchStatusFailed},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %d: %+v", len(want), len(results), results)
+	}
+	for i, w := range want {
+		if results[i].ID != w.id || results[i].Status != w.status {
+			t.Fatalf("result %d: expected %s %s, got %+v", i, w.id, w.status, results[i])
+		}
+	}
+
+	for _, id := range []string{"X", "Y", "Z", "M"} {
+		if ok, _ := repo.HasNode(id); ok {
+			t.Fatalf("rejected node %s must not be stored", id)
+		}
+	}
+	a, _ := repo.GetNode("A")
+	if a.CumulativeWeight != 2 {
+		t.Fatalf("expected A cumulative weight 2, got %d", a.CumulativeWeight)
+	}
+}
+
+func TestApproveBatch_ResultIndexMatchesInput(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add genesis: %v", err)
+	}
+
+	// processing order is D, C, B, E: every node waits for the one after it
+	batch := []*models.Node{
+		{ID: "B", Parents: []string{"C"}},
+		{ID: "C", Parents: []string{"D"}},
+		{ID: "D", Parents: []string{"A"}},
+		{ID: "E", Parents: []string{"missing"}},
+	}
+	var results []models.BatchResult
+	if err := d.ApproveBatch(batch, func(r models.BatchResult) error {
+		results = append(results, r)
+		return nil
+	}); err != nil {
+		t.Fatalf("ApproveBatch failed: %v", err)
+	}
+
+	if len(results) != len(batch) || results[0].ID != "D" {
+		t.Fatalf("expected a reordered result per node, got %+v", results)
+	}
+	seen := make(map[int]bool, len(results))
+	for _, r := range results {
+		if r.Index < 0 || r.Index >= len(batch) || seen[r.Index] {
+			t.Fatalf("result has an invalid or repeated index: %+v", r)
+		}
+		seen[r.Index] = true
+		if batch[r.Index].ID != r.ID {
+			t.Fatalf("result for index %d is %s, expected input node %s", r.Index, r.ID, batch[r.Index].ID)
+		}
+	}
+}
+
+func TestSelfHealOnRead(t *testing.T) {
+	for _, heal := range []bool{false, true} {
+		cfg := dag.DefaultConfig()
+		cfg.SelfHealOnRead = heal
+		d, repo := newTestDAG(t, cfg)
+
+		if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+			t.Fatalf("failed to add genesis: %v", err)
+		}
+		if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+			t.Fatalf("failed to approve B: %v", err)
+		}
+		if err := d.ApproveNode(&models.Node{ID: "C", Parents: []string{"B"}}); err != nil {
+			t.Fatalf("failed to approve C: %v", err)
+		}
+
+		// simulate drift: A lost its approval count
+		drifted, _ := repo.GetNode("A")
+		drifted.Weight, drifted.CumulativeWeight = 0, 0
+		if err := repo.PutNode(drifted); err != nil {
+			t.Fatalf("failed to store drifted node: %v", err)
+		}
+
+		node, err := d.GetNode("A")
+		if err != nil {
+			t.Fatalf("GetNode failed: %v", err)
+		}
+		stored, _ := repo.GetNode("A")
+		if heal {
+			// the cumulative weight needs the grandchild C, which the check alone never loads
+			if node.Weight != 1 || node.CumulativeWeight != 2 || stored.Weight != 1 || stored.CumulativeWeight != 2 {
+				t.Fatalf("expected A healed to weight 1/2, got served %d/%d stored %d/%d",
+					node.Weight, node.CumulativeWeight, stored.Weight, stored.CumulativeWeight)
+			}
+		} else if node.Weight != 0 || stored.Weight != 0 {
+			t.Fatalf("expected reads to leave drift alone when disabled, got served %d stored %d", node.Weight, stored.Weight)
+		}
+	}
+}
+
+func TestTimestamps_AreUTCBased(t *testing.T) {
+	// a host in a far-off zone must still stamp epoch milliseconds
+	local := time.Local
+	time.Local = time.FixedZone("UTC+13", 13*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+	before := time.Now().UTC().UnixMilli()
+	node := &models.Node{ID: "A"}
+	if err := d.AddNode(node); err != nil {
+		t.Fatalf("failed to add node: %v", err)
+	}
+	after := time.Now().UTC().UnixMilli()
+	if node.CreatedAt < before || node.CreatedAt > after {
+		t.Fatalf("expected created_at between %d and %d, got %d", before, after, node.CreatedAt)
+	}
+
+	if got := models.FormatTimestamp(0); got != "1970-01-01T00:00:00.000Z" {
+		t.Fatalf("expected the epoch rendered in UTC, got %s", got)
+	}
+	if got := models.FormatTimestamp(node.CreatedAt); !strings.HasSuffix(got, "Z") {
+		t.Fatalf("expected a UTC timestamp, got %s", got)
+	}
+}
+
+func TestManualClock_DrivesTimestamps(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	clock := dag.NewManualClock(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	cfg.Clock = clock
+	d, _ := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	clock.Advance(1500 * time.Millisecond)
+	if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve B: %v", err)
+	}
+	cp, _, err := d.CreateCheckpoint("cp1")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli()
+	a, _ := d.GetNode("A")
+	b, _ := d.GetNode("B")
+	if a.CreatedAt != start || b.CreatedAt != start+1500 || cp.Timestamp != start+1500 {
+		t.Fatalf("expected timestamps from the manual clock, got A=%d B=%d checkpoint=%d", a.CreatedAt, b.CreatedAt, cp.Timestamp)
+	}
+}
+
+func TestTopologicalSort(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	clock := dag.NewManualClock(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	cfg.Clock = clock
+	d, repo := newTestDAG(t, cfg)
+
+	// two genesis nodes; C is created before B, E waits for both branches
+	for _, n := range []*models.Node{
+		{ID: "Z"},
+		{ID: "A"},
+		{ID: "C", Parents: []string{"Z"}},
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"B"}},
+		{ID: "E", Parents: []string{"C", "D"}},
+	} {
+		var err error
+		if len(n.Parents) == 0 {
+			err = d.AddNode(n)
+		} else {
+			err = d.ApproveNode(n)
+		}
+		if err != nil {
+			t.Fatalf("failed to store %s: %v", n.ID, err)
+		}
+		clock.Advance(time.Second)
+	}
+
+	nodes, err := d.TopologicalSort()
+	if err != nil {
+		t.Fatalf("TopologicalSort failed: %v", err)
+	}
+	var order []string
+	for _, n := range nodes {
+		order = append(order, n.ID)
+	}
+	if strings.Join(order, ",") != "Z,A,C,B,D,E" {
+		t.Fatalf("expected levels ordered by created_at, got %v", order)
+	}
+
+	// corrupted edges behind the DAG's back, picked up when the DAG is reopened
+	repo.PutNode(&models.Node{ID: "X", Parents: []string{"Y"}})
+	repo.PutNode(&models.Node{ID: "Y", Parents: []string{"X"}})
+	d = dag.NewDAGWithConfig(repo, dag.DefaultConfig())
+	if _, err := d.TopologicalSort(); !errors.Is(err, dag.ErrCycleDetected) {
+		t.Fatalf("expected ErrCycleDetected, got %v", err)
+	}
+	if _, err := d.LongestChain(); !errors.Is(err, dag.ErrCycleDetected) {
+		t.Fatalf("expected LongestChain to report the cycle, got %v", err)
+	}
+
+	// a graph that is nothing but a cycle has no genesis to start from
+	cyclic, cyclicRepo := newTestDAG(t, dag.DefaultConfig())
+	cyclicRepo.PutNode(&models.Node{ID: "X", Parents: []string{"Y"}})
+	cyclicRepo.PutNode(&models.Node{ID: "Y", Parents: []string{"X"}})
+	if _, err := cyclic.LongestChain(); !errors.Is(err, dag.ErrCycleDetected) {
+		t.Fatalf("expected ErrCycleDetected without a genesis, got %v", err)
+	}
+}
+
+func TestGetAncestorsAndDescendants(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+	buildDiamond(t, d)
+
+	ids := func(nodes []*models.Node) string {
+		var out []string
+		for _, n := range nodes {
+			out = append(out, n.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	// A <- B, C <- D <- E: D is reached along two paths but listed once
+	ancestors, err := d.GetAncestors("E")
+	if err != nil || ids(ancestors) != "D,B,C,A" {
+		t.Fatalf("expected ancestors D,B,C,A, got %s (%v)", ids(ancestors), err)
+	}
+	descendants, err := d.GetDescendants("A")
+	if err != nil || ids(descendants) != "B,C,D,E" {
+		t.Fatalf("expected descendants B,C,D,E, got %s (%v)", ids(descendants), err)
+	}
+	if ancestors, _ := d.GetAncestors("A"); len(ancestors) != 0 {
+		t.Fatalf("expected a genesis node to have no ancestors, got %s", ids(ancestors))
+	}
+	if _, err := d.GetDescendants("missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+
+	// corrupted cyclic edges must not loop
+	repo.PutNode(&models.Node{ID: "X", Parents: []string{"Y"}})
+	repo.PutNode(&models.Node{ID: "Y", Parents: []string{"X"}})
+	d = dag.NewDAGWithConfig(repo, dag.DefaultConfig())
+	if ancestors, err := d.GetAncestors("X"); err != nil || ids(ancestors) != "Y" {
+		t.Fatalf("expected the cycle to yield Y once, got %s (%v)", ids(ancestors), err)
+	}
+}
+
+func TestFindPath(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+	buildDiamond(t, d)
+
+	// A <- B, C <- D <- E: both branches are equally short, B wins by ID
+	path, err := d.FindPath("A", "E")
+	if err != nil || strings.Join(path, ",") != "A,B,D,E" {
+		t.Fatalf("expected path A,B,D,E, got %v (%v)", path, err)
+	}
+	if path, err := d.FindPath("C", "D"); err != nil || strings.Join(path, ",") != "C,D" {
+		t.Fatalf("expected path C,D, got %v (%v)", path, err)
+	}
+	for _, tc := range [][2]string{{"E", "A"}, {"B", "C"}, {"A", "A"}} {
+		if _, err := d.FindPath(tc[0], tc[1]); !errors.Is(err, dag.ErrNoPath) {
+			t.Fatalf("expected ErrNoPath from %s to %s, got %v", tc[0], tc[1], err)
+		}
+	}
+	if _, err := d.FindPath("A", "missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestNodeIDValidation(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.MaxIDLength = 8
+	d, _ := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	if _, _, err := d.CreateCheckpoint("cp1"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	for _, id := range []string{"", "checkpoint:x", "123456789"} {
+		if err := d.AddNode(&models.Node{ID: id}); !errors.Is(err, dag.ErrInvalidID) {
+			t.Fatalf("expected ErrInvalidID adding %q, got %v", id, err)
+		}
+		if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); !errors.Is(err, dag.ErrInvalidID) {
+			t.Fatalf("expected ErrInvalidID approving %q, got %v", id, err)
+		}
+	}
+
+	// nothing landed in the checkpoint namespace
+	if cp, err := d.GetLatestCheckpoint(); err != nil || cp.ID != "cp1" {
+		t.Fatalf("expected cp1 to stay the latest checkpoint, got %+v (%v)", cp, err)
+	}
+	if nodes, _ := d.GetAllNodes(); len(nodes) != 1 {
+		t.Fatalf("expected only A to be stored, got %d nodes", len(nodes))
+	}
+}
+
+func TestComputeMerkleRoot(t *testing.T) {
+	leaf := func(id string, weight int) []byte {
+		content := fmt.Sprintf(`{"id":%q,"parents":[],"weight":%d,"cumulative_weight":%d,"deleted":false,"created_by":""}`, id, weight, weight)
+		sum := sha256.Sum256(append([]byte{0x00}, content...))
+		return sum[:]
+	}
+	inner := func(left, right []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{0x01}, left...), right...))
+		return sum[:]
+	}
+
+	a := &models.Node{ID: "a", Weight: 1, CumulativeWeight: 1, CreatedAt: 5}
+	b := &models.Node{ID: "b", Parents: nil}
+	c := &models.Node{ID: "c", Weight: 2, CumulativeWeight: 2, Annotations: map[string]string{"note": "x"}}
+
+	// the odd leaf c moves up unchanged
+	want := fmt.Sprintf("%x", inner(inner(leaf("a", 1), leaf("b", 0)), leaf("c", 2)))
+	if got := dag.ComputeMerkleRoot([]*models.Node{c, a, b}); got != want {
+		t.Fatalf("expected root %s, got %s", want, got)
+	}
+	if empty := fmt.Sprintf("%x", sha256.Sum256(nil)); dag.ComputeMerkleRoot(nil) != empty {
+		t.Fatalf("expected the empty root to hash no data, got %s", dag.ComputeMerkleRoot(nil))
+	}
+
+	b.Weight = 1
+	if dag.ComputeMerkleRoot([]*models.Node{a, b, c}) == want {
+		t.Fatal("expected a weight change to change the root")
+	}
+}
+
+func TestMerkleProof_ReplaysToRoot(t *testing.T) {
+	replay := func(p *models.MerkleProof) string {
+		hash, _ := hex.DecodeString(p.Leaf)
+		index, width, next := p.Index, p.LeafCount, 0
+		for width > 1 {
+			switch {
+			case index%2 == 1:
+				sibling, _ := hex.DecodeString(p.Proof[next])
+				sum := sha256.Sum256(append(append([]byte{0x01}, sibling...), hash...))
+				hash, next = sum[:], next+1
+			case index < width-1:
+				sibling, _ := hex.DecodeString(p.Proof[next])
+				sum := sha256.Sum256(append(append([]byte{0x01}, hash...), sibling...))
+				hash, next = sum[:], next+1
+			}
+			index, width = index/2, (width+1)/2
+		}
+		if next != len(p.Proof) {
+			return "unused proof hashes"
+		}
+		return hex.EncodeToString(hash)
+	}
+
+	for size := 1; size <= 9; size++ {
+		d, _ := newTestDAG(t, dag.DefaultConfig())
+		if err := d.AddNode(&models.Node{ID: "n0"}); err != nil {
+			t.Fatalf("failed to add n0: %v", err)
+		}
+		for i := 1; i < size; i++ {
+			if err := d.ApproveNode(&models.Node{ID: fmt.Sprintf("n%d", i), Parents: []string{fmt.Sprintf("n%d", i-1)}}); err != nil {
+				t.Fatalf("failed to approve n%d: %v", i, err)
+			}
+		}
+		nodes, _ := d.GetAllNodes()
+		root := dag.ComputeMerkleRoot(nodes)
+
+		for _, n := range nodes {
+			proof, err := d.MerkleInclusionProof(n.ID)
+			if err != nil {
+				t.Fatalf("size %d: failed to prove %s: %v", size, n.ID, err)
+			}
+			siblings, err := d.MerkleProof(n.ID)
+			if err != nil || !slices.Equal(siblings, proof.Proof) {
+				t.Fatalf("size %d: expected MerkleProof of %s to return %v, got %v (%v)", size, n.ID, proof.Proof, siblings, err)
+			}
+			if proof.Root != root {
+				t.Fatalf("size %d: expected root %s, got %s", size, root, proof.Root)
+			}
+			if got := replay(proof); got != root {
+				t.Fatalf("size %d: proof of %s replays to %s, want %s", size, n.ID, got, root)
+			}
+		}
+	}
+
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+	if _, err := d.MerkleProof("missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+	if _, err := d.MerkleInclusionProof("missing"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	cp, _, err := d.CreateCheckpoint("cp1")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	if cp.RootFormat != dag.RootFormatMerkle {
+		t.Fatalf("expected a merkle root, got format %q", cp.RootFormat)
+	}
+	if valid, err := d.VerifyCheckpoint(cp); err != nil || !valid {
+		t.Fatalf("expected cp1 to verify, got %t (%v)", valid, err)
+	}
+
+	// a checkpoint from before Merkle roots is verified with the concatenated IDs
+	legacy := &models.Checkpoint{ID: "old", RootHash: fmt.Sprintf("%x", sha256.Sum256([]byte("A"))), HashAlgo: dag.HashSHA256, NodeCount: 1}
+	if err := repo.PutCheckpoint(legacy); err != nil {
+		t.Fatalf("failed to store checkpoint: %v", err)
+	}
+	if valid, err := d.VerifyCheckpoint(legacy); err != nil || !valid {
+		t.Fatalf("expected the legacy checkpoint to verify, got %t (%v)", valid, err)
+	}
+
+	// the approval adds B and changes A's weight
+	if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve B: %v", err)
+	}
+	if valid, err := d.VerifyCheckpoint(cp); err != nil || valid {
+		t.Fatalf("expected cp1 to stop matching, got %t (%v)", valid, err)
+	}
+	if _, err := d.GetCheckpoint("missing"); !errors.Is(err, dag.ErrCheckpointNotFound) {
+		t.Fatalf("expected ErrCheckpointNotFound, got %v", err)
+	}
+}
+
+func TestRestoreFromCheckpoint(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	clock := dag.NewManualClock(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	cfg.Clock = clock
+	// the diamond's cumulative weights are A=5, B=2, C=2, D=1, E=0
+	cfg.ImmutableWeight = 2
+	d, repo := newTestDAG(t, cfg)
+
+	if err := d.RestoreFromCheckpoint(); err != nil {
+		t.Fatalf("expected no checkpoint to verify cleanly, got %v", err)
+	}
+
+	buildDiamond(t, d)
+	if _, _, err := d.CreateCheckpoint("cp1"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	// normal work after the checkpoint doesn't count as divergence: D is edited
+	// while still mutable and only freezes under F's approval afterwards
+	node, err := d.GetNode("D")
+	if err != nil {
+		t.Fatalf("failed to get D: %v", err)
+	}
+	node.Data = json.RawMessage(`{"note":"edited"}`)
+	if err := d.UpdateNode(node); err != nil {
+		t.Fatalf("failed to update D: %v", err)
+	}
+	for _, n := range []*models.Node{{ID: "F", Parents: []string{"E"}}, {ID: "G", Parents: []string{"F"}}} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+	if err := d.DeleteNode("G"); err != nil {
+		t.Fatalf("failed to delete G: %v", err)
+	}
+	if _, err := d.ArchiveNode("F"); err != nil {
+		t.Fatalf("failed to archive F: %v", err)
+	}
+	if _, err := d.Reparent("E", []string{"C"}); err != nil {
+		t.Fatalf("failed to reparent E: %v", err)
+	}
+	if err := d.RestoreFromCheckpoint(); err != nil {
+		t.Fatalf("expected cp1 to verify after normal mutations, got %v", err)
+	}
+
+	// a node frozen at the checkpoint changed behind the DAG's back
+	a, err := repo.GetNode("A")
+	if err != nil {
+		t.Fatalf("failed to get A: %v", err)
+	}
+	tampered := *a
+	tampered.Data = json.RawMessage(`{"forged":true}`)
+	repo.PutNode(&tampered)
+	if err := d.RestoreFromCheckpoint(); !errors.Is(err, dag.ErrCheckpointMismatch) {
+		t.Fatalf("expected a changed frozen node to be a mismatch, got %v", err)
+	}
+	repo.PutNode(a)
+
+	// a node vanished while another still approves it
+	b, err := repo.GetNode("B")
+	if err != nil {
+		t.Fatalf("failed to get B: %v", err)
+	}
+	repo.DeleteNode("B")
+	if err := d.RestoreFromCheckpoint(); !errors.Is(err, dag.ErrCheckpointMismatch) {
+		t.Fatalf("expected a missing approved node to be a mismatch, got %v", err)
+	}
+	repo.PutNode(b)
+
+	// a checkpoint without digests can't tell those apart once the graph changed
+	clock.Advance(time.Second)
+	if err := repo.PutCheckpoint(&models.Checkpoint{ID: "legacy", Timestamp: clock.Now().UnixMilli(), RootHash: "0", NodeCount: 2}); err != nil {
+		t.Fatalf("failed to store checkpoint: %v", err)
+	}
+	if err := d.RestoreFromCheckpoint(); err != nil {
+		t.Fatalf("expected an unverifiable checkpoint to be skipped, got %v", err)
+	}
+	if cp, err := d.GetLatestCheckpoint(); err != nil || cp.ID != "legacy" {
+		t.Fatalf("expected the legacy checkpoint to be the latest, got %+v (%v)", cp, err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	empty, err := d.Summary()
+	if err != nil || empty.NodeCount != 0 || empty.MaxDepth != 0 || empty.HighestCumulativeWeightID != "" {
+		t.Fatalf("expected an empty summary, got %+v (err %v)", empty, err)
+	}
+
+	// A <- B, A <- C, D(B, C), E(D), plus a detached genesis F
+	buildDiamond(t, d)
+	if err := d.AddNode(&models.Node{ID: "F"}); err != nil {
+		t.Fatalf("failed to add F: %v", err)
+	}
+	if _, _, err := d.CreateCheckpoint("cp1"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	summary, err := d.Summary()
+	if err != nil {
+		t.Fatalf("failed to summarize: %v", err)
+	}
+	want := models.GraphSummary{
+		NodeCount:                 6,
+		TipCount:                  2,
+		MaxDepth:                  3,
+		AverageWeight:             5.0 / 6,
+		HighestCumulativeWeightID: "A",
+		LatestCheckpointID:        "cp1",
+	}
+	if *summary != want {
+		t.Fatalf("expected %+v, got %+v", want, *summary)
+	}
+}
+
+func TestApproveNode_DuplicateParents(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "P1"}); err != nil {
+		t.Fatalf("failed to add P1: %v", err)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "N", Parents: []string{"P1", "P1"}}); err != nil {
+		t.Fatalf("failed to approve N: %v", err)
+	}
+
+	parent, _ := d.GetNode("P1")
+	if parent.Weight != 1 || parent.CumulativeWeight != 1 {
+		t.Fatalf("expected P1 weight 1 and cumulative 1, got %d and %d", parent.Weight, parent.CumulativeWeight)
+	}
+	node, _ := d.GetNode("N")
+	if len(node.Parents) != 1 || node.Parents[0] != "P1" {
+		t.Fatalf("expected N to store one parent, got %v", node.Parents)
+	}
+}
+
+func TestApproveNode_MaxParents(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.MaxParents = 3
+	d, _ := newTestDAG(t, cfg)
+
+	parents := []string{"A", "B", "C", "D"}
+	for _, id := range parents {
+		if err := d.AddNode(&models.Node{ID: id}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	err := d.ApproveNode(&models.Node{ID: "N", Parents: parents})
+	if !errors.Is(err, dag.ErrInvalidParents) || !strings.Contains(err.Error(), "too many parents (max 3)") {
+		t.Fatalf("expected too many parents, got %v", err)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "N", Parents: parents[:3]}); err != nil {
+		t.Fatalf("expected 3 parents to be accepted, got %v", err)
+	}
+}
+
+func TestConfirmationReport(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	clock := dag.NewManualClock(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC))
+	cfg.Clock = clock
+	d, _ := newTestDAG(t, cfg)
+
+	// A <- B <- C, and D on A much later; C and D are unconfirmed tips
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"B"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+	clock.Advance(2 * time.Hour)
+	if err := d.ApproveNode(&models.Node{ID: "D", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve D: %v", err)
+	}
+	clock.Advance(30 * time.Second)
+
+	if _, err := d.ConfirmationReport(0); !errors.Is(err, dag.ErrNoThreshold) {
+		t.Fatalf("expected ErrNoThreshold, got %v", err)
+	}
+	report, err := d.ConfirmationReport(1)
+	if err != nil {
+		t.Fatalf("ConfirmationReport failed: %v", err)
+	}
+	// cumulative weights: A 3, B 1, C 0, D 0
+	if report.NodeCount != 4 || report.ConfirmedCount != 2 || report.ConfirmationRate != 0.5 || report.AverageCumulativeWeight != 1 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	if report.UnconfirmedTips != 2 || report.TipAges["1m"] != 1 || report.TipAges["1d"] != 1 {
+		t.Fatalf("unexpected tip ages: %+v", report)
+	}
+	if want := (2*time.Hour + 30*time.Second).Milliseconds(); report.OldestUnconfirmedTipAge != want {
+		t.Fatalf("expected oldest tip age %d, got %d", want, report.OldestUnconfirmedTipAge)
+	}
+}
+
+func TestApproveNode_MaxChildrenPerNode(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		cfg := dag.DefaultConfig()
+		cfg.MaxChildrenPerNode = 2
+		cfg.AsyncPropagation = async
+		d, _ := newTestDAG(t, cfg)
+		defer d.Close()
+
+		if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+			t.Fatalf("failed to add A: %v", err)
+		}
+		for _, id := range []string{"B", "C"} {
+			if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); err != nil {
+				t.Fatalf("async=%v: failed to approve %s: %v", async, id, err)
+			}
+		}
+
+		err := d.ApproveNode(&models.Node{ID: "D", Parents: []string{"B", "A"}})
+		if !errors.Is(err, dag.ErrInvalidParents) {
+			t.Fatalf("async=%v: expected ErrInvalidParents for a third child of A, got %v", async, err)
+		}
+		if err := d.ApproveNode(&models.Node{ID: "D", Parents: []string{"B", "C"}}); err != nil {
+			t.Fatalf("async=%v: expected approval spread over B and C to pass, got %v", async, err)
+		}
+	}
+}
+
+func TestApproveNode_TipsOnly(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.ApproveTipsOnly = true
+	d, _ := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("expected approving tip A to pass, got %v", err)
+	}
+
+	// A now has a child, so it is interior
+	err := d.ApproveNode(&models.Node{ID: "C", Parents: []string{"B", "A"}})
+	if !errors.Is(err, dag.ErrInvalidParents) {
+		t.Fatalf("expected ErrInvalidParents for interior parent A, got %v", err)
+	}
+	if exists, _ := d.HasNode("C"); exists {
+		t.Fatal("rejected node must not be stored")
+	}
+	if err := d.ApproveNode(&models.Node{ID: "C", Parents: []string{"B"}}); err != nil {
+		t.Fatalf("expected approving tip B to pass, got %v", err)
+	}
+}
+
+func TestApproveNode_RequireGenesisReachable(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.RequireGenesisReachable = true
+	d, repo := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	// an orphan chain whose ancestor was never imported
+	repo.PutNode(&models.Node{ID: "X", Parents: []string{"ghost"}})
+	repo.PutNode(&models.Node{ID: "Y", Parents: []string{"X"}})
+
+	err := d.ApproveNode(&models.Node{ID: "Z", Parents: []string{"Y"}})
+	if !errors.Is(err, dag.ErrDisconnectedNode) {
+		t.Fatalf("expected ErrDisconnectedNode for an orphan parent, got %v", err)
+	}
+	if exists, _ := d.HasNode("Z"); exists {
+		t.Fatal("rejected node must not be stored")
+	}
+
+	// one connected parent is enough
+	if err := d.ApproveNode(&models.Node{ID: "Z", Parents: []string{"Y", "A"}}); err != nil {
+		t.Fatalf("expected approval with a connected parent to pass, got %v", err)
+	}
+}
+
+func TestParkOrphans(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.ParkOrphans = true
+	cfg.MaxParkedOrphans = 2
+	d, repo := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	// C arrives before its parent B, and D before C
+	for _, n := range []*models.Node{
+		{ID: "D", Parents: []string{"C"}},
+		{ID: "C", Parents: []string{"B", "A"}},
+	} {
+		if err := d.ApproveNode(n); !errors.Is(err, dag.ErrNodeParked) {
+			t.Fatalf("expected %s to be parked, got %v", n.ID, err)
+		}
+	}
+	if err := d.ApproveNode(&models.Node{ID: "E", Parents: []string{"X"}}); !errors.Is(err, dag.ErrInvalidParents) {
+		t.Fatalf("expected a full pending area to reject, got %v", err)
+	}
+	pending, err := d.PendingNodes()
+	if err != nil || len(pending) != 2 || pending[0].Node.ID != "C" || len(pending[0].Missing) != 1 || pending[0].Missing[0] != "B" {
+		t.Fatalf("unexpected pending nodes %+v (err %v)", pending, err)
+	}
+
+	// B's arrival releases C, which releases D
+	if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve B: %v", err)
+	}
+	for _, id := range []string{"C", "D"} {
+		if ok, _ := repo.HasNode(id); !ok {
+			t.Fatalf("expected parked node %s to be approved", id)
+		}
+	}
+	if pending, _ := d.PendingNodes(); len(pending) != 0 {
+		t.Fatalf("expected the pending area to drain, got %+v", pending)
+	}
+	a, _ := repo.GetNode("A")
+	if a.Weight != 2 || a.CumulativeWeight != 4 {
+		t.Fatalf("expected A weight 2 and cumulative 4, got %d/%d", a.Weight, a.CumulativeWeight)
+	}
+}
+
+func TestParkOrphans_SurviveRestart(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.ParkOrphans = true
+	d, repo := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "C", Parents: []string{"B"}},
+		{ID: "D", Parents: []string{"A", "Y"}},
+	} {
+		if err := d.ApproveNode(n); !errors.Is(err, dag.ErrNodeParked) {
+			t.Fatalf("expected %s to be parked, got %v", n.ID, err)
+		}
+	}
+	// B arrives behind the pending area's back, as if the process died before
+	// releasing C; D is still waiting for Y
+	if err := repo.PutNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to store B: %v", err)
+	}
+
+	restarted := dag.NewDAGWithConfig(repo, cfg)
+	if ok, _ := repo.HasNode("C"); !ok {
+		t.Fatal("expected C to be approved on reload now that B exists")
+	}
+	pending, err := restarted.PendingNodes()
+	if err != nil || len(pending) != 1 || pending[0].Node.ID != "D" || pending[0].Missing[0] != "Y" {
+		t.Fatalf("expected D to survive the restart, got %+v (err %v)", pending, err)
+	}
+
+	if err := restarted.AddNode(&models.Node{ID: "Y"}); err != nil {
+		t.Fatalf("failed to add Y: %v", err)
+	}
+	if ok, _ := repo.HasNode("D"); !ok {
+		t.Fatal("expected D to be approved once Y arrived")
+	}
+	if stored, _ := repo.GetAllParked(); len(stored) != 0 {
+		t.Fatalf("expected released records to be removed, got %d", len(stored))
+	}
+}
+
+func TestTipSelection_SampleSize(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.TipSampleSize = 1
+	d, _ := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	tips := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("T%d", i)
+		if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); err != nil {
+			t.Fatalf("failed to approve %s: %v", id, err)
+		}
+		tips[id] = true
+	}
+
+	// every walk draws a fresh one-tip sample, so all tips keep being reachable
+	seen := map[string]bool{}
+	selected, _, err := d.TipSelectionBulk(200, dag.DefaultTipSelectionParams())
+	if err != nil {
+		t.Fatalf("tip selection failed: %v", err)
+	}
+	for _, tip := range selected {
+		if !tips[tip.ID] {
+			t.Fatalf("selected non-tip %s", tip.ID)
+		}
+		seen[tip.ID] = true
+	}
+	if len(seen) != len(tips) {
+		t.Fatalf("expected every tip to be sampled at least once in 200 walks, saw %v", seen)
+	}
+}
+
+// benchmarkWideFrontier selects tips over a genesis node approved by 50k tips
+func benchmarkWideFrontier(b *testing.B, sampleSize int) {
+	cfg := dag.DefaultConfig()
+	cfg.TipSampleSize = sampleSize
+	d, repo := newTestDAG(b, cfg)
+
+	const tips = 50000
+	repo.PutNode(&models.Node{ID: "genesis", Weight: tips, CumulativeWeight: tips})
+	for i := 0; i < tips; i++ {
+		repo.PutNode(&models.Node{ID: fmt.Sprintf("tip-%05d", i), Parents: []string{"genesis"}})
+	}
+
+	params := dag.DefaultTipSelectionParams()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.TipSelectionWithParams(params); err != nil {
+			b.Fatalf("tip selection failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkTipSelection_50kTips_AllTips(b *testing.B)    { benchmarkWideFrontier(b, 0) }
+func BenchmarkTipSelection_50kTips_Sample1000(b *testing.B) { benchmarkWideFrontier(b, 1000) }
+
+func TestAdjacencyIndex_FollowsEdgeChanges(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	for _, id := range []string{"A", "B"} {
+		if err := d.AddNode(&models.Node{ID: id}); err != nil {
+			t.Fatalf("failed to add %s: %v", id, err)
+		}
+	}
+	if err := d.ApproveNode(&models.Node{ID: "C", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve C: %v", err)
+	}
+	if _, err := d.Reparent("C", []string{"B"}); err != nil {
+		t.Fatalf("failed to reparent C: %v", err)
+	}
+
+	// the cached edges must follow the reparent: A lost its child, B gained it
+	if err := d.DeleteNode("B"); !errors.Is(err, dag.ErrNodeHasDependents) {
+		t.Fatalf("expected B to have a dependent, got %v", err)
+	}
+	if err := d.DeleteNode("A"); err != nil {
+		t.Fatalf("expected A to be deletable after the reparent, got %v", err)
+	}
+	if err := d.DeleteNode("C"); err != nil {
+		t.Fatalf("failed to delete C: %v", err)
+	}
+	if err := d.DeleteNode("B"); err != nil {
+		t.Fatalf("expected B to be deletable once C is gone, got %v", err)
+	}
+}
+
+// newForest10k stores 100 genesis nodes with 99 children each, 10k nodes in total,
+// in one batch behind the DAG's back. Approvals touch one small tree each, so their
+// cost is dominated by how the edges are looked up.
+func newForest10k(b *testing.B) *dag.DAG {
+	d, repo := newTestDAG(b, dag.DefaultConfig())
+	nodes := make([]*models.Node, 0, 10000)
+	for r := 0; r < 100; r++ {
+		root := fmt.Sprintf("root-%03d", r)
+		nodes = append(nodes, &models.Node{ID: root, Weight: 99, CumulativeWeight: 99})
+		for c := 0; c < 99; c++ {
+			nodes = append(nodes, &models.Node{ID: fmt.Sprintf("%s-%02d", root, c), Parents: []string{root}})
+		}
+	}
+	if err := repo.PutNodes(nodes); err != nil {
+		b.Fatal(err)
+	}
+	// the first approval loads the adjacency index
+	if err := d.ApproveNode(&models.Node{ID: "warm-up", Parents: []string{"root-000"}}); err != nil {
+		b.Fatal(err)
+	}
+	return d
+}
+
+func BenchmarkApproveNode_10kNodes(b *testing.B) {
+	d := newForest10k(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parent := fmt.Sprintf("root-%03d-%02d", i%100, (i/100)%99)
+		if err := d.ApproveNode(&models.Node{ID: fmt.Sprintf("new-%d", i), Parents: []string{parent}}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkApproveNode_5kChain extends a 5000-node chain, so every approval
+// changes the cumulative weight of every node in it
+func BenchmarkApproveNode_5kChain(b *testing.B) {
+	d, repo := newTestDAG(b, dag.DefaultConfig())
+	const length = 5000
+	nodes := make([]*models.Node, 0, length)
+	for i := 0; i < length; i++ {
+		n := &models.Node{ID: fmt.Sprintf("chain-%05d", i), CumulativeWeight: int64(length - 1 - i)}
+		if i > 0 {
+			n.Parents = []string{nodes[i-1].ID}
+		}
+		if i < length-1 {
+			n.Weight = 1
+		}
+		nodes = append(nodes, n)
+	}
+	if err := repo.PutNodes(nodes); err != nil {
+		b.Fatal(err)
+	}
+
+	tip := nodes[length-1].ID
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		next := fmt.Sprintf("ext-%05d", i)
+		if err := d.ApproveNode(&models.Node{ID: next, Parents: []string{tip}}); err != nil {
+			b.Fatal(err)
+		}
+		tip = next
+	}
+}
+
+// BenchmarkApproveNode_2kTangle extends a 2000-node Tangle-shaped graph in which
+// every node approves the two before it, so in unique mode every approval recounts
+// the distinct descendants of every node, each reachable along many paths
+func BenchmarkApproveNode_2kTangle(b *testing.B) {
+	d, repo := newTestDAG(b, dag.DefaultConfig())
+	const size = 2000
+	nodes := make([]*models.Node, size)
+	for i := range nodes {
+		n := &models.Node{ID: fmt.Sprintf("tangle-%05d", i)}
+		switch {
+		case i >= 2:
+			n.Parents = []string{nodes[i-1].ID, nodes[i-2].ID}
+		case i == 1:
+			n.Parents = []string{nodes[0].ID}
+		}
+		switch {
+		case i < size-2:
+			n.Weight = 2
+		case i == size-2:
+			n.Weight = 1
+		}
+		nodes[i] = n
+	}
+	// every later node is a descendant, so the unique cumulative weight is a suffix sum
+	var suffix int64
+	for i := size - 1; i >= 0; i-- {
+		suffix += int64(nodes[i].Weight)
+		nodes[i].CumulativeWeight = suffix
+	}
+	if err := repo.PutNodes(nodes); err != nil {
+		b.Fatal(err)
+	}
+
+	tip, prev := nodes[size-1].ID, nodes[size-2].ID
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		next := fmt.Sprintf("ext-%05d", i)
+		if err := d.ApproveNode(&models.Node{ID: next, Parents: []string{tip, prev}}); err != nil {
+			b.Fatal(err)
+		}
+		tip, prev = next, tip
+	}
+}
+
+func BenchmarkTipSelection_10kNodes(b *testing.B) {
+	d := newForest10k(b)
+	params := dag.DefaultTipSelectionParams()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.TipSelectionWithParams(params); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTipSelection_MinWeight(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, id := range []string{"B", "C"} {
+		if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); err != nil {
+			t.Fatalf("failed to approve %s: %v", id, err)
+		}
+	}
+	// give C stored weight, as a preserved-weight restore could
+	c, _ := repo.GetNode("C")
+	c.CumulativeWeight = 5
+	repo.PutNode(c)
+
+	params := dag.TipSelectionParams{Alpha: 0.01, MaxSteps: 50, MinWeight: 3}
+	for i := 0; i < 10; i++ {
+		tip, err := d.TipSelectionWithParams(params)
+		if err != nil {
+			t.Fatalf("tip selection failed: %v", err)
+		}
+		if tip.ID != "C" {
+			t.Fatalf("expected only C to qualify, got %s", tip.ID)
+		}
+	}
+
+	params.MinWeight = 6
+	if _, err := d.TipSelectionWithParams(params); !errors.Is(err, dag.ErrNoQualifyingTips) {
+		t.Fatalf("expected ErrNoQualifyingTips, got %v", err)
+	}
+}
+
+func TestCreatedBy_ValidatedAndInRootHash(t *testing.T) {
+	rootWith := func(author string) string {
+		d, _ := newTestDAG(t, dag.DefaultConfig())
+		if err := d.AddNode(&models.Node{ID: "A", CreatedBy: "alice"}); err != nil {
+			t.Fatalf("failed to add A: %v", err)
+		}
+		if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}, CreatedBy: author}); err != nil {
+			t.Fatalf("failed to approve B: %v", err)
+		}
+		b, err := d.GetNode("B")
+		if err != nil || b.CreatedBy != author {
+			t.Fatalf("expected B created by %q, got %+v (%v)", author, b, err)
+		}
+		cp, _, err := d.CreateCheckpoint("")
+		if err != nil {
+			t.Fatalf("failed to create checkpoint: %v", err)
+		}
+		return cp.RootHash
+	}
+
+	unattributed, bob, mallory := rootWith(""), rootWith("bob"), rootWith("mallory")
+	if unattributed == bob || bob == mallory {
+		t.Fatalf("expected created_by to change the root hash, got %s, %s, %s", unattributed, bob, mallory)
+	}
+	if again := rootWith("bob"); again != bob {
+		t.Fatalf("expected the same attribution to give the same root, got %s and %s", bob, again)
+	}
+
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+	for _, author := range []string{strings.Repeat("a", 129), "bob\n"} {
+		if err := d.AddNode(&models.Node{ID: "X", CreatedBy: author}); !errors.Is(err, dag.ErrInvalidAuthor) {
+			t.Fatalf("expected ErrInvalidAuthor for %q, got %v", author, err)
+		}
+	}
+	if err := d.AddNode(&models.Node{ID: "X", CreatedBy: strings.Repeat("a", 128)}); err != nil {
+		t.Fatalf("expected a 128 character author to be accepted, got %v", err)
+	}
+}
+
+func TestCheckpointDiff(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve B: %v", err)
+	}
+	if _, _, err := d.CreateCheckpoint("cp1"); err != nil {
+		t.Fatalf("failed to create cp1: %v", err)
+	}
+
+	// C is added and B archived; A's weight changes too but that is not a change
+	if err := d.ApproveNode(&models.Node{ID: "C", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve C: %v", err)
+	}
+	if _, err := d.ArchiveNode("B"); err != nil {
+		t.Fatalf("failed to archive B: %v", err)
+	}
+	if _, _, err := d.CreateCheckpoint("cp2"); err != nil {
+		t.Fatalf("failed to create cp2: %v", err)
+	}
+
+	diff, err := d.CheckpointDiff("cp1", "cp2")
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if !diff.Detailed || diff.NodeCountDelta != 1 || fmt.Sprint(diff.Added) != "[C]" ||
+		fmt.Sprint(diff.Changed) != "[B]" || len(diff.Removed) != 0 {
+		t.Fatalf("unexpected diff cp1..cp2: %+v", diff)
+	}
+
+	back, err := d.CheckpointDiff("cp2", "cp1")
+	if err != nil {
+		t.Fatalf("reverse diff failed: %v", err)
+	}
+	if back.NodeCountDelta != -1 || fmt.Sprint(back.Removed) != "[C]" || len(back.Added) != 0 {
+		t.Fatalf("unexpected diff cp2..cp1: %+v", back)
+	}
+
+	// a checkpoint stored without digests only yields the count delta
+	if err := repo.PutCheckpoint(&models.Checkpoint{ID: "old", NodeCount: 1, HashAlgo: dag.HashSHA256}); err != nil {
+		t.Fatalf("failed to store old checkpoint: %v", err)
+	}
+	partial, err := d.CheckpointDiff("old", "cp2")
+	if err != nil {
+		t.Fatalf("diff against old checkpoint failed: %v", err)
+	}
+	if partial.Detailed || partial.NodeCountDelta != 2 || partial.Added != nil {
+		t.Fatalf("expected a count-only diff, got %+v", partial)
+	}
+
+	if _, err := d.CheckpointDiff("cp1", "missing"); !errors.Is(err, dag.ErrCheckpointNotFound) {
+		t.Fatalf("expected ErrCheckpointNotFound, got %v", err)
+	}
+}
+
+func TestGetHighestCumulativeWeightNode_FastAndVerified(t *testing.T) {
+	d, repo := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, id := range []string{"B", "C"} {
+		if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); err != nil {
+			t.Fatalf("failed to approve %s: %v", id, err)
+		}
+	}
+
+	// inflate C's stored weights behind the DAG's back
+	c, _ := repo.GetNode("C")
+	c.Weight, c.CumulativeWeight = 40, 100
+	if err := repo.PutNode(c); err != nil {
+		t.Fatalf("failed to store drifted C: %v", err)
+	}
+
+	fast, err := d.GetHighestCumulativeWeightNode()
+	if err != nil || fast.ID != "C" {
+		t.Fatalf("expected the fast path to trust the stored weight of C, got %+v (%v)", fast, err)
+	}
+
+	verified, err := d.GetHighestCumulativeWeightNodeVerified()
+	if err != nil {
+		t.Fatalf("verified path failed: %v", err)
+	}
+	if verified.ID != "A" || verified.Weight != 2 || verified.CumulativeWeight != 2 {
+		t.Fatalf("expected A with recomputed weights 2/2, got %+v", verified)
+	}
+	if stored, _ := repo.GetNode("C"); stored.CumulativeWeight != 100 {
+		t.Fatalf("expected the verified path not to repair C, got %d", stored.CumulativeWeight)
+	}
+}
+
+func TestAnnotateNode_LeavesRootHashAlone(t *testing.T) {
+	cfg := dag.DefaultConfig()
+	cfg.ImmutableWeight = 1
+	d, _ := newTestDAG(t, cfg)
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	if err := d.ApproveNode(&models.Node{ID: "B", Parents: []string{"A"}}); err != nil {
+		t.Fatalf("failed to approve B: %v", err)
+	}
+	before, _, err := d.CreateCheckpoint("before")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	// A reached the immutable weight, yet its annotations stay editable
+	flag, owner := "flagged for review", "ops"
+	node, err := d.AnnotateNode("A", map[string]*string{"status": &flag, "owner": &owner})
+	if err != nil {
+		t.Fatalf("failed to annotate A: %v", err)
+	}
+	if node.Annotations["status"] != flag || node.Annotations["owner"] != owner {
+		t.Fatalf("expected both annotations, got %v", node.Annotations)
+	}
+	if node, err = d.AnnotateNode("A", map[string]*string{"owner": nil}); err != nil {
+		t.Fatalf("failed to remove annotation: %v", err)
+	}
+	if _, ok := node.Annotations["owner"]; ok || len(node.Annotations) != 1 {
+		t.Fatalf("expected owner to be removed, got %v", node.Annotations)
+	}
+
+	after, _, err := d.CreateCheckpoint("after")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	if after.RootHash != before.RootHash {
+		t.Fatalf("expected annotations to leave the root hash alone, got %s and %s", before.RootHash, after.RootHash)
+	}
+	if diff, err := d.CheckpointDiff("before", "after"); err != nil || len(diff.Changed) != 0 {
+		t.Fatalf("expected no changed nodes, got %+v (%v)", diff, err)
+	}
+
+	tooLong := strings.Repeat("x", 1025)
+	if _, err := d.AnnotateNode("A", map[string]*string{"note": &tooLong}); !errors.Is(err, dag.ErrInvalidAnnotations) {
+		t.Fatalf("expected ErrInvalidAnnotations for a long value, got %v", err)
+	}
+	many := make(map[string]*string)
+	for i := 0; i < 33; i++ {
+		many[fmt.Sprintf("k%d", i)] = &flag
+	}
+	if _, err := d.AnnotateNode("A", many); !errors.Is(err, dag.ErrInvalidAnnotations) {
+		t.Fatalf("expected ErrInvalidAnnotations for too many keys, got %v", err)
+	}
+	if _, err := d.AnnotateNode("missing", map[string]*string{"status": &flag}); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestGetTips(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	tips, err := d.GetTips()
+	if err != nil || tips == nil || len(tips) != 0 {
+		t.Fatalf("expected an empty tip list on an empty DAG, got %v (%v)", tips, err)
+	}
+
+	// A <- B, A <- C, B <- D; archiving D makes B a tip again
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, n := range []*models.Node{
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "C", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"B"}},
+	} {
+		if err := d.ApproveNode(n); err != nil {
+			t.Fatalf("failed to approve %s: %v", n.ID, err)
+		}
+	}
+	if tips, _ = d.GetTips(); len(tips) != 2 || tips[0].ID != "C" || tips[1].ID != "D" {
+		t.Fatalf("expected tips C and D, got %v", tips)
+	}
+	if _, err := d.ArchiveNode("D"); err != nil {
+		t.Fatalf("failed to archive D: %v", err)
+	}
+	if tips, _ = d.GetTips(); len(tips) != 2 || tips[0].ID != "B" || tips[1].ID != "C" {
+		t.Fatalf("expected tips B and C after archiving D, got %v", tips)
+	}
+}
+
+// countingSource counts the seeds drawn from it
+type countingSource struct {
+	rand.Source
+	draws int
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.Source.Int63()
+}
+
+func TestTipSelectionN_DistinctTips(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, id := range []string{"B", "C"} {
+		if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); err != nil {
+			t.Fatalf("failed to approve %s: %v", id, err)
+		}
+	}
+
+	tips, err := d.TipSelectionN(0.01, 100, 2)
+	if err != nil {
+		t.Fatalf("selection failed: %v", err)
+	}
+	ids := []string{tips[0].ID, tips[1].ID}
+	sort.Strings(ids)
+	if len(tips) != 2 || ids[0] != "B" || ids[1] != "C" {
+		t.Fatalf("expected distinct tips B and C, got %v", ids)
+	}
+
+	// only two tips exist, so asking for three returns both; every attempt draws
+	// from the one generator seeded for the call
+	src := &countingSource{Source: rand.NewSource(1)}
+	d.SetRandSource(src)
+	if tips, err = d.TipSelectionN(0.01, 100, 3); err != nil || len(tips) != 2 {
+		t.Fatalf("expected the two available tips, got %v (%v)", tips, err)
+	}
+	if src.draws != 1 {
+		t.Fatalf("expected one seed drawn for the whole selection, got %d", src.draws)
+	}
+	if _, err := d.TipSelectionN(0.01, 100, 0); err == nil {
+		t.Fatal("expected a non-positive count to fail")
+	}
+}
+
+func TestDeleteNode(t *testing.T) {
+	d, _ := newTestDAG(t, dag.DefaultConfig())
+
+	// A <- B, A <- C
+	if err := d.AddNode(&models.Node{ID: "A"}); err != nil {
+		t.Fatalf("failed to add A: %v", err)
+	}
+	for _, id := range []string{"B", "C"} {
+		if err := d.ApproveNode(&models.Node{ID: id, Parents: []string{"A"}}); err != nil {
+			t.Fatalf("failed to approve %s: %v", id, err)
+		}
+	}
+
+	if err := d.DeleteNode("A"); !errors.Is(err, dag.ErrNodeHasDependents) {
+		t.Fatalf("expected ErrNodeHasDependents for A, got %v", err)
+	}
+	if err := d.DeleteNode("B"); err != nil {
+		t.Fatalf("failed to delete B: %v", err)
+	}
+	if _, err := d.GetNode("B"); err == nil {
+		t.Fatal("expected B to be gone")
+	}
+	a, _ := d.GetNode("A")
+	if a.Weight != 1 || a.CumulativeWeight != 1 {
+		t.Fatalf("expected A's weights to drop to 1/1, got %d/%d", a.Weight, a.CumulativeWeight)
+	}
+	if err := d.DeleteNode("B"); !errors.Is(err, dag.ErrNodeNotFound) {
+		t.Fatalf("expected ErrNodeNotFound for a deleted node, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package dag
+
+import (
+	"fmt"
+	"sort"
+
+	"dag-project/models"
+)
+
+// DeleteNode removes a node for good, e.g. one added by mistake. Only a node nobody
+// approves can go: a node listed as a parent by any other node, archived ones
+// included, fails with ErrNodeHasDependents, since removing it would leave dangling
+// parent references; archive it instead. The approval the node made disappears
+// with it, so its parents' direct weights and their ancestors' cumulative weights
+// are recomputed.
+func (d *DAG) DeleteNode(id string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	exists, err := d.repo.HasNode(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNodeNotFound
+	}
+	node, err := d.repo.GetNode(id)
+	if err != nil {
+		return err
+	}
+
+	index, err := d.indexLocked()
+	if err != nil {
+		return err
+	}
+	if dependents := index.children[id]; len(dependents) > 0 {
+		return fmt.Errorf("%w: approved by %d node(s)", ErrNodeHasDependents, len(dependents))
+	}
+
+	if err := d.repo.DeleteNode(id); err != nil {
+		return err
+	}
+	d.indexRemoveLocked(node)
+	d.invalidateCountersLocked()
+	return d.propagateWeights(node.Parents)
+}
+
+// DeleteNodes removes a set of nodes for good in one atomic write, e.g. an obsolete
+// subgraph. Nodes inside the set may approve each other; the set is rejected as a
+// whole with ErrNodeHasDependents if any node outside it lists one of its nodes as a
+// parent, and with ErrNodeNotFound if any ID isn't stored. The IDs are returned in
+// deletion order, children before parents, each level ordered by ID. Surviving
+// parents of deleted nodes and their ancestors have their weights recomputed.
+func (d *DAG) DeleteNodes(ids []string) ([]string, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodesByID := make(map[string]*models.Node, len(ids))
+	for _, id := range ids {
+		if _, dup := nodesByID[id]; dup {
+			continue
+		}
+		exists, err := d.repo.HasNode(id)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, id)
+		}
+		node, err := d.repo.GetNode(id)
+		if err != nil {
+			return nil, err
+		}
+		nodesByID[id] = node
+	}
+
+	index, err := d.indexLocked()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range sortedKeys(nodesByID) {
+		for _, childID := range index.children[id] {
+			if _, inSet := nodesByID[childID]; !inSet {
+				return nil, fmt.Errorf("%w: %s is approved by %s outside the batch", ErrNodeHasDependents, id, childID)
+			}
+		}
+	}
+
+	// ordered upwards: a node goes once its children in the set are gone
+	order, err := topoOrder(sortedKeys(nodesByID), index.parents, index.children, func(a, b string) bool { return a < b })
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.repo.DeleteNodes(order); err != nil {
+		return nil, err
+	}
+	survivors := make(map[string]bool)
+	for _, id := range order {
+		node := nodesByID[id]
+		d.indexRemoveLocked(node)
+		for _, pid := range node.Parents {
+			if _, inSet := nodesByID[pid]; !inSet {
+				survivors[pid] = true
+			}
+		}
+	}
+	d.invalidateCountersLocked()
+
+	parentIDs := make([]string, 0, len(survivors))
+	for pid := range survivors {
+		parentIDs = append(parentIDs, pid)
+	}
+	sort.Strings(parentIDs)
+	return order, d.propagateWeights(parentIDs)
+}
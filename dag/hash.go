@@ -0,0 +1,65 @@
+package dag
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// Supported checkpoint root-hash algorithms
+const (
+	HashSHA256    = "sha256"
+	HashBlake2b   = "blake2b"
+	HashKeccak256 = "keccak256"
+)
+
+// Hasher computes the digests used for checkpoint root hashes
+type Hasher interface {
+	// Name is the algorithm identifier stored alongside checkpoints
+	Name() string
+	// Sum returns the digest of data
+	Sum(data []byte) []byte
+}
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Name() string { return HashSHA256 }
+
+func (sha256Hasher) Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+type blake2bHasher struct{}
+
+func (blake2bHasher) Name() string { return HashBlake2b }
+
+func (blake2bHasher) Sum(data []byte) []byte {
+	sum := blake2b.Sum256(data)
+	return sum[:]
+}
+
+type keccak256Hasher struct{}
+
+func (keccak256Hasher) Name() string { return HashKeccak256 }
+
+func (keccak256Hasher) Sum(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NewHasher returns the Hasher for the named algorithm; an empty name selects SHA-256
+func NewHasher(name string) (Hasher, error) {
+	switch name {
+	case "", HashSHA256:
+		return sha256Hasher{}, nil
+	case HashBlake2b:
+		return blake2bHasher{}, nil
+	case HashKeccak256:
+		return keccak256Hasher{}, nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", name)
+}
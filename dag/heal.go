@@ -0,0 +1,103 @@
+package dag
+
+import (
+	"slices"
+
+	"dag-project/logger"
+	"dag-project/models"
+
+	"go.uber.org/zap"
+)
+
+// healOnReadLocked repairs drift on a node that is about to be returned to a reader.
+// Drift is detected cheaply by comparing the stored direct weight with the node's
+// live child count from the adjacency index, loading only its children; only on a
+// mismatch are its descendants loaded and the direct and cumulative weights
+// recomputed and persisted. node is updated in place. A failed write is logged and
+// the stale node is still served. The caller must hold d.mux.
+func (d *DAG) healOnReadLocked(node *models.Node) error {
+	index, err := d.indexLocked()
+	if err != nil {
+		return err
+	}
+	children := index.children
+	nodesByID := d.loadNodes(children[node.ID], nil)
+	weight := directWeight(children[node.ID], nodesByID)
+	if node.Weight == weight {
+		return nil
+	}
+
+	// the cumulative walk reads the stored weight of every descendant
+	visited := make(map[string]bool)
+	for pending := slices.Clone(children[node.ID]); len(pending) > 0; {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		d.loadNodes(children[id], nodesByID)
+		pending = append(pending, children[id]...)
+	}
+
+	staleWeight, staleCumulative := node.Weight, node.CumulativeWeight
+	node.Weight = weight
+	nodesByID[node.ID] = node
+	node.CumulativeWeight = d.calculateCumulativeWeight(node.ID, children, nodesByID)
+
+	if err := d.repo.PutNode(node); err != nil {
+		logger.Logger.Warn("Failed to persist self-healed node", zap.String("node_id", node.ID), zap.Error(err))
+		return nil
+	}
+	logger.Logger.Info("Self-healed node weights on read",
+		zap.String("node_id", node.ID),
+		zap.Int("stale_weight", staleWeight), zap.Int("weight", node.Weight),
+		zap.Int64("stale_cumulative_weight", staleCumulative), zap.Int64("cumulative_weight", node.CumulativeWeight))
+	return nil
+}
+
+// VerifyNode returns a node together with a check of its stored weights against
+// values recomputed from the live graph. The expected cumulative weight uses every
+// descendant's child count rather than its stored weight, so drift further down
+// doesn't hide in the expectation. Nothing is repaired.
+func (d *DAG) VerifyNode(id string) (*models.Node, *models.NodeConsistency, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := d.indexLocked()
+	if err != nil {
+		return nil, nil, err
+	}
+	children := index.children
+	nodesByID := make(map[string]*models.Node, len(nodes))
+	for _, n := range nodes {
+		nodesByID[n.ID] = n
+	}
+	expected := make(map[string]*models.Node, len(nodes))
+	var node *models.Node
+	for _, n := range nodes {
+		if n.ID == id {
+			node = n
+		}
+		fresh := *n
+		fresh.Weight = directWeight(children[n.ID], nodesByID)
+		expected[n.ID] = &fresh
+	}
+	if node == nil {
+		return nil, nil, ErrNodeNotFound
+	}
+
+	consistency := &models.NodeConsistency{
+		StoredWeight:             node.Weight,
+		ExpectedWeight:           expected[id].Weight,
+		StoredCumulativeWeight:   node.CumulativeWeight,
+		ExpectedCumulativeWeight: d.calculateCumulativeWeight(id, children, expected),
+	}
+	consistency.Consistent = consistency.StoredWeight == consistency.ExpectedWeight &&
+		consistency.StoredCumulativeWeight == consistency.ExpectedCumulativeWeight
+	return node, consistency, nil
+}
@@ -0,0 +1,62 @@
+package dag
+
+import (
+	"sort"
+
+	"dag-project/models"
+)
+
+// LineageEntry is one ancestor of a node together with its minimum hop distance
+// from that node; direct parents have distance 1
+type LineageEntry struct {
+	Node     *models.Node `json:"node"`
+	Distance int          `json:"distance"`
+}
+
+// Lineage returns every ancestor of id annotated with the fewest parent links needed
+// to reach it, ordered by distance then ID so clients can render one layer per
+// distance. The search is a breadth-first walk up the parent links, so each ancestor
+// is recorded at the level it is first reached. Parents missing from the graph are
+// skipped. A genesis node has an empty lineage.
+func (d *DAG) Lineage(id string) ([]LineageEntry, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Node, len(nodes))
+	for _, n := range nodes {
+		byID[n.ID] = n
+	}
+	target, ok := byID[id]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+
+	lineage := []LineageEntry{}
+	visited := map[string]bool{id: true}
+	level := target.Parents
+	for distance := 1; len(level) > 0; distance++ {
+		var next []string
+		for _, pid := range level {
+			parent, ok := byID[pid]
+			if !ok || visited[pid] {
+				continue
+			}
+			visited[pid] = true
+			lineage = append(lineage, LineageEntry{Node: parent, Distance: distance})
+			next = append(next, parent.Parents...)
+		}
+		level = next
+	}
+
+	sort.SliceStable(lineage, func(i, j int) bool {
+		if lineage[i].Distance != lineage[j].Distance {
+			return lineage[i].Distance < lineage[j].Distance
+		}
+		return lineage[i].Node.ID < lineage[j].Node.ID
+	})
+	return lineage, nil
+}
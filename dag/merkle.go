@@ -0,0 +1,178 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"dag-project/models"
+)
+
+// RootFormatMerkle marks checkpoints whose RootHash is a Merkle root built by
+// merkleRoot. Checkpoints without a format hash the concatenated node IDs instead.
+const RootFormatMerkle = "merkle"
+
+// Domain-separation prefixes keep a leaf hash from ever equalling an inner hash
+const (
+	merkleLeafPrefix  = 0x00
+	merkleInnerPrefix = 0x01
+)
+
+// ComputeMerkleRoot returns the hex SHA-256 Merkle root over nodes, the root a
+// checkpoint with the default hash algorithm records
+func ComputeMerkleRoot(nodes []*models.Node) string {
+	return merkleRoot(nodes, sha256Hasher{})
+}
+
+// merkleRoot builds a binary Merkle tree over nodes sorted by ID and returns its hex
+// root. An empty graph has the hash of no data as its root.
+func merkleRoot(nodes []*models.Node, hasher Hasher) string {
+	_, levels := merkleTree(nodes, hasher)
+	if len(levels) == 0 {
+		return fmt.Sprintf("%x", hasher.Sum(nil))
+	}
+	return fmt.Sprintf("%x", levels[len(levels)-1][0])
+}
+
+// merkleTree sorts nodes by ID and returns them with every level of their Merkle
+// tree, leaves first and the root level last. Each leaf hashes a node's canonical
+// JSON (merkleLeaf), each inner node the concatenation of its two children; a level
+// with an odd count carries its last hash up unchanged rather than pairing it with
+// itself. No nodes give no levels.
+func merkleTree(nodes []*models.Node, hasher Hasher) ([]*models.Node, [][][]byte) {
+	sorted := slices.Clone(nodes)
+	slices.SortFunc(sorted, func(a, b *models.Node) int { return strings.Compare(a.ID, b.ID) })
+	if len(sorted) == 0 {
+		return sorted, nil
+	}
+
+	level := make([][]byte, len(sorted))
+	for i, n := range sorted {
+		level[i] = hasher.Sum(append([]byte{merkleLeafPrefix}, merkleLeaf(n)...))
+	}
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			pair := make([]byte, 0, 1+len(level[i])+len(level[i+1]))
+			pair = append(pair, merkleInnerPrefix)
+			pair = append(append(pair, level[i]...), level[i+1]...)
+			next = append(next, hasher.Sum(pair))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return sorted, levels
+}
+
+// MerkleProof returns the sibling hashes on the path from a node's leaf up to the
+// Merkle root of the current graph, the root /sync/state reports and a checkpoint
+// records while the graph is unchanged. Replaying them also needs the leaf's index
+// and the leaf count, which MerkleInclusionProof reports along with the root. A
+// missing node fails with ErrNodeNotFound.
+func (d *DAG) MerkleProof(nodeID string) ([]string, error) {
+	proof, err := d.MerkleInclusionProof(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	return proof.Proof, nil
+}
+
+// MerkleInclusionProof returns the full inclusion proof of a node in the Merkle
+// root of the current graph: the MerkleProof sibling hashes together with the leaf,
+// its index, the leaf count and the root, all taken from one snapshot. A level where
+// the node's hash is carried up without a sibling contributes no hash, so a client
+// replays the proof with the index and the leaf count: at each level an odd index
+// has its sibling on the left, an even index on the right unless it is the last hash
+// of the level. A missing node fails with ErrNodeNotFound.
+func (d *DAG) MerkleInclusionProof(nodeID string) (*models.MerkleProof, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	sorted, levels := merkleTree(nodes, d.cfg.Hasher)
+	index, found := slices.BinarySearchFunc(sorted, nodeID, func(n *models.Node, id string) int {
+		return strings.Compare(n.ID, id)
+	})
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+
+	proof := &models.MerkleProof{
+		NodeID:    nodeID,
+		Leaf:      fmt.Sprintf("%x", levels[0][index]),
+		Index:     index,
+		LeafCount: len(sorted),
+		Proof:     []string{},
+		Root:      fmt.Sprintf("%x", levels[len(levels)-1][0]),
+		HashAlgo:  d.cfg.Hasher.Name(),
+	}
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Proof = append(proof.Proof, fmt.Sprintf("%x", level[sibling]))
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// merkleLeaf is the canonical JSON of the node fields a Merkle root commits to: the
+// edges, weights, archive flag, attribution and payload. CreatedAt is left out so
+// replicas that merged the same graph agree on the root, and annotations are
+// mutable notes outside the hashed content.
+func merkleLeaf(n *models.Node) []byte {
+	parents := n.Parents
+	if parents == nil {
+		parents = []string{}
+	}
+	content, _ := json.Marshal(struct {
+		ID               string          `json:"id"`
+		Parents          []string        `json:"parents"`
+		Weight           int             `json:"weight"`
+		CumulativeWeight int64           `json:"cumulative_weight"`
+		Deleted          bool            `json:"deleted"`
+		CreatedBy        string          `json:"created_by"`
+		Data             json.RawMessage `json:"data,omitempty"`
+	}{n.ID, parents, n.Weight, n.CumulativeWeight, n.Deleted, n.CreatedBy, n.Data})
+	return content
+}
+
+// checkpointRoot recomputes the root of nodes the way cp's root was computed
+func checkpointRoot(cp *models.Checkpoint, nodes []*models.Node) (string, error) {
+	hasher, err := NewHasher(cp.HashAlgo)
+	if err != nil {
+		return "", fmt.Errorf("checkpoint %s: %w", cp.ID, err)
+	}
+	if cp.RootFormat == RootFormatMerkle {
+		return merkleRoot(nodes, hasher), nil
+	}
+	return computeRootHash(nodes, hasher), nil
+}
+
+// VerifyCheckpoint recomputes cp's root over the current nodes, with the hash
+// algorithm and root format cp records, and reports whether it still matches. The
+// root covers every node and, for Merkle roots, their weights, so it only matches
+// while the graph is exactly as checkpointed.
+func (d *DAG) VerifyCheckpoint(cp *models.Checkpoint) (bool, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return false, err
+	}
+	root, err := checkpointRoot(cp, nodes)
+	if err != nil {
+		return false, err
+	}
+	return root == cp.RootHash, nil
+}
@@ -0,0 +1,175 @@
+package dag
+
+import (
+	"fmt"
+	"sort"
+
+	"dag-project/logger"
+	"dag-project/models"
+
+	"go.uber.org/zap"
+)
+
+// defaultMaxParkedOrphans bounds the pending area when Config.MaxParkedOrphans is 0
+const defaultMaxParkedOrphans = 1000
+
+// parkedNode is an approval waiting in the pending area for its missing parents
+type parkedNode struct {
+	node     *models.Node
+	parkedAt int64
+}
+
+// parkLocked stores node in the pending area when some of its parents are missing.
+// It returns nil when every parent exists and the approval should go ahead,
+// ErrNodeParked when the node was parked, and an error when parking isn't possible.
+// The caller must hold d.mux.
+func (d *DAG) parkLocked(node *models.Node) error {
+	missing, err := d.missingParents(node.Parents)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+	if _, ok := d.parked[node.ID]; ok {
+		return fmt.Errorf("%w: node %s is already parked", ErrNodeExists, node.ID)
+	}
+	limit := d.cfg.MaxParkedOrphans
+	if limit <= 0 {
+		limit = defaultMaxParkedOrphans
+	}
+	if len(d.parked) >= limit {
+		return fmt.Errorf("%w: parent node %s does not exist and the pending area is full (%d nodes)",
+			ErrInvalidParents, missing[0], limit)
+	}
+
+	copied := *node
+	copied.Parents = append([]string(nil), node.Parents...)
+	parkedAt := d.nowMillis()
+	// the client is told the node was accepted, so it must outlive a restart
+	if err := d.repo.PutParked(&models.ParkedNode{Node: &copied, ParkedAt: parkedAt}); err != nil {
+		return err
+	}
+	if d.parked == nil {
+		d.parked = make(map[string]*parkedNode)
+	}
+	d.parked[node.ID] = &parkedNode{node: &copied, parkedAt: parkedAt}
+	logger.Logger.Info("Parked node until its parents arrive",
+		zap.String("node_id", node.ID), zap.Strings("missing", missing))
+	return fmt.Errorf("%w: waiting for %v", ErrNodeParked, missing)
+}
+
+// missingParents returns the parentIDs that are not stored, in order
+func (d *DAG) missingParents(parentIDs []string) ([]string, error) {
+	var missing []string
+	for _, pid := range parentIDs {
+		exists, err := d.repo.HasNode(pid)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			missing = append(missing, pid)
+		}
+	}
+	return missing, nil
+}
+
+// loadParked reloads the parked approvals stored before a restart and approves the
+// ones whose parents all exist by now. A record whose node is already stored was
+// approved just before the restart and is removed.
+func (d *DAG) loadParked() error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	stored, err := d.repo.GetAllParked()
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(stored))
+	for _, p := range stored {
+		exists, err := d.repo.HasNode(p.Node.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := d.repo.DeleteParked(p.Node.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if d.parked == nil {
+			d.parked = make(map[string]*parkedNode)
+		}
+		d.parked[p.Node.ID] = &parkedNode{node: p.Node, parkedAt: p.ParkedAt}
+		ids = append(ids, p.Node.ID)
+	}
+	if len(ids) > 0 {
+		logger.Logger.Info("Reloaded parked nodes", zap.Int("nodes", len(ids)))
+	}
+	d.retryParkedLocked(ids)
+	return nil
+}
+
+// releaseParkedLocked retries the parked nodes waiting for arrived once all of their
+// parents exist. The caller must hold d.mux.
+func (d *DAG) releaseParkedLocked(arrived string) {
+	if len(d.parked) == 0 {
+		return
+	}
+	var ready []string
+	for id, p := range d.parked {
+		for _, pid := range p.node.Parents {
+			if pid == arrived {
+				ready = append(ready, id)
+				break
+			}
+		}
+	}
+	d.retryParkedLocked(ready)
+}
+
+// retryParkedLocked approves the parked nodes among ids whose parents all exist, in
+// ID order, and removes their stored records. An approved node releases the nodes
+// waiting for it in turn. A retry failing for another reason drops the node with a
+// warning, as an immediate approval would have rejected it. The caller must hold d.mux.
+func (d *DAG) retryParkedLocked(ids []string) {
+	sort.Strings(ids)
+	for _, id := range ids {
+		p, ok := d.parked[id]
+		if !ok {
+			continue
+		}
+		missing, err := d.missingParents(p.node.Parents)
+		if err != nil || len(missing) > 0 {
+			continue
+		}
+		delete(d.parked, id)
+		approveErr := d.approveNodeLocked(p.node)
+		// a record left behind by a failed delete is cleaned up on the next load
+		if err := d.repo.DeleteParked(id); err != nil {
+			logger.Logger.Warn("Failed to remove parked node record", zap.String("node_id", id), zap.Error(err))
+		}
+		if approveErr != nil {
+			logger.Logger.Warn("Dropped parked node after its parents arrived",
+				zap.String("node_id", id), zap.Error(approveErr))
+			continue
+		}
+		logger.Logger.Info("Approved parked node", zap.String("node_id", id))
+	}
+}
+
+// PendingNodes returns the parked nodes ordered by ID, each with the parents it is
+// still waiting for
+func (d *DAG) PendingNodes() ([]models.ParkedNode, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	pending := make([]models.ParkedNode, 0, len(d.parked))
+	for _, p := range d.parked {
+		missing, err := d.missingParents(p.node.Parents)
+		if err != nil {
+			return nil, err
+		}
+		copied := *p.node
+		pending = append(pending, models.ParkedNode{Node: &copied, Missing: missing, ParkedAt: p.parkedAt})
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Node.ID < pending[j].Node.ID })
+	return pending, nil
+}
@@ -0,0 +1,127 @@
+package dag
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"dag-project/logger"
+
+	"go.uber.org/zap"
+)
+
+// Defaults for the async propagation pool
+const (
+	defaultPropagationWorkers   = 1
+	defaultPropagationQueueSize = 1024
+)
+
+// propagationPool applies queued weight propagations on a bounded set of workers.
+// Workers take the DAG lock per job, so approvals only pay for persisting the node.
+type propagationPool struct {
+	dag      *DAG
+	jobs     chan []string
+	workers  sync.WaitGroup
+	enqueued atomic.Int64
+	closed   bool // guarded by dag.mux
+
+	// processed is guarded by doneMux; done is broadcast whenever it advances
+	doneMux   sync.Mutex
+	done      *sync.Cond
+	processed int64
+}
+
+func newPropagationPool(d *DAG, workers, queueSize int) *propagationPool {
+	if workers <= 0 {
+		workers = defaultPropagationWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultPropagationQueueSize
+	}
+	p := &propagationPool{dag: d, jobs: make(chan []string, queueSize)}
+	p.done = sync.NewCond(&p.doneMux)
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+// enqueue queues a propagation for parentIDs and reports whether it was accepted.
+// The caller must hold dag.mux; when the pool is closed or the queue is full the
+// caller propagates synchronously instead, which also applies backpressure.
+func (p *propagationPool) enqueue(parentIDs []string) bool {
+	if p.closed || len(parentIDs) == 0 {
+		return false
+	}
+	select {
+	case p.jobs <- parentIDs:
+		p.enqueued.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *propagationPool) run() {
+	defer p.workers.Done()
+	for parentIDs := range p.jobs {
+		p.dag.mux.Lock()
+		if err := p.dag.propagateWeights(parentIDs); err != nil {
+			logger.Logger.Warn("Failed to update ancestor weights", zap.Error(err))
+		}
+		p.dag.mux.Unlock()
+
+		p.doneMux.Lock()
+		p.processed++
+		p.done.Broadcast()
+		p.doneMux.Unlock()
+	}
+}
+
+// pendingCount returns the number of queued propagations not yet applied
+func (p *propagationPool) pendingCount() int64 {
+	p.doneMux.Lock()
+	defer p.doneMux.Unlock()
+	return p.enqueued.Load() - p.processed
+}
+
+// Flush blocks until every propagation queued before the call has been applied and
+// returns how many were pending. Work queued during the flush is not waited for.
+// In synchronous mode there is never pending work and Flush returns immediately.
+func (d *DAG) Flush() int64 {
+	if d.propagation == nil {
+		return 0
+	}
+	p := d.propagation
+	target := p.enqueued.Load()
+
+	p.doneMux.Lock()
+	defer p.doneMux.Unlock()
+	pending := target - p.processed
+	for p.processed < target {
+		p.done.Wait()
+	}
+	if pending < 0 {
+		return 0
+	}
+	return pending
+}
+
+// Close stops accepting async propagations and blocks until every queued one has
+// been applied, so no weight updates are lost on shutdown. It is a no-op in
+// synchronous mode and safe to call more than once.
+func (d *DAG) Close() {
+	if d.propagation == nil {
+		return
+	}
+	d.mux.Lock()
+	if d.propagation.closed {
+		d.mux.Unlock()
+		return
+	}
+	d.propagation.closed = true
+	close(d.propagation.jobs)
+	d.mux.Unlock()
+
+	d.propagation.workers.Wait()
+}
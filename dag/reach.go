@@ -0,0 +1,122 @@
+package dag
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"dag-project/models"
+)
+
+// GetAncestors returns every node reachable from id by following parent links,
+// breadth first: parents, then grandparents and so on, each level ordered by ID.
+// Parents missing from the graph are skipped. A visited set keeps corrupted, cyclic
+// data from looping, and id itself is never listed. Unknown ids fail with
+// ErrNodeNotFound; a genesis node has no ancestors.
+func (d *DAG) GetAncestors(id string) ([]*models.Node, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	_, parents, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+	return d.reachableFrom(id, parents, parents)
+}
+
+// GetDescendants returns every node reachable from id by following child links,
+// breadth first and ordered like GetAncestors. A tip has no descendants.
+func (d *DAG) GetDescendants(id string) ([]*models.Node, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	children, parents, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+	return d.reachableFrom(id, children, parents)
+}
+
+// reachableFrom walks edges breadth first from id and loads the stored nodes it
+// reaches, level by level with each level sorted by ID. parents is the index's
+// parent map, whose keys are exactly the stored nodes; the caller must hold d.mux.
+func (d *DAG) reachableFrom(id string, edges, parents map[string][]string) ([]*models.Node, error) {
+	if _, ok := parents[id]; !ok {
+		return nil, ErrNodeNotFound
+	}
+
+	var reachedIDs []string
+	visited := map[string]bool{id: true}
+	level := []string{id}
+	for len(level) > 0 {
+		var next []string
+		for _, current := range level {
+			for _, nextID := range edges[current] {
+				if _, stored := parents[nextID]; !stored || visited[nextID] {
+					continue
+				}
+				visited[nextID] = true
+				next = append(next, nextID)
+			}
+		}
+		sort.Strings(next)
+		reachedIDs = append(reachedIDs, next...)
+		level = next
+	}
+
+	nodesByID := d.loadNodes(reachedIDs, nil)
+	reached := make([]*models.Node, 0, len(reachedIDs))
+	for _, nodeID := range reachedIDs {
+		if n, ok := nodesByID[nodeID]; ok {
+			reached = append(reached, n)
+		}
+	}
+	return reached, nil
+}
+
+// FindPath returns a shortest chain of approvals from fromID down to toID: node IDs
+// starting at fromID, each followed by one of its children, ending at toID. It is a
+// breadth-first search over the adjacency index, visiting children in ID order so the
+// same graph always yields the same path. Unknown endpoints fail with
+// ErrNodeNotFound; when toID doesn't transitively approve fromID, including when
+// both are the same node, it fails with ErrNoPath.
+func (d *DAG) FindPath(fromID, toID string) ([]string, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	children, parents, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := parents[fromID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, fromID)
+	}
+	if _, ok := parents[toID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, toID)
+	}
+
+	previous := map[string]string{fromID: ""}
+	queue := []string{fromID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		next := append([]string(nil), children[current]...)
+		sort.Strings(next)
+		for _, child := range next {
+			if _, seen := previous[child]; seen {
+				continue
+			}
+			previous[child] = current
+			if child == toID {
+				path := []string{toID}
+				for id := current; id != ""; id = previous[id] {
+					path = append(path, id)
+				}
+				slices.Reverse(path)
+				return path, nil
+			}
+			queue = append(queue, child)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s does not approve %s", ErrNoPath, toID, fromID)
+}
@@ -0,0 +1,109 @@
+package dag
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"dag-project/logger"
+	"dag-project/models"
+)
+
+// RestoreFromCheckpoint checks the stored nodes against the latest checkpoint when
+// the service starts and primes the cached latest checkpoint. Only what no
+// operation can legitimately change since the checkpoint counts as divergence:
+//   - a node the checkpoint covered is gone while a stored node still lists it as
+//     a parent, which DeleteNode never allows;
+//   - a node frozen by cfg.ImmutableWeight both when the checkpoint was taken and
+//     now no longer matches the digest recorded for it.
+//
+// Approvals, archiving, deletes, reparenting and edits of mutable nodes after the
+// checkpoint therefore pass. A checkpoint stored without per-node digests can only
+// be compared by recomputing its root; a root that no longer matches is logged and
+// skipped, since it can't tell those operations from corruption. On a mismatch a
+// warning with the details is logged and the returned error wraps
+// ErrCheckpointMismatch; the caller decides whether to keep serving.
+func (d *DAG) RestoreFromCheckpoint() error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	cp, err := d.repo.GetLatestCheckpoint()
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		return nil
+	}
+	d.counters.latest = cp
+	d.counters.latestLoaded = true
+
+	hasher, err := NewHasher(cp.HashAlgo)
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %w", cp.ID, err)
+	}
+	digests, err := d.repo.GetCheckpointNodes(cp.ID)
+	if err != nil {
+		return err
+	}
+	frozen, err := d.repo.GetCheckpointFrozen(cp.ID)
+	if err != nil {
+		return err
+	}
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return err
+	}
+
+	if digests == nil {
+		root, err := checkpointRoot(cp, nodes)
+		if err != nil {
+			return err
+		}
+		if root != cp.RootHash {
+			logger.Logger.Info("Latest checkpoint has no node digests and the graph changed since, skipping verification",
+				zap.String("checkpoint_id", cp.ID), zap.Int("checkpoint_nodes", cp.NodeCount), zap.Int("stored_nodes", len(nodes)))
+			return nil
+		}
+		logger.Logger.Info("Verified stored nodes against the latest checkpoint",
+			zap.String("checkpoint_id", cp.ID), zap.Int("nodes", len(nodes)))
+		return nil
+	}
+
+	nodesByID := make(map[string]*models.Node, len(nodes))
+	referenced := make(map[string]bool)
+	for _, n := range nodes {
+		nodesByID[n.ID] = n
+		for _, pid := range n.Parents {
+			referenced[pid] = true
+		}
+	}
+
+	missing, changed := 0, 0
+	for id := range digests {
+		if _, stored := nodesByID[id]; !stored && referenced[id] {
+			missing++
+		}
+	}
+	for _, id := range frozen {
+		n, stored := nodesByID[id]
+		digest, covered := digests[id]
+		if !stored || !covered || d.checkMutable(n) == nil {
+			continue
+		}
+		if nodeDigest(n, hasher) != digest {
+			changed++
+		}
+	}
+	if missing == 0 && changed == 0 {
+		logger.Logger.Info("Verified stored nodes against the latest checkpoint",
+			zap.String("checkpoint_id", cp.ID), zap.Int("nodes", len(digests)), zap.Int("frozen_nodes", len(frozen)))
+		return nil
+	}
+	logger.Logger.Warn("Stored nodes diverge from the latest checkpoint",
+		zap.String("checkpoint_id", cp.ID),
+		zap.String("hash_algo", hasher.Name()),
+		zap.Int("missing_nodes", missing),
+		zap.Int("changed_nodes", changed))
+	return fmt.Errorf("%w: checkpoint %s, %d of its nodes missing and %d frozen ones changed",
+		ErrCheckpointMismatch, cp.ID, missing, changed)
+}
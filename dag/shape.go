@@ -0,0 +1,87 @@
+package dag
+
+import "dag-project/models"
+
+// maxDiameterNodes guards the diameter computation, which runs one BFS per node
+const maxDiameterNodes = 5000
+
+// ShapeReport summarizes the graph's structure: weakly-connected components, the
+// out-degree distribution and the diameter, the longest shortest directed path
+// between any two nodes. Components and degrees take a linear pass; the diameter
+// is skipped for graphs above maxDiameterNodes.
+func (d *DAG) ShapeReport() (*models.ShapeReport, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	// every stored node has an entry in the parent map, so the index alone
+	// describes the graph
+	children, parents, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ShapeReport{
+		NodeCount:  len(parents),
+		OutDegrees: make(map[int]int),
+	}
+
+	// union-find over parent edges, ignoring parents missing from the graph
+	root := make(map[string]string, len(parents))
+	for id := range parents {
+		root[id] = id
+	}
+	var find func(string) string
+	find = func(id string) string {
+		if root[id] != id {
+			root[id] = find(root[id])
+		}
+		return root[id]
+	}
+	components := len(parents)
+	for id, nodeParents := range parents {
+		report.OutDegrees[len(children[id])]++
+		for _, pid := range nodeParents {
+			if _, ok := root[pid]; !ok {
+				continue
+			}
+			if a, b := find(id), find(pid); a != b {
+				root[a] = b
+				components--
+			}
+		}
+	}
+	report.Components = components
+
+	if len(parents) > maxDiameterNodes {
+		return report, nil
+	}
+	for id := range parents {
+		if far := farthestReachable(id, children); far > report.Diameter {
+			report.Diameter = far
+		}
+	}
+	report.DiameterComputed = true
+	return report, nil
+}
+
+// farthestReachable returns the largest BFS distance from id along child edges
+func farthestReachable(id string, children map[string][]string) int {
+	dist := map[string]int{id: 0}
+	queue := []string{id}
+	farthest := 0
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, child := range children[current] {
+			if _, seen := dist[child]; seen {
+				continue
+			}
+			dist[child] = dist[current] + 1
+			if dist[child] > farthest {
+				farthest = dist[child]
+			}
+			queue = append(queue, child)
+		}
+	}
+	return farthest
+}
@@ -0,0 +1,46 @@
+package dag
+
+import (
+	"sort"
+
+	"dag-project/models"
+)
+
+// GetSiblings returns the nodes sharing at least one parent with id, excluding id
+// itself, ordered by ID. A node approving several of the same parents is listed once.
+// Genesis nodes and nodes whose parents have no other children have no siblings.
+func (d *DAG) GetSiblings(id string) ([]*models.Node, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	children, parents, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+	targetParents, ok := parents[id]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+
+	var siblingIDs []string
+	seen := map[string]bool{id: true}
+	for _, pid := range targetParents {
+		for _, child := range children[pid] {
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			siblingIDs = append(siblingIDs, child)
+		}
+	}
+
+	sort.Strings(siblingIDs)
+	nodesByID := d.loadNodes(siblingIDs, nil)
+	siblings := make([]*models.Node, 0, len(siblingIDs))
+	for _, sid := range siblingIDs {
+		if n, ok := nodesByID[sid]; ok {
+			siblings = append(siblings, n)
+		}
+	}
+	return siblings, nil
+}
@@ -0,0 +1,86 @@
+package dag
+
+import "dag-project/models"
+
+// graphCounters caches the node and tip counts and the latest checkpoint so status
+// reads don't scan the store. Simple additions and synchronous approvals update the
+// counts in place; operations that can change edges or weights arbitrarily (merge,
+// reparent, update, async propagation) invalidate them and the next read rescans
+// once. All fields are guarded by DAG.mux.
+type graphCounters struct {
+	valid bool
+	nodes int
+	tips  int
+
+	latestLoaded bool
+	latest       *models.Checkpoint
+}
+
+// Status is a cheap snapshot of the DAG's size and latest checkpoint
+type Status struct {
+	NodeCount        int
+	TipCount         int
+	LatestCheckpoint *models.Checkpoint
+}
+
+// Status returns the node and tip counts and the latest checkpoint from the
+// maintained counters, rescanning only when they have been invalidated
+func (d *DAG) Status() (*Status, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if !d.counters.valid {
+		nodes, err := d.repo.GetAllNodes()
+		if err != nil {
+			return nil, err
+		}
+		index, err := d.indexLocked()
+		if err != nil {
+			return nil, err
+		}
+		d.counters.nodes = len(nodes)
+		d.counters.tips = len(tipsOf(nodes, index.children))
+		d.counters.valid = true
+	}
+	// like GetSyncState, a failed checkpoint lookup reads as no checkpoint; it is
+	// retried on the next call rather than cached
+	if !d.counters.latestLoaded {
+		if latest, err := d.repo.GetLatestCheckpoint(); err == nil {
+			d.counters.latest = latest
+			d.counters.latestLoaded = true
+		}
+	}
+
+	return &Status{
+		NodeCount:        d.counters.nodes,
+		TipCount:         d.counters.tips,
+		LatestCheckpoint: d.counters.latest,
+	}, nil
+}
+
+// countAddedLocked records a stored node that covered coveredTips former tips
+func (d *DAG) countAddedLocked(coveredTips int) {
+	if !d.counters.valid {
+		return
+	}
+	d.counters.nodes++
+	d.counters.tips += 1 - coveredTips
+}
+
+// invalidateCountersLocked forces the next Status call to rescan the nodes
+func (d *DAG) invalidateCountersLocked() {
+	d.counters.valid = false
+}
+
+// recordCheckpointLocked keeps the cached latest checkpoint current
+func (d *DAG) recordCheckpointLocked(cp *models.Checkpoint) {
+	if d.counters.latestLoaded && (d.counters.latest == nil || cp.Timestamp >= d.counters.latest.Timestamp) {
+		d.counters.latest = cp
+	}
+}
+
+// Ping reports whether the underlying storage is reachable, for readiness probes.
+// It doesn't take the DAG lock, so a long-running write doesn't fail the probe.
+func (d *DAG) Ping() error {
+	return d.repo.Ping()
+}
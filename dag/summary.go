@@ -0,0 +1,74 @@
+package dag
+
+import "dag-project/models"
+
+// Summary computes the figures monitoring dashboards poll: node and tip counts,
+// the maximum depth, the average direct weight, the live node with the highest
+// cumulative weight and the latest checkpoint. It is one pass over the stored
+// nodes plus a topological walk of the adjacency index.
+func (d *DAG) Summary() (*models.GraphSummary, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	index, err := d.indexLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.GraphSummary{
+		NodeCount: len(nodes),
+		TipCount:  len(tipsOf(nodes, index.children)),
+		MaxDepth:  maxDepthOf(nodes, index.children, index.parents),
+	}
+	var totalWeight int64
+	var highest *models.Node
+	for _, n := range nodes {
+		totalWeight += int64(n.Weight)
+		if !n.Deleted && (highest == nil || n.CumulativeWeight > highest.CumulativeWeight) {
+			highest = n
+		}
+	}
+	if len(nodes) > 0 {
+		summary.AverageWeight = float64(totalWeight) / float64(len(nodes))
+	}
+	if highest != nil {
+		summary.HighestCumulativeWeightID = highest.ID
+	}
+	// like GetSyncState, a failed checkpoint lookup reads as no checkpoint
+	if latest, err := d.repo.GetLatestCheckpoint(); err == nil && latest != nil {
+		summary.LatestCheckpointID = latest.ID
+	}
+	return summary, nil
+}
+
+// maxDepthOf returns the largest depth among nodes, where depth has the meaning of
+// Config.MaxDepth: genesis nodes are depth 0 and every other node sits one below
+// its deepest parent. Nodes are visited in topological order; parents missing from
+// the graph count as genesis, and nodes on a cycle, which only corrupted data
+// contains, are never reached.
+func maxDepthOf(nodes []*models.Node, children, parents map[string][]string) int {
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		ids = append(ids, n.ID)
+	}
+	order, _ := topoOrder(ids, children, parents, nil)
+
+	depth := make(map[string]int, len(order))
+	maxDepth := 0
+	for _, id := range order {
+		// parents come first in the order, so only missing ones are unplaced
+		depthOfID := 0
+		for _, pid := range parents[id] {
+			if parentDepth, placed := depth[pid]; placed && parentDepth+1 > depthOfID {
+				depthOfID = parentDepth + 1
+			}
+		}
+		depth[id] = depthOfID
+		maxDepth = max(maxDepth, depthOfID)
+	}
+	return maxDepth
+}
@@ -0,0 +1,608 @@
+package dag
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"dag-project/models"
+	"dag-project/repository"
+)
+
+// tipLatencySmoothing is the EMA smoothing factor applied to each new tip-selection duration
+const tipLatencySmoothing = 0.2
+
+// distinctTipAttempts bounds the walks spent per requested tip when collecting distinct tips
+const distinctTipAttempts = 10
+
+// Default MCMC tuning used when a caller does not override it
+const (
+	defaultAlpha    = 0.01
+	defaultMaxSteps = 10000
+)
+
+// TipFallback decides what tip selection returns when the DAG has nodes but no tips.
+// A healthy DAG always has a frontier; an empty one means every node already has a
+// child, which only happens through inconsistent data.
+type TipFallback int
+
+const (
+	// TipFallbackError fails with ErrNoTips
+	TipFallbackError TipFallback = iota
+	// TipFallbackHighestCumulative returns the node with the highest cumulative weight
+	TipFallbackHighestCumulative
+	// TipFallbackNewest returns the most recently created node
+	TipFallbackNewest
+)
+
+// ParseTipFallback converts a config value into a TipFallback
+func ParseTipFallback(s string) (TipFallback, error) {
+	switch s {
+	case "", "error":
+		return TipFallbackError, nil
+	case "highest_cumulative":
+		return TipFallbackHighestCumulative, nil
+	case "newest":
+		return TipFallbackNewest, nil
+	}
+	return TipFallbackError, fmt.Errorf("unknown tip fallback %q", s)
+}
+
+// TipSelectionParams tunes a single MCMC tip selection.
+//
+// Alpha scales how strongly cumulative-weight differences bias the walk: a proposal
+// is accepted with probability exp(alpha * (1 - exploration) * Δweight), so a high
+// alpha makes the walk settle on heavy tips. Exploration, in [0, 1], acts as a
+// temperature on top of alpha: it flattens the weight bias and suppresses the
+// periodic jump to the deepest reachable tip, so lighter tips on short branches get
+// picked more often. With exploration 1 every tip is equally likely regardless of alpha.
+//
+// MaxSteps and Budget bound the walk; when both are set whichever is reached first
+// ends it and the current tip is returned. With a Budget and no MaxSteps the walk
+// runs as many steps as fit in the budget, giving predictable latency on any graph.
+//
+// MinWeight, when positive, drops tips whose stored cumulative weight is below it
+// from the candidate set before walking.
+type TipSelectionParams struct {
+	Alpha       float64
+	MaxSteps    int
+	Exploration float64
+	Budget      time.Duration
+	MinWeight   int64
+}
+
+// DefaultTipSelectionParams returns the parameters used by TipSelection
+func DefaultTipSelectionParams() TipSelectionParams {
+	return TipSelectionParams{
+		Alpha:    defaultAlpha,
+		MaxSteps: defaultMaxSteps,
+	}
+}
+
+// SetRandSource pins the randomness of tip selection: every selection seeds its walks
+// from the next value of src, so a DAG given a source with a fixed seed makes the
+// same choices on the same graph. Tests use it to assert exact tips. Without a
+// source, selections seed from the current time. Call it before serving requests.
+func (d *DAG) SetRandSource(src rand.Source) {
+	d.randMux.Lock()
+	defer d.randMux.Unlock()
+	d.randSource = src
+}
+
+// newRand returns the random generator for one selection. A rand.Source isn't safe
+// for concurrent use, so only the seed is drawn from the shared source.
+func (d *DAG) newRand() *rand.Rand {
+	d.randMux.Lock()
+	defer d.randMux.Unlock()
+	if d.randSource == nil {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return rand.New(rand.NewSource(d.randSource.Int63()))
+}
+
+// TipSelection now uses an MCMC-style weighted random walk.
+func (d *DAG) TipSelection() (*models.Node, error) {
+	return d.TipSelectionWithParams(DefaultTipSelectionParams())
+}
+
+// TipSelectionMCMC runs a proper MCMC-style weighted random walk for tip selection.
+func (d *DAG) TipSelectionMCMC(alpha float64, maxSteps int) (*models.Node, error) {
+	return d.TipSelectionWithParams(TipSelectionParams{Alpha: alpha, MaxSteps: maxSteps})
+}
+
+// TipSelectionWithParams runs the MCMC walk with explicit tuning parameters
+func (d *DAG) TipSelectionWithParams(params TipSelectionParams) (*models.Node, error) {
+	tip, _, err := d.TipSelectionWithSteps(params)
+	return tip, err
+}
+
+// TipSelectionWithSteps runs one MCMC walk and also reports how many walk steps ran,
+// which varies under a time budget. A DAG without tips runs no steps.
+func (d *DAG) TipSelectionWithSteps(params TipSelectionParams) (*models.Node, int, error) {
+	tips, steps, err := d.TipSelectionBulk(1, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tips[0], steps, nil
+}
+
+// TipSelectionBulk runs count independent MCMC walks over one snapshot of the graph
+// and returns the tip each one reached, so the same tip can appear more than once.
+// The graph maps and cumulative weights are built once and shared by every walk,
+// while each walk draws fresh randomness, so the result follows the same
+// distribution as count separate selections. Budget and MaxSteps bound each walk.
+// steps is the total number of walk steps run across all walks.
+func (d *DAG) TipSelectionBulk(count int, params TipSelectionParams) (selected []*models.Node, steps int, err error) {
+	if count <= 0 {
+		return nil, 0, errors.New("tip count must be positive")
+	}
+	walker, fallback, err := d.prepareTipWalk(params)
+	if err != nil {
+		return nil, 0, err
+	}
+	if walker == nil {
+		selected = make([]*models.Node, count)
+		for i := range selected {
+			selected[i] = fallback
+		}
+		return selected, 0, nil
+	}
+
+	// one source for the whole batch: successive draws are independent, whereas
+	// reseeding per walk from the clock could repeat seeds within a tick
+	rnd := d.newRand()
+	selected = make([]*models.Node, 0, count)
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		tip, walked := walker.walk(params, rnd, start)
+		d.recordTipSelectionLatency(time.Since(start))
+		selected = append(selected, tip)
+		steps += walked
+	}
+	return selected, steps, nil
+}
+
+// prepareTipWalk validates params and builds the walker shared by the walks of one
+// selection. A graph without tips has nothing to walk: the walker is nil and the
+// node picked by the configured fallback is returned instead.
+func (d *DAG) prepareTipWalk(params TipSelectionParams) (*tipWalker, *models.Node, error) {
+	if params.Exploration < 0 || params.Exploration > 1 {
+		return nil, nil, errors.New("exploration must be between 0 and 1")
+	}
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, nil, ErrEmptyGraph
+	}
+
+	walker := d.newTipWalker(nodes)
+	if len(walker.tips) == 0 {
+		fallback, err := d.noTipsFallback(nodes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, fallback, nil
+	}
+	if params.MinWeight > 0 {
+		if err := walker.filterTips(params.MinWeight); err != nil {
+			return nil, nil, err
+		}
+	}
+	return walker, nil, nil
+}
+
+// tipWalker holds the graph snapshot shared by the MCMC walks of one selection
+type tipWalker struct {
+	d         *DAG
+	nodesByID map[string]*models.Node
+	children  map[string][]string
+	parents   map[string][]string
+	tips      []*models.Node
+	weights   map[string]int64 // cumulative weights computed so far
+	// candidates restricts where a walk may settle after filterTips, nil allows any tip
+	candidates map[string]bool
+}
+
+// newTipWalker indexes nodes for walking. The edges come from a snapshot of the
+// adjacency index when it is loaded and are built from nodes otherwise; edges to
+// nodes stored after nodes were read are tolerated by the walk.
+func (d *DAG) newTipWalker(nodes []*models.Node) *tipWalker {
+	t := &tipWalker{
+		d:         d,
+		nodesByID: make(map[string]*models.Node, len(nodes)),
+		weights:   make(map[string]int64),
+	}
+	for _, n := range nodes {
+		t.nodesByID[n.ID] = n
+	}
+	var ok bool
+	if t.children, t.parents, ok = d.index.snapshot(); !ok {
+		t.children = childrenOf(nodes)
+		t.parents = parentsOf(nodes)
+	}
+
+	// Find all live nodes without live children
+	for _, n := range nodes {
+		if !n.Deleted && directWeight(t.children[n.ID], t.nodesByID) == 0 {
+			t.tips = append(t.tips, n)
+		}
+	}
+	return t
+}
+
+// filterTips keeps only the tips whose stored cumulative weight reaches minWeight
+func (t *tipWalker) filterTips(minWeight int64) error {
+	kept := t.tips[:0]
+	for _, tip := range t.tips {
+		if tip.CumulativeWeight >= minWeight {
+			kept = append(kept, tip)
+		}
+	}
+	if len(kept) == 0 {
+		return fmt.Errorf("%w: none of %d tips has cumulative weight %d or more",
+			ErrNoQualifyingTips, len(t.tips), minWeight)
+	}
+	t.tips = kept
+	t.candidates = make(map[string]bool, len(kept))
+	for _, tip := range kept {
+		t.candidates[tip.ID] = true
+	}
+	return nil
+}
+
+// cumulativeWeight returns id's cumulative weight, computing it at most once per walker
+func (t *tipWalker) cumulativeWeight(id string) int64 {
+	if w, ok := t.weights[id]; ok {
+		return w
+	}
+	w := t.d.calculateCumulativeWeight(id, t.children, t.nodesByID)
+	t.weights[id] = w
+	return w
+}
+
+// walk performs one MCMC walk over the tips and returns the tip it settled on and the
+// number of steps it ran; the walker must have at least one tip
+func (t *tipWalker) walk(params TipSelectionParams, rnd *rand.Rand, start time.Time) (*models.Node, int) {
+	tips, candidates := t.tips, t.candidates
+	if size := t.d.cfg.TipSampleSize; size > 0 && len(tips) > size {
+		tips, candidates = sampleTips(tips, size, rnd)
+	}
+
+	// Start from a random tip
+	currentTip := tips[rnd.Intn(len(tips))]
+
+	var deadline time.Time
+	if params.Budget > 0 {
+		deadline = start.Add(params.Budget)
+	}
+
+	// Perform MCMC walk
+	step := 0
+	for ; params.walkContinues(step, deadline); step++ {
+		currentWeight := t.cumulativeWeight(currentTip.ID)
+		// Propose a random selection from all tip
+		proposedTip := tips[rnd.Intn(len(tips))]
+		proposedWeight := t.cumulativeWeight(proposedTip.ID)
+
+		// Higher cumulative weight = higher probability of acceptance
+		// exploration flattens the bias so lighter tips are accepted more often
+		acceptanceProb := math.Exp(params.Alpha * (1 - params.Exploration) * float64(proposedWeight-currentWeight))
+
+		// Accept  the proposal
+		if rnd.Float64() < acceptanceProb {
+			currentTip = proposedTip
+		}
+
+		// The deep-branch jump is skipped with probability exploration
+		if step%100 == 0 && len(t.parents[currentTip.ID]) > 0 && rnd.Float64() >= params.Exploration {
+			// Randomly walk to a parent node
+			parentID := t.parents[currentTip.ID][rnd.Intn(len(t.parents[currentTip.ID]))]
+			if _, exists := t.nodesByID[parentID]; exists {
+				if len(t.children[parentID]) > 0 {
+					childIDs := t.children[parentID]
+					randomChildID := childIDs[rnd.Intn(len(childIDs))]
+					if _, exists := t.nodesByID[randomChildID]; exists {
+						tipFromChild := t.d.walkToTip(randomChildID, t.children, t.nodesByID, rnd)
+						if tipFromChild != nil && !tipFromChild.Deleted &&
+							(candidates == nil || candidates[tipFromChild.ID]) {
+							currentTip = tipFromChild
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return currentTip, step
+}
+
+// sampleTips draws size distinct tips uniformly at random with a partial
+// Fisher-Yates shuffle over a copy, and returns them with their IDs as a set so the
+// walk's jumps stay inside the sample
+func sampleTips(tips []*models.Node, size int, rnd *rand.Rand) ([]*models.Node, map[string]bool) {
+	pool := append([]*models.Node(nil), tips...)
+	sample := make(map[string]bool, size)
+	for i := 0; i < size; i++ {
+		j := i + rnd.Intn(len(pool)-i)
+		pool[i], pool[j] = pool[j], pool[i]
+		sample[pool[i].ID] = true
+	}
+	return pool[:size], sample
+}
+
+// walkContinues reports whether the MCMC walk may take step, honouring both bounds
+func (p TipSelectionParams) walkContinues(step int, deadline time.Time) bool {
+	if p.MaxSteps > 0 && step >= p.MaxSteps {
+		return false
+	}
+	if deadline.IsZero() {
+		return p.MaxSteps > 0
+	}
+	return time.Now().Before(deadline)
+}
+
+// noTipsFallback applies the configured TipFallback to a DAG without a frontier
+func (d *DAG) noTipsFallback(nodes []*models.Node) (*models.Node, error) {
+	var best *models.Node
+	switch d.cfg.TipFallback {
+	case TipFallbackHighestCumulative:
+		for _, n := range nodes {
+			if best == nil || n.CumulativeWeight > best.CumulativeWeight ||
+				(n.CumulativeWeight == best.CumulativeWeight && n.ID < best.ID) {
+				best = n
+			}
+		}
+	case TipFallbackNewest:
+		for _, n := range nodes {
+			if best == nil || n.CreatedAt > best.CreatedAt ||
+				(n.CreatedAt == best.CreatedAt && n.ID < best.ID) {
+				best = n
+			}
+		}
+	default:
+		return nil, ErrNoTips
+	}
+	return best, nil
+}
+
+// selectDistinctTips runs independent MCMC walks until n distinct tips are found or
+// the attempt budget is spent, returning however many distinct tips were reached
+func (d *DAG) selectDistinctTips(params TipSelectionParams, n int) ([]*models.Node, error) {
+	tips, _, err := d.selectDistinctTipsWithSteps(params, n)
+	return tips, err
+}
+
+// selectDistinctTipsWithSteps is selectDistinctTips that also totals the walk steps.
+// Like TipSelectionBulk, every attempt walks the same graph snapshot and draws from
+// one random source.
+func (d *DAG) selectDistinctTipsWithSteps(params TipSelectionParams, n int) ([]*models.Node, int, error) {
+	walker, fallback, err := d.prepareTipWalk(params)
+	if err != nil {
+		return nil, 0, err
+	}
+	if walker == nil {
+		return []*models.Node{fallback}, 0, nil
+	}
+
+	rnd := d.newRand()
+	seen := make(map[string]bool, n)
+	var tips []*models.Node
+	steps := 0
+	for attempt := 0; attempt < n*distinctTipAttempts && len(tips) < n; attempt++ {
+		start := time.Now()
+		tip, walked := walker.walk(params, rnd, start)
+		d.recordTipSelectionLatency(time.Since(start))
+		steps += walked
+		if !seen[tip.ID] {
+			seen[tip.ID] = true
+			tips = append(tips, tip)
+		}
+	}
+	return tips, steps, nil
+}
+
+// TipSelectionN selects up to n distinct tips with the MCMC walk, e.g. the two a
+// Tangle transaction approves. The walks share one graph snapshot and random source,
+// each drawing fresh randomness. When fewer than n distinct tips are reached, as on a
+// frontier smaller than n, the distinct tips found are returned and the caller can
+// compare the length against n.
+func (d *DAG) TipSelectionN(alpha float64, maxSteps, n int) ([]*models.Node, error) {
+	tips, _, err := d.TipSelectionDistinct(TipSelectionParams{Alpha: alpha, MaxSteps: maxSteps}, n)
+	return tips, err
+}
+
+// TipSelectionDistinct is TipSelectionN with full tuning parameters; it also reports
+// the walk steps run across all attempts
+func (d *DAG) TipSelectionDistinct(params TipSelectionParams, n int) ([]*models.Node, int, error) {
+	if n <= 0 {
+		return nil, 0, errors.New("tip count must be positive")
+	}
+	return d.selectDistinctTipsWithSteps(params, n)
+}
+
+// SelectTips returns up to n distinct tips using weighted sampling without replacement.
+// Every tip has cumulative weight zero, so a tip is weighted instead by the summed
+// cumulative weight of the nodes it approves, plus one so that tips on fresh or
+// genesis nodes remain eligible: tips building on the heavily confirmed part of the
+// graph are drawn first proportionally more often. When fewer than n tips exist,
+// all of them are returned.
+func (d *DAG) SelectTips(n int) ([]*models.Node, error) {
+	if n <= 0 {
+		return nil, errors.New("tip count must be positive")
+	}
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, ErrEmptyGraph
+	}
+	children, _, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+	nodesByID := make(map[string]*models.Node, len(nodes))
+	for _, node := range nodes {
+		nodesByID[node.ID] = node
+	}
+
+	tips := tipsOf(nodes, children)
+	rnd := d.newRand()
+
+	// Efraimidis-Spirakis: key = u^(1/w), keep the n largest keys
+	keys := make(map[string]float64, len(tips))
+	for _, tip := range tips {
+		weight := 1.0
+		for _, pid := range tip.Parents {
+			if parent, ok := nodesByID[pid]; ok {
+				weight += float64(parent.CumulativeWeight)
+			}
+		}
+		keys[tip.ID] = math.Pow(rnd.Float64(), 1/weight)
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		return keys[tips[i].ID] > keys[tips[j].ID]
+	})
+
+	if n > len(tips) {
+		n = len(tips)
+	}
+	return tips[:n], nil
+}
+
+// GetTips returns every current tip, i.e. every live node without live children, in
+// the configured listing order. An empty DAG has no tips and yields an empty slice.
+func (d *DAG) GetTips() ([]*models.Node, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	children, _, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+	tips := tipsOf(nodes, children)
+	if tips == nil {
+		tips = []*models.Node{}
+	}
+	repository.SortNodes(tips, d.cfg.ListOrder)
+	return tips, nil
+}
+
+// tipsOf returns the live nodes without a live child in children; a node whose
+// children are all archived is a tip again
+func tipsOf(nodes []*models.Node, children map[string][]string) []*models.Node {
+	nodesByID := make(map[string]*models.Node, len(nodes))
+	for _, n := range nodes {
+		nodesByID[n.ID] = n
+	}
+
+	var tips []*models.Node
+	for _, n := range nodes {
+		if !n.Deleted && directWeight(children[n.ID], nodesByID) == 0 {
+			tips = append(tips, n)
+		}
+	}
+	return tips
+}
+
+// calculateCumulativeWeight calculates the cumulative weight for a node
+func (d *DAG) calculateCumulativeWeight(nodeID string, children map[string][]string, nodesByID map[string]*models.Node) int64 {
+	node, exists := nodesByID[nodeID]
+	if !exists {
+		return 0
+	}
+
+	// Start with direct weight
+	cumulativeWeight := int64(node.Weight)
+
+	// Shared descendants are counted according to the configured CumulativeMode
+	visited := make(map[string]bool)
+	var calculateParentWeight func(string) int64
+	calculateParentWeight = func(nID string) int64 {
+		descendantWeight := int64(0)
+		for _, childID := range children[nID] {
+			if !d.countsDescendant(childID, visited) {
+				continue
+			}
+			if childNode, exists := nodesByID[childID]; exists {
+				// an archived node adds no weight, but its descendants still count
+				if !childNode.Deleted {
+					descendantWeight += int64(childNode.Weight)
+				}
+				descendantWeight += calculateParentWeight(childID)
+			}
+		}
+		return descendantWeight
+	}
+
+	cumulativeWeight += calculateParentWeight(nodeID)
+	return cumulativeWeight
+}
+
+// walkToTip walks from a given node to one of its parent tips
+func (d *DAG) walkToTip(nodeID string, children map[string][]string, nodesByID map[string]*models.Node, rnd *rand.Rand) *models.Node {
+	currentID := nodeID
+
+	for {
+		childIDs := children[currentID]
+		if len(childIDs) == 0 {
+			if tipNode, exists := nodesByID[currentID]; exists {
+				return tipNode
+			}
+			return nil
+		}
+
+		// Randomly choose a child
+		nextID := childIDs[rnd.Intn(len(childIDs))]
+		currentID = nextID
+	}
+}
+
+// recordTipSelectionLatency folds a tip-selection duration into the moving average
+func (d *DAG) recordTipSelectionLatency(elapsed time.Duration) {
+	d.statsMux.Lock()
+	defer d.statsMux.Unlock()
+
+	ms := float64(elapsed) / float64(time.Millisecond)
+	if d.tipSelectionRuns == 0 {
+		d.tipLatencyEMA = ms
+	} else {
+		d.tipLatencyEMA = tipLatencySmoothing*ms + (1-tipLatencySmoothing)*d.tipLatencyEMA
+	}
+	d.tipSelectionRuns++
+}
+
+// ResetTipSelectionLatency clears the tip-selection moving average
+func (d *DAG) ResetTipSelectionLatency() {
+	d.ResetStats()
+}
+
+// ResetStats zeroes the in-memory runtime statistics and returns the values they
+// held, read and cleared under one lock so no sample is lost in between. Durable
+// lifetime counters are not touched.
+func (d *DAG) ResetStats() *models.Stats {
+	d.statsMux.Lock()
+	defer d.statsMux.Unlock()
+
+	previous := &models.Stats{
+		TipSelectionLatencyEMA: d.tipLatencyEMA,
+		TipSelections:          d.tipSelectionRuns,
+	}
+	d.tipLatencyEMA = 0
+	d.tipSelectionRuns = 0
+	return previous
+}
@@ -0,0 +1,105 @@
+package dag
+
+import (
+	"fmt"
+	"sort"
+
+	"dag-project/models"
+)
+
+// TopologicalSort returns every node so that each node follows all of its stored
+// parents, using Kahn's algorithm level by level: genesis nodes come first, then
+// the nodes whose parents are all placed, and so on. Within a level nodes are
+// ordered by CreatedAt, then ID, so the order is deterministic and replaying it
+// reproduces the DAG. Parents that aren't stored are ignored. A cycle, which only
+// corrupted data can contain, fails with ErrCycleDetected.
+func (d *DAG) TopologicalSort() ([]*models.Node, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	nodes, err := d.repo.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	children, parents, err := d.indexRLocked()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Node, len(nodes))
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		byID[n.ID] = n
+		ids = append(ids, n.ID)
+	}
+
+	order, err := topoOrder(ids, children, parents, func(a, b string) bool {
+		if byID[a].CreatedAt != byID[b].CreatedAt {
+			return byID[a].CreatedAt < byID[b].CreatedAt
+		}
+		return a < b
+	})
+	if err != nil {
+		return nil, err
+	}
+	ordered := make([]*models.Node, len(order))
+	for i, id := range order {
+		ordered[i] = byID[id]
+	}
+	return ordered, nil
+}
+
+// topoOrder orders ids with Kahn's algorithm so that every node follows its
+// predecessors among ids: first the nodes without one, then the nodes whose
+// predecessors are all placed, and so on. successors and predecessors are the two
+// directions of the same edges, children and parents for a genesis-first order or
+// the other way round for a tips-first one. Edges leaving ids are ignored and an
+// edge listed twice counts once. Each level is sorted with less when it isn't nil.
+// Nodes on a cycle are left out of the order, which then comes with ErrCycleDetected.
+func topoOrder(ids []string, successors, predecessors map[string][]string, less func(a, b string) bool) ([]string, error) {
+	inSet := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		inSet[id] = true
+	}
+	seen := make(map[string]bool)
+	distinct := func(edges []string) []string {
+		clear(seen)
+		var out []string
+		for _, id := range edges {
+			if inSet[id] && !seen[id] {
+				seen[id] = true
+				out = append(out, id)
+			}
+		}
+		return out
+	}
+
+	pending := make(map[string]int, len(ids))
+	var level []string
+	for _, id := range ids {
+		if pending[id] = len(distinct(predecessors[id])); pending[id] == 0 {
+			level = append(level, id)
+		}
+	}
+	order := make([]string, 0, len(ids))
+	for len(level) > 0 {
+		if less != nil {
+			sort.Slice(level, func(i, j int) bool { return less(level[i], level[j]) })
+		}
+		order = append(order, level...)
+
+		var next []string
+		for _, id := range level {
+			for _, succ := range distinct(successors[id]) {
+				if pending[succ]--; pending[succ] == 0 {
+					next = append(next, succ)
+				}
+			}
+		}
+		level = next
+	}
+
+	if len(order) < len(inSet) {
+		return order, fmt.Errorf("%w: %d node(s) could not be ordered", ErrCycleDetected, len(inSet)-len(order))
+	}
+	return order, nil
+}
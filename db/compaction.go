@@ -0,0 +1,114 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dag-project/logger"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"go.uber.org/zap"
+)
+
+// defaultWriteCheckInterval is how often a write-triggered schedule polls the write count
+const defaultWriteCheckInterval = time.Second
+
+// Compact compacts the whole key range, discarding overwritten data and merging
+// tables so reads touch fewer files
+func (l *LevelDB) Compact() error {
+	return l.conn.CompactRange(util.Range{})
+}
+
+// CompactionSchedule decides when CompactionScheduler compacts. Either trigger may be
+// used alone; with both, whichever fires first compacts and resets the write count.
+type CompactionSchedule struct {
+	// Interval compacts this often (0 disables the timer)
+	Interval time.Duration
+	// Writes compacts once this many Put or Write calls happened since the last
+	// compaction (0 disables the write trigger)
+	Writes int64
+	// CheckInterval is how often the write count is checked (default 1s)
+	CheckInterval time.Duration
+}
+
+// CompactionScheduler compacts a LevelDB in the background until Stop is called
+type CompactionScheduler struct {
+	db        *LevelDB
+	schedule  CompactionSchedule
+	stop      chan struct{}
+	done      sync.WaitGroup
+	completed atomic.Int64
+}
+
+// StartCompactionScheduler starts compacting l according to schedule. It returns nil
+// when neither trigger is enabled.
+func (l *LevelDB) StartCompactionScheduler(schedule CompactionSchedule) *CompactionScheduler {
+	if schedule.Interval <= 0 && schedule.Writes <= 0 {
+		return nil
+	}
+	if schedule.CheckInterval <= 0 {
+		schedule.CheckInterval = defaultWriteCheckInterval
+	}
+	c := &CompactionScheduler{db: l, schedule: schedule, stop: make(chan struct{})}
+	c.done.Add(1)
+	go c.run()
+	return c
+}
+
+func (c *CompactionScheduler) run() {
+	defer c.done.Done()
+
+	var interval <-chan time.Time
+	if c.schedule.Interval > 0 {
+		ticker := time.NewTicker(c.schedule.Interval)
+		defer ticker.Stop()
+		interval = ticker.C
+	}
+	var check <-chan time.Time
+	if c.schedule.Writes > 0 {
+		ticker := time.NewTicker(c.schedule.CheckInterval)
+		defer ticker.Stop()
+		check = ticker.C
+	}
+
+	baseline := c.db.writes.Load()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-interval:
+			baseline = c.compact("interval")
+		case <-check:
+			if c.db.writes.Load()-baseline >= c.schedule.Writes {
+				baseline = c.compact("writes")
+			}
+		}
+	}
+}
+
+// compact runs one compaction and returns the write count it started from
+func (c *CompactionScheduler) compact(trigger string) int64 {
+	baseline := c.db.writes.Load()
+	start := time.Now()
+	if err := c.db.Compact(); err != nil {
+		logger.Logger.Error("Scheduled compaction failed", zap.String("trigger", trigger), zap.Error(err))
+		return baseline
+	}
+	c.completed.Add(1)
+	logger.Logger.Info("Scheduled compaction finished",
+		zap.String("trigger", trigger), zap.Duration("duration", time.Since(start)))
+	return baseline
+}
+
+// Completed returns how many scheduled compactions have finished successfully
+func (c *CompactionScheduler) Completed() int64 {
+	return c.completed.Load()
+}
+
+// Stop prevents further compactions and waits for a running one to finish, so the
+// database can be closed safely afterwards
+func (c *CompactionScheduler) Stop() {
+	close(c.stop)
+	c.done.Wait()
+}
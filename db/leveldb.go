@@ -1,17 +1,49 @@
 package db
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// KeyInfo describes a stored key without its value
+type KeyInfo struct {
+	Key  []byte
+	Size int // value length in bytes
+}
+
 // LevelDB wraps the actual LevelDB connection
 type LevelDB struct {
 	conn *leveldb.DB
+	// writes counts Put and Write calls, driving write-triggered compaction
+	writes atomic.Int64
+}
+
+// Options control how NewLevelDBWithOptions prepares the database path
+type Options struct {
+	// CreateParent creates the parent directory of the path when it is missing
+	CreateParent bool
 }
 
-// NewLevelDB opens (or creates) a LevelDB instance at the given path
+// NewLevelDB opens (or creates) a LevelDB instance at the given path, creating
+// missing parent directories
 func NewLevelDB(path string) (*LevelDB, error) {
+	return NewLevelDBWithOptions(path, Options{CreateParent: true})
+}
+
+// NewLevelDBWithOptions validates path and opens (or creates) a LevelDB instance there.
+// It fails with an actionable error when the parent directory is missing or not
+// writable, or when path holds files that don't belong to a LevelDB database.
+func NewLevelDBWithOptions(path string, opts Options) (*LevelDB, error) {
+	if err := validatePath(path, opts); err != nil {
+		return nil, err
+	}
 	db, err := leveldb.OpenFile(path, nil)
 	if err != nil {
 		return nil, err
@@ -26,17 +58,126 @@ func (l *LevelDB) Close() error {
 
 // Put inserts or updates a key-value pair
 func (l *LevelDB) Put(key, value []byte) error {
+	l.writes.Add(1)
 	return l.conn.Put(key, value, nil)
 }
 
+// Delete removes a key; deleting a missing key is not an error
+func (l *LevelDB) Delete(key []byte) error {
+	l.writes.Add(1)
+	return l.conn.Delete(key, nil)
+}
+
+// Write applies all operations in the batch atomically
+func (l *LevelDB) Write(batch *leveldb.Batch) error {
+	l.writes.Add(1)
+	return l.conn.Write(batch, nil)
+}
+
+// PutBatch stores all key-value pairs in one atomic write, so either every pair
+// is stored or none is
+func (l *LevelDB) PutBatch(pairs map[string][]byte) error {
+	batch := new(leveldb.Batch)
+	for key, value := range pairs {
+		batch.Put([]byte(key), value)
+	}
+	return l.Write(batch)
+}
+
 // Get retrieves the value for a given key
 func (l *LevelDB) Get(key []byte) ([]byte, error) {
 	return l.conn.Get(key, nil)
 }
 
+// Has reports whether a key exists without reading its value
+func (l *LevelDB) Has(key []byte) (bool, error) {
+	return l.conn.Has(key, nil)
+}
+
 // NewIterator returns an iterator to loop over all key-value pairs
 func (l *LevelDB) NewIterator() iterator.Iterator {
 	return l.conn.NewIterator(nil, nil)
 }
 
+// NewPrefixIterator returns an iterator over the key-value pairs whose key starts with prefix
+func (l *LevelDB) NewPrefixIterator(prefix []byte) iterator.Iterator {
+	return l.conn.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+// Keys returns up to limit keys starting with prefix, in key order, that sort after
+// the cursor key after (nil starts from the beginning). more reports whether further
+// keys remain. Values are not decoded, only measured.
+func (l *LevelDB) Keys(prefix, after []byte, limit int) (keys []KeyInfo, more bool, err error) {
+	iter := l.conn.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
 
+	ok := iter.First()
+	if len(after) > 0 {
+		ok = iter.Seek(after)
+		if ok && string(iter.Key()) == string(after) {
+			ok = iter.Next()
+		}
+	}
+	for ; ok; ok = iter.Next() {
+		if len(keys) == limit {
+			more = true
+			break
+		}
+		key := append([]byte(nil), iter.Key()...)
+		keys = append(keys, KeyInfo{Key: key, Size: len(iter.Value())})
+	}
+	return keys, more, iter.Error()
+}
+
+// levelDBFile matches the file names LevelDB keeps in its directory
+var levelDBFile = regexp.MustCompile(`^(CURRENT(\.bak)?|LOCK|LOG(\.old)?|MANIFEST-\d+|\d+\.(ldb|log|sst|tmp))$`)
+
+// validatePath checks the parent directory and any existing contents of a database path
+func validatePath(path string, opts Options) error {
+	if path == "" {
+		return fmt.Errorf("leveldb path must not be empty")
+	}
+
+	parent := filepath.Dir(filepath.Clean(path))
+	info, err := os.Stat(parent)
+	switch {
+	case os.IsNotExist(err) && opts.CreateParent:
+		if err := os.MkdirAll(parent, 0o755); err != nil {
+			return fmt.Errorf("creating leveldb parent directory %s: %w", parent, err)
+		}
+	case os.IsNotExist(err):
+		return fmt.Errorf("leveldb parent directory %s does not exist; create it or enable leveldb.create_parent", parent)
+	case err != nil:
+		return fmt.Errorf("checking leveldb parent directory %s: %w", parent, err)
+	case !info.IsDir():
+		return fmt.Errorf("leveldb parent %s is not a directory", parent)
+	}
+
+	probe, err := os.CreateTemp(parent, ".leveldb-write-check-*")
+	if err != nil {
+		return fmt.Errorf("leveldb parent directory %s is not writable: %w", parent, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	info, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking leveldb path %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("leveldb path %s is a file, expected a database directory", path)
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("reading leveldb path %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !levelDBFile.MatchString(entry.Name()) {
+			return fmt.Errorf("leveldb path %s contains %q, which is not a LevelDB file; point leveldb.path at an empty or existing database directory", path, entry.Name())
+		}
+	}
+	return nil
+}
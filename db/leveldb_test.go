@@ -0,0 +1,122 @@
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"dag-project/db"
+	"dag-project/logger"
+)
+
+func TestNewLevelDBWithOptions_ValidatesPath(t *testing.T) {
+	root := t.TempDir()
+
+	missingParent := filepath.Join(root, "missing", "data")
+	if _, err := db.NewLevelDBWithOptions(missingParent, db.Options{}); err == nil ||
+		!strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected missing parent error, got %v", err)
+	}
+
+	ldb, err := db.NewLevelDBWithOptions(missingParent, db.Options{CreateParent: true})
+	if err != nil {
+		t.Fatalf("expected parent to be created, got %v", err)
+	}
+	ldb.Close()
+
+	// reopening an existing database passes validation
+	ldb, err = db.NewLevelDBWithOptions(missingParent, db.Options{})
+	if err != nil {
+		t.Fatalf("expected existing database to open, got %v", err)
+	}
+	ldb.Close()
+
+	foreign := filepath.Join(root, "foreign")
+	os.Mkdir(foreign, 0o755)
+	os.WriteFile(filepath.Join(foreign, "notes.txt"), []byte("hello"), 0o644)
+	if _, err := db.NewLevelDBWithOptions(foreign, db.Options{}); err == nil ||
+		!strings.Contains(err.Error(), "notes.txt") {
+		t.Fatalf("expected foreign file error, got %v", err)
+	}
+}
+
+func TestNewPrefixIterator_StaysInRange(t *testing.T) {
+	ldb, err := db.NewLevelDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer ldb.Close()
+
+	for _, key := range []string{"a", "cp:1", "cp:2", "cp;", "cq", "z"} {
+		ldb.Put([]byte(key), []byte("value"))
+	}
+	iter := ldb.NewPrefixIterator([]byte("cp:"))
+	defer iter.Release()
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	if strings.Join(keys, ",") != "cp:1,cp:2" {
+		t.Fatalf("expected only cp: keys, got %v", keys)
+	}
+}
+
+func TestDeleteAndHas(t *testing.T) {
+	ldb, err := db.NewLevelDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer ldb.Close()
+
+	ldb.Put([]byte("k"), []byte("value"))
+	if ok, err := ldb.Has([]byte("k")); err != nil || !ok {
+		t.Fatalf("expected k to exist, got %v, %v", ok, err)
+	}
+	if err := ldb.Delete([]byte("k")); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if ok, err := ldb.Has([]byte("k")); err != nil || ok {
+		t.Fatalf("expected k to be gone, got %v, %v", ok, err)
+	}
+	// deleting a missing key is a no-op
+	if err := ldb.Delete([]byte("k")); err != nil {
+		t.Fatalf("expected deleting a missing key to succeed, got %v", err)
+	}
+}
+
+func TestCompactionScheduler_AfterWrites(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	ldb, err := db.NewLevelDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer ldb.Close()
+
+	if ldb.StartCompactionScheduler(db.CompactionSchedule{}) != nil {
+		t.Fatal("expected no scheduler without a trigger")
+	}
+
+	c := ldb.StartCompactionScheduler(db.CompactionSchedule{Writes: 10, CheckInterval: 5 * time.Millisecond})
+	defer c.Stop()
+
+	time.Sleep(20 * time.Millisecond)
+	if c.Completed() != 0 {
+		t.Fatalf("expected no compaction before any writes, got %d", c.Completed())
+	}
+
+	for i := 0; i < 10; i++ {
+		ldb.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value"))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for c.Completed() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c.Completed() != 1 {
+		t.Fatalf("expected one compaction after 10 writes, got %d", c.Completed())
+	}
+}
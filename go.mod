@@ -7,6 +7,7 @@ require (
 	github.com/spf13/viper v1.20.1
 	github.com/syndtr/goleveldb v1.0.0
 	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.32.0
 )
 
 require (
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"dag-project/logger"
+
+	"go.uber.org/zap"
+)
+
+// SetReadOnly enables or disables read-only mode
+func (h *Handler) SetReadOnly(enabled bool) {
+	h.readOnly.Store(enabled)
+}
+
+// ReadOnly reports whether mutations are currently rejected
+func (h *Handler) ReadOnly() bool {
+	return h.readOnly.Load()
+}
+
+// SetAdminToken sets the token /admin requests must carry as
+// "Authorization: Bearer <token>"; while it is empty every /admin request is refused
+func (h *Handler) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
+// authorizeAdmin writes a 401 unless the request carries the admin token, returning
+// whether it may proceed
+func (h *Handler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	return authorizeBearer(w, r, h.adminToken, "invalid admin token")
+}
+
+// rejectIfReadOnly writes a 503 response and returns true when read-only mode is on
+func (h *Handler) rejectIfReadOnly(w http.ResponseWriter) bool {
+	if !h.ReadOnly() {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": "service is in read-only mode, mutations are disabled",
+	})
+	return true
+}
+
+// SetReadOnlyMode handles POST requests toggling read-only mode at runtime
+func (h *Handler) SetReadOnlyMode(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "enabled must be true or false"})
+		return
+	}
+
+	h.SetReadOnly(enabled)
+	logger.Logger.Info("Read-only mode changed", zap.Bool("read_only", enabled))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"read_only": enabled})
+}
+
+// ResetStats handles POST requests zeroing the ephemeral runtime statistics, e.g.
+// after a benchmark warm-up. It responds with the values that were discarded.
+// In-flight request counts are live gauges rather than accumulators and are left
+// alone, as are the durable lifetime counters and the node count.
+func (h *Handler) ResetStats(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+	previous := h.DAG.ResetStats()
+	logger.Logger.Info("Runtime stats reset",
+		zap.Float64("tip_selection_latency_ema_ms", previous.TipSelectionLatencyEMA),
+		zap.Int64("tip_selections", previous.TipSelections))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reset": map[string]interface{}{
+			"tip_selection_latency_ema_ms": previous.TipSelectionLatencyEMA,
+			"tip_selections":               previous.TipSelections,
+		},
+	})
+}
+
+// Flush handles POST requests that block until queued weight propagations are applied
+func (h *Handler) Flush(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+	processed := h.DAG.Flush()
+	logger.Logger.Info("Flushed pending work", zap.Int64("processed", processed))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int64{"processed": processed})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// Compression returns middleware that gzips responses for clients sending
+// "Accept-Encoding: gzip". Bodies are buffered until they reach minBytes; smaller
+// responses are sent as-is, so tiny payloads don't pay the CPU cost. level is a
+// gzip level from 1 (fastest) to 9 (smallest).
+func Compression(level, minBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipResponseWriter{ResponseWriter: w, level: level, minBytes: minBytes, status: http.StatusOK}
+			defer gw.finish()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// gzipResponseWriter defers the compression decision until minBytes are written,
+// the handler flushes, or the response ends
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	level    int
+	minBytes int
+	status   int
+	buf      []byte
+	decided  bool
+	gz       *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if !g.decided {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= g.minBytes {
+		if err := g.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush commits to compression so streamed responses start flowing
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		if err := g.startGzip(); err != nil {
+			return
+		}
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if flusher, ok := g.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (g *gzipResponseWriter) startGzip() error {
+	g.decided = true
+	header := g.Header()
+	if header.Get("Content-Encoding") != "" || g.status == http.StatusNoContent || g.status == http.StatusNotModified {
+		return g.writeBuffered()
+	}
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.status)
+
+	gz, err := gzip.NewWriterLevel(g.ResponseWriter, g.level)
+	if err != nil {
+		return err
+	}
+	g.gz = gz
+	_, err = gz.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+func (g *gzipResponseWriter) writeBuffered() error {
+	g.decided = true
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+// finish sends a response that stayed below the threshold uncompressed and closes
+// the gzip stream otherwise
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		g.writeBuffered()
+	}
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
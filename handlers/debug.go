@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"dag-project/db"
+	"dag-project/logger"
+
+	"go.uber.org/zap"
+)
+
+// KeyStore lists raw storage keys; it is satisfied by *db.LevelDB
+type KeyStore interface {
+	Keys(prefix, after []byte, limit int) ([]db.KeyInfo, bool, error)
+}
+
+// EnableDebug exposes the /debug endpoints backed by store. Requests must carry token
+// as "Authorization: Bearer <token>"; an empty token admits no request.
+func (h *Handler) EnableDebug(store KeyStore, token string) {
+	h.debugStore = store
+	h.debugToken = token
+}
+
+// authorizeDebug writes a 404 when debugging is disabled and a 401 when the token
+// doesn't match, returning whether the request may proceed
+func (h *Handler) authorizeDebug(w http.ResponseWriter, r *http.Request) bool {
+	if h.debugStore == nil {
+		http.NotFound(w, r)
+		return false
+	}
+	return authorizeBearer(w, r, h.debugToken, "invalid debug token")
+}
+
+// authorizeBearer checks the request's "Authorization: Bearer <token>" header
+// against token in constant time and writes a 401 carrying message on a mismatch.
+// An empty token admits no request.
+func authorizeBearer(w http.ResponseWriter, r *http.Request, token, message string) bool {
+	given, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if bearer && token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	return false
+}
+
+// DebugKeys handles GET requests listing raw storage keys and their value sizes.
+// Query parameters: prefix filters keys, after is the cursor returned as next by the
+// previous page, limit bounds the page size under the shared paging policy.
+func (h *Handler) DebugKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeDebug(w, r) {
+		return
+	}
+	limit, ok := h.pageLimit(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	keys, more, err := h.debugStore.Keys([]byte(query.Get("prefix")), []byte(query.Get("after")), limit)
+	if err != nil {
+		logger.Logger.Error("Failed to list keys", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	entries := make([]map[string]interface{}, 0, len(keys))
+	for _, k := range keys {
+		entries = append(entries, map[string]interface{}{"key": string(k.Key), "size": k.Size})
+	}
+	response := map[string]interface{}{"keys": entries, "limit": limit}
+	if more {
+		response["next"] = string(keys[len(keys)-1].Key)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dag-project/dag"
+)
+
+// EmptyGraphMode decides how read endpoints answer when the DAG has no nodes
+type EmptyGraphMode int
+
+const (
+	// EmptyGraphError keeps each endpoint's error response (404, or 500 for tip selection)
+	EmptyGraphError EmptyGraphMode = iota
+	// EmptyGraphNoContent answers 204 No Content
+	EmptyGraphNoContent
+	// EmptyGraphNull answers 200 with a JSON null body
+	EmptyGraphNull
+)
+
+// ParseEmptyGraphMode converts a config value into an EmptyGraphMode
+func ParseEmptyGraphMode(s string) (EmptyGraphMode, error) {
+	switch s {
+	case "", "error":
+		return EmptyGraphError, nil
+	case "no_content":
+		return EmptyGraphNoContent, nil
+	case "null":
+		return EmptyGraphNull, nil
+	}
+	return EmptyGraphError, fmt.Errorf("unknown empty graph status %q", s)
+}
+
+// SetEmptyGraphMode sets how read endpoints answer on an empty DAG
+func (h *Handler) SetEmptyGraphMode(mode EmptyGraphMode) {
+	h.emptyGraph = mode
+}
+
+// writeEmptyGraph answers a read that failed because the DAG is empty according to
+// the configured EmptyGraphMode. It reports false, writing nothing, when err has
+// another cause or the mode keeps the endpoint's own error response.
+func (h *Handler) writeEmptyGraph(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, dag.ErrEmptyGraph) {
+		return false
+	}
+	switch h.emptyGraph {
+	case EmptyGraphNoContent:
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	case EmptyGraphNull:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("null\n"))
+		return true
+	}
+	return false
+}
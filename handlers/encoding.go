@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// weightFields are the JSON keys carrying int64 weights that can exceed 2^53
+var weightFields = map[string]bool{
+	"weight":                     true,
+	"cumulative_weight":          true,
+	"direct_weight":              true,
+	"stored_cumulative_weight":   true,
+	"expected_cumulative_weight": true,
+}
+
+// SetWeightsAsStrings sets the default for emitting weights as JSON strings
+func (h *Handler) SetWeightsAsStrings(enabled bool) {
+	h.weightsAsStrings = enabled
+}
+
+// wantsStringWeights decides the weight encoding for a request. A client can
+// override the configured default with an Accept parameter, e.g.
+// "Accept: application/json; weights=string" or "weights=number".
+func (h *Handler) wantsStringWeights(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch params["weights"] {
+		case "string":
+			return true
+		case "number":
+			return false
+		}
+	}
+	return h.weightsAsStrings
+}
+
+// encodeWeighted writes v as JSON, converting weight fields to strings when the
+// request asks for it so JavaScript clients don't lose precision above 2^53
+func (h *Handler) encodeWeighted(w io.Writer, r *http.Request, v interface{}) error {
+	if !h.wantsStringWeights(r) {
+		return json.NewEncoder(w).Encode(v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(stringifyWeights(generic))
+}
+
+// userFields are the JSON keys holding client-supplied content, which is returned
+// exactly as submitted whatever its keys are called
+var userFields = map[string]bool{
+	"data":        true,
+	"annotations": true,
+}
+
+// stringifyWeights walks decoded JSON replacing numeric weight fields with strings.
+// It descends through the response's objects and lists to reach every node or stat
+// object, but never into a node's data or annotations.
+func stringifyWeights(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if userFields[key] {
+				continue
+			}
+			if number, ok := field.(json.Number); ok && weightFields[key] {
+				value[key] = number.String()
+				continue
+			}
+			value[key] = stringifyWeights(field)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = stringifyWeights(item)
+		}
+	}
+	return v
+}
@@ -1,28 +1,117 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"dag-project/dag"
 	"dag-project/logger"
 	"dag-project/models"
 
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
+// defaultAttachParents is the parent count of an attach request that names none
+const defaultAttachParents = 2
+
+// batchFlushInterval is how many streamed batch results are written between flushes
+const batchFlushInterval = 100
+
+// maxTipSelectionBudget caps the time budget a client may request for one tip selection
+const maxTipSelectionBudget = 5 * time.Second
+
+// mcmcStepsHeader reports how many MCMC walk steps a tip selection ran
+const mcmcStepsHeader = "X-MCMC-Steps"
+
+// maxBulkTips caps how many walks a single bulk tip-selection request may run
+const maxBulkTips = 100
+
+// maxDistinctTips caps how many distinct tips one tip-selection request may ask for
+const maxDistinctTips = 8
+
+// maxAlpha caps the MCMC weight bias a client may request; beyond it the walk is
+// effectively greedy and exp() overflows on modest weight differences
+const maxAlpha = 10.0
+
+// errorStatus maps well-known DAG errors to HTTP status codes, using fallback otherwise
+func errorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, dag.ErrNodeNotFound), errors.Is(err, dag.ErrCheckpointNotFound), errors.Is(err, dag.ErrNoPath):
+		return http.StatusNotFound
+	case errors.Is(err, dag.ErrNodeExists), errors.Is(err, dag.ErrCheckpointExists), errors.Is(err, dag.ErrNoTips),
+		errors.Is(err, dag.ErrNodeImmutable), errors.Is(err, dag.ErrNoQualifyingTips), errors.Is(err, dag.ErrTooFewTips),
+		errors.Is(err, dag.ErrNodeHasDependents):
+		return http.StatusConflict
+	case errors.Is(err, dag.ErrInvalidID), errors.Is(err, dag.ErrInvalidParents), errors.Is(err, dag.ErrMaxDepthExceeded),
+		errors.Is(err, dag.ErrInvalidTimestamp), errors.Is(err, dag.ErrDisconnectedNode), errors.Is(err, dag.ErrNoThreshold),
+		errors.Is(err, dag.ErrInvalidAuthor), errors.Is(err, dag.ErrInvalidAnnotations):
+		return http.StatusBadRequest
+	}
+	return fallback
+}
+
 // Handler contains the HTTP handlers for the DAG API endpoints
 type Handler struct {
 	DAG *dag.DAG
+
+	// readOnly rejects all mutating requests while set
+	readOnly atomic.Bool
+	// weightsAsStrings emits weights as JSON strings unless the client asks otherwise
+	weightsAsStrings bool
+
+	// startedAt is reported as uptime by /status
+	startedAt time.Time
+
+	// in-flight request limits applied by LimitConcurrency
+	reads  *inflightLimit
+	writes *inflightLimit
+
+	// paging policy for list-style endpoints, see pageLimit
+	pageSize    int
+	maxPageSize int
+	// emptyGraph decides how read endpoints answer on an empty DAG
+	emptyGraph EmptyGraphMode
+	// parent count bounds reported early by /nodes/approve, see checkParentCount;
+	// the DAG enforces the same limits on every approval path
+	minParents int
+	maxParents int
+
+	// debugStore backs /debug endpoints, nil while debugging is disabled
+	debugStore KeyStore
+	debugToken string
+	// adminToken guards /admin endpoints, which refuse every request while it is empty
+	adminToken string
 }
 
 // NewHandler creates and returns a new Handler instance
 func NewHandler(d *dag.DAG) *Handler {
-	return &Handler{DAG: d}
+	return &Handler{
+		DAG:         d,
+		startedAt:   time.Now(),
+		reads:       newInflightLimit(0),
+		writes:      newInflightLimit(0),
+		pageSize:    defaultPageSize,
+		maxPageSize: defaultMaxPage,
+		minParents:  defaultMinParents,
+	}
 }
 
 // AddNode handles POST requests to create new nodes in the DAG
 func (h *Handler) AddNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
 	var node models.Node
 	if err := json.NewDecoder(r.Body).Decode(&node); err != nil {
 		logger.Logger.Error("Failed to decode node", zap.Error(err))
@@ -38,7 +127,7 @@ func (h *Handler) AddNode(w http.ResponseWriter, r *http.Request) {
 	if err := h.DAG.AddNode(&node); err != nil {
 		logger.Logger.Error("Failed to add node", zap.Error(err))
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
+		w.WriteHeader(errorStatus(err, http.StatusConflict))
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": err.Error(),
 		})
@@ -49,15 +138,57 @@ func (h *Handler) AddNode(w http.ResponseWriter, r *http.Request) {
 	// Success response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	h.encodeWeighted(w, r, map[string]interface{}{
 		"message": "Node added successfully",
 		"node":    node,
 	})
 	logger.Logger.Info("Node added successfully", zap.String("node_id", node.ID))
 }
 
+// CreateGenesis handles POST requests creating a parentless genesis node. Unlike
+// AddNode it refuses any request that lists parents, making the intent explicit.
+func (h *Handler) CreateGenesis(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var node models.Node
+	if err := json.NewDecoder(r.Body).Decode(&node); err != nil {
+		logger.Logger.Error("Failed to decode genesis node", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request payload"})
+		return
+	}
+	if len(node.Parents) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "genesis nodes cannot have parents, use /nodes/approve instead",
+		})
+		return
+	}
+
+	if err := h.DAG.AddNode(&node); err != nil {
+		logger.Logger.Error("Failed to create genesis node", zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message": "Genesis node created successfully",
+		"node":    node,
+	})
+	logger.Logger.Info("Genesis node created", zap.String("node_id", node.ID))
+}
+
 // This endpoint creates nodes that build upon the existing DAG structure
 func (h *Handler) ApproveNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
 	var node models.Node
 	if err := json.NewDecoder(r.Body).Decode(&node); err != nil {
 		logger.Logger.Error("Failed to decode approve node", zap.Error(err))
@@ -70,22 +201,27 @@ func (h *Handler) ApproveNode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate that approved nodes must have at least one parent
-	if len(node.Parents) == 0 {
-		logger.Logger.Error("Approved node must have at least one parent", zap.String("node_id", node.ID))
+	// Validate the parent count against dag.min_parents and dag.max_parents; a
+	// repeated parent is dropped by the DAG, so only distinct parents count
+	if !h.checkParentCount(w, node.ID, countDistinct(node.Parents)) {
+		return
+	}
+
+	err := h.DAG.ApproveNode(&node)
+	if errors.Is(err, dag.ErrNodeParked) {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusAccepted)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Approved nodes must reference at least one parent node",
+			"message": err.Error(),
+			"id":      node.ID,
 		})
-		logger.Logger.Error("Approved node must have at least one parent", zap.String("node_id", node.ID))
+		logger.Logger.Info("Parked approval", zap.String("node_id", node.ID), zap.Strings("parents", node.Parents))
 		return
 	}
-
-	if err := h.DAG.ApproveNode(&node); err != nil {
+	if err != nil {
 		logger.Logger.Error("Failed to approve node", zap.Error(err))
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(errorStatus(err, http.StatusBadRequest))
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": err.Error(),
 		})
@@ -97,118 +233,1353 @@ func (h *Handler) ApproveNode(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	h.encodeWeighted(w, r, map[string]interface{}{
 		"message": "Node approved successfully",
 		"node":    node,
 	})
 	logger.Logger.Info("Approved new node", zap.String("node_id", node.ID), zap.Strings("parents", node.Parents))
 }
 
-// GetHighestWeightNode handles GET requests to retrieve the node with the highest weight
-func (h *Handler) GetHighestWeightNode(w http.ResponseWriter, r *http.Request) {
-	node, err := h.DAG.GetHighestWeightNode()
-	if err != nil {
-		logger.Logger.Error("Failed to get highest weight node", zap.Error(err))
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": err.Error(),
+// AttachNode handles POST requests that pick tips and approve a node against them atomically
+func (h *Handler) AttachNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	var body struct {
+		ID        string `json:"id"`
+		Count     int    `json:"count"`
+		CreatedBy string `json:"created_by"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Logger.Error("Failed to decode attach node", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request payload"})
+		return
+	}
+	if body.Count == 0 {
+		body.Count = defaultAttachParents
+	}
+	if maxCount := h.attachParentLimit(); body.Count < 0 || body.Count > maxCount {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("count must be between 1 and %d", maxCount),
 		})
 		return
 	}
+
+	node := models.Node{ID: body.ID, CreatedBy: body.CreatedBy}
+	if err := h.DAG.Attach(&node, body.Count, dag.DefaultTipSelectionParams()); err != nil {
+		logger.Logger.Error("Failed to attach node", zap.String("node_id", body.ID), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message": "Node attached successfully",
+		"node":    node,
+	})
+	logger.Logger.Info("Attached new node", zap.String("node_id", node.ID), zap.Strings("parents", node.Parents))
+}
+
+// SubmitNode handles POST requests that approve a node against exactly two MCMC-selected tips
+func (h *Handler) SubmitNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	var body struct {
+		ID        string          `json:"id"`
+		Data      json.RawMessage `json:"data"`
+		CreatedBy string          `json:"created_by"`
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "highest weighted node",
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		logger.Logger.Error("Failed to decode submit node", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request payload"})
+		return
+	}
+
+	node := models.Node{ID: body.ID, Data: body.Data, CreatedBy: body.CreatedBy}
+	if err := h.DAG.Submit(&node, dag.DefaultTipSelectionParams()); err != nil {
+		logger.Logger.Error("Failed to submit node", zap.String("node_id", body.ID), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusBadRequest))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message": "Node submitted successfully",
 		"node":    node,
 	})
-	logger.Logger.Info("Highest weighted node", zap.String("node_id", node.ID))
+	logger.Logger.Info("Submitted new node", zap.String("node_id", node.ID), zap.Strings("parents", node.Parents))
 }
 
-// GetHighestCumulativeWeightNode handles GET requests to retrieve the node with the highest cumulative weight
-func (h *Handler) GetHighestCumulativeWeightNode(w http.ResponseWriter, r *http.Request) {
-	node, err := h.DAG.GetHighestCumulativeWeightNode()
-	if err != nil {
-		logger.Logger.Error("Failed to get highest cumulative weight node", zap.Error(err))
+// ApproveNodesBatch handles POST requests approving many nodes at once, streaming
+// one NDJSON result line per node so clients can track progress and abort early
+func (h *Handler) ApproveNodesBatch(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	var nodes []*models.Node
+	if err := json.NewDecoder(r.Body).Decode(&nodes); err != nil {
+		logger.Logger.Error("Failed to decode approve batch", zap.Error(err))
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": err.Error(),
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Invalid request payload",
 		})
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "highest cumulative weighted node",
-		"node":    node,
-		"weight_info": map[string]interface{}{
-			"direct_weight":     node.Weight,
-			"cumulative_weight": node.CumulativeWeight,
-		},
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	processed := 0
+	err := h.DAG.ApproveBatch(nodes, func(result models.BatchResult) error {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		processed++
+		if flusher != nil && processed%batchFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return r.Context().Err()
 	})
-	logger.Logger.Info("Highest cumulative weighted node", zap.String("node_id", node.ID))
+	if flusher != nil {
+		flusher.Flush()
+	}
+	if err != nil {
+		logger.Logger.Warn("Approve batch aborted", zap.Int("processed", processed), zap.Error(err))
+		return
+	}
+	logger.Logger.Info("Approve batch processed", zap.Int("processed", processed))
 }
 
-// GetTipMCMC handles GET requests for a tip selected using MCMC
-func (h *Handler) GetTipMCMC(w http.ResponseWriter, r *http.Request) {
-	tip, err := h.DAG.TipSelection()
-	w.Header().Set("Content-Type", "application/json")
+// NodeExists handles HEAD requests reporting whether a node is present, without a
+// body. Like GetNode, archived nodes only count as present with include_deleted=true.
+func (h *Handler) NodeExists(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	includeDeleted := false
+	if raw := r.URL.Query().Get("include_deleted"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		includeDeleted = parsed
+	}
+
+	node, err := h.DAG.GetNode(id)
+	if err == nil && node.Deleted && !includeDeleted {
+		err = fmt.Errorf("%w: node %s is archived, use include_deleted=true", dag.ErrNodeNotFound, id)
+	}
 	if err != nil {
-		logger.Logger.Error("Failed to select tip with MCMC", zap.Error(err))
+		status := errorStatus(err, http.StatusInternalServerError)
+		if status != http.StatusNotFound {
+			logger.Logger.Error("Failed to check node existence", zap.String("node_id", id), zap.Error(err))
+		}
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetNode handles GET requests for a single node. The response carries a strong ETag
+// over the exact body, which covers weight and cumulative weight, and a matching
+// If-None-Match is answered with 304 so pollers skip unchanged nodes. With
+// verify=true the node's stored weights are also checked against the live graph and
+// the result is added as a consistency object.
+func (h *Handler) GetNode(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	verify := false
+	if raw := r.URL.Query().Get("verify"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "verify must be true or false"})
+			return
+		}
+		verify = parsed
+	}
+	includeDeleted := false
+	if raw := r.URL.Query().Get("include_deleted"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "include_deleted must be true or false"})
+			return
+		}
+		includeDeleted = parsed
+	}
+
+	var response interface{}
+	var node *models.Node
+	var err error
+	if verify {
+		var consistency *models.NodeConsistency
+		node, consistency, err = h.DAG.VerifyNode(id)
+		response = struct {
+			*models.Node
+			Consistency *models.NodeConsistency `json:"consistency"`
+		}{node, consistency}
+	} else {
+		node, err = h.DAG.GetNode(id)
+		response = node
+	}
+	// archived nodes are only served on request
+	if err == nil && node.Deleted && !includeDeleted {
+		err = fmt.Errorf("%w: node %s is archived, use include_deleted=true", dag.ErrNodeNotFound, id)
+	}
+	if err != nil {
+		status := errorStatus(err, http.StatusInternalServerError)
+		if status == http.StatusNotFound {
+			logger.Logger.Info("Node not found", zap.String("node_id", id), zap.Error(err))
+		} else {
+			logger.Logger.Error("Failed to get node", zap.String("node_id", id), zap.Error(err))
+		}
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	logger.Logger.Info("Retrieved node", zap.String("node_id", id))
 
+	var body bytes.Buffer
+	if err := h.encodeWeighted(&body, r, response); err != nil {
+		logger.Logger.Error("Failed to encode node", zap.String("node_id", id), zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": err.Error(),
-		})
 		return
 	}
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Accept")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(tip)
-	logger.Logger.Info("Tip selected using MCMC", zap.String("node_id", tip.ID))
+	w.Write(body.Bytes())
 }
 
-// CreateCheckpoint handles POST requests to create a new checkpoint
-func (h *Handler) CreateCheckpoint(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		ID string `json:"id"`
+// etagMatches reports whether an If-None-Match header matches etag, using the weak
+// comparison RFC 9110 prescribes for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ID == "" {
+	return false
+}
+
+// IsReachable handles GET requests asking whether the node in the query parameter
+// from is an ancestor of the node in the path
+func (h *Handler) IsReachable(w http.ResponseWriter, r *http.Request) {
+	descendant := mux.Vars(r)["id"]
+	ancestor := r.URL.Query().Get("from")
+	w.Header().Set("Content-Type", "application/json")
+
+	if ancestor == "" {
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		json.NewEncoder(w).Encode(map[string]string{"error": "from is required"})
 		return
 	}
 
-	cp, err := h.DAG.CreateCheckpoint(body.ID)
+	reachable, err := h.DAG.IsAncestor(ancestor, descendant)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.Logger.Error("Failed to check reachability",
+			zap.String("from", ancestor), zap.String("node_id", descendant), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(cp)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        descendant,
+		"from":      ancestor,
+		"reachable": reachable,
+	})
 }
 
-// Get LatestCheckpoint handles GET requests for the latest checkpoint
-func (h *Handler) GetLatestCheckpoint(w http.ResponseWriter, r *http.Request) {
-	cp, err := h.DAG.GetLatestCheckpoint()
-	if err != nil || cp == nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "No checkpoint found"})
+// GetLineage handles GET requests for a node's ancestors annotated with their distance
+func (h *Handler) GetLineage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	lineage, err := h.DAG.Lineage(id)
+	if err != nil {
+		logger.Logger.Error("Failed to compute node lineage", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(cp)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"id":      id,
+		"lineage": lineage,
+	})
 }
 
-// GetSyncState handles GET requests for the current DAG sync state
-func (h *Handler) GetSyncState(w http.ResponseWriter, r *http.Request) {
-	state, err := h.DAG.GetSyncState()
+// GetSiblings handles GET requests for the nodes sharing a parent with a node
+func (h *Handler) GetSiblings(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	siblings, err := h.DAG.GetSiblings(id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.Logger.Error("Failed to find node siblings", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(state)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"id":       id,
+		"siblings": siblings,
+	})
+}
+
+// GetPath handles GET requests for a shortest approval path between the nodes in
+// the from and to query parameters
+func (h *Handler) GetPath(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	w.Header().Set("Content-Type", "application/json")
+
+	if from == "" || to == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "from and to are required"})
+		return
+	}
+
+	path, err := h.DAG.FindPath(from, to)
+	if err != nil {
+		logger.Logger.Error("Failed to find path",
+			zap.String("from", from), zap.String("to", to), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":   path,
+		"length": len(path),
+	})
+}
+
+// GetAncestors handles GET requests for every node reachable upward from a node
+func (h *Handler) GetAncestors(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	ancestors, err := h.DAG.GetAncestors(id)
+	if err != nil {
+		logger.Logger.Error("Failed to find node ancestors", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"id":        id,
+		"ancestors": ancestors,
+		"count":     len(ancestors),
+	})
+}
+
+// GetNodeProof handles GET requests for a node's Merkle inclusion proof
+func (h *Handler) GetNodeProof(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	proof, err := h.DAG.MerkleInclusionProof(id)
+	if err != nil {
+		logger.Logger.Error("Failed to build Merkle proof", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(proof)
+}
+
+// GetDescendants handles GET requests for every node reachable downward from a node
+func (h *Handler) GetDescendants(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	descendants, err := h.DAG.GetDescendants(id)
+	if err != nil {
+		logger.Logger.Error("Failed to find node descendants", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"id":          id,
+		"descendants": descendants,
+		"count":       len(descendants),
+	})
+}
+
+// GetDepthBelow handles GET requests for a node's longest descendant path and confirmation status
+func (h *Handler) GetDepthBelow(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	depth, confirmed, err := h.DAG.DepthBelow(id)
+	if err != nil {
+		logger.Logger.Error("Failed to compute depth below node", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":          id,
+		"depth_below": depth,
+		"confirmed":   confirmed,
+	})
+}
+
+// ReparentNode handles POST requests replacing a node's parents and fixing up weights
+func (h *Handler) ReparentNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		Parents []string `json:"parents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid request body"})
+		return
+	}
+
+	node, err := h.DAG.Reparent(id, body.Parents)
+	if err != nil {
+		logger.Logger.Error("Failed to reparent node", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message": "Node reparented successfully",
+		"node":    node,
+	})
+	logger.Logger.Info("Node reparented", zap.String("node_id", id), zap.Strings("parents", node.Parents))
+}
+
+// ArchiveNode handles POST requests soft-deleting a node
+func (h *Handler) ArchiveNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	node, err := h.DAG.ArchiveNode(id)
+	if err != nil {
+		logger.Logger.Error("Failed to archive node", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message": "Node archived successfully",
+		"node":    node,
+	})
+	logger.Logger.Info("Node archived", zap.String("node_id", id))
+}
+
+// DeleteNode handles DELETE requests removing a node that no other node approves
+func (h *Handler) DeleteNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := h.DAG.DeleteNode(id); err != nil {
+		logger.Logger.Error("Failed to delete node", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Node deleted successfully",
+		"id":      id,
+	})
+	logger.Logger.Info("Node deleted", zap.String("node_id", id))
+}
+
+// DeleteNodesBatch handles POST requests removing a set of nodes atomically, children
+// before parents; the whole set is rejected if a node outside it depends on it
+func (h *Handler) DeleteNodesBatch(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		logger.Logger.Warn("Invalid delete batch payload", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "ids must be a non-empty list of node IDs"})
+		return
+	}
+
+	deleted, err := h.DAG.DeleteNodes(req.IDs)
+	if err != nil {
+		logger.Logger.Error("Failed to delete node batch", zap.Int("count", len(req.IDs)), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Nodes deleted successfully",
+		"deleted": deleted,
+		"count":   len(deleted),
+	})
+	logger.Logger.Info("Node batch deleted", zap.Strings("node_ids", deleted))
+}
+
+// AnnotateNode handles PATCH requests merging a JSON object into a node's annotations;
+// a null value removes the key
+func (h *Handler) AnnotateNode(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+
+	var patch map[string]*string
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		logger.Logger.Error("Failed to decode annotations", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request payload"})
+		return
+	}
+
+	node, err := h.DAG.AnnotateNode(id, patch)
+	if err != nil {
+		logger.Logger.Error("Failed to annotate node", zap.String("node_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message": "Node annotated successfully",
+		"node":    node,
+	})
+	logger.Logger.Info("Node annotated", zap.String("node_id", id))
+}
+
+// GetHighestWeightNode handles GET requests to retrieve the node with the highest weight
+func (h *Handler) GetHighestWeightNode(w http.ResponseWriter, r *http.Request) {
+	node, err := h.DAG.GetHighestWeightNode()
+	if h.writeEmptyGraph(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to get highest weight node", zap.Error(err))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message": "highest weighted node",
+		"node":    node,
+	})
+	logger.Logger.Info("Highest weighted node", zap.String("node_id", node.ID))
+}
+
+// GetHighestCumulativeWeightNode handles GET requests to retrieve the node with the highest
+// cumulative weight. Stored weights are trusted unless verified=true asks for them to be
+// recomputed from the graph.
+func (h *Handler) GetHighestCumulativeWeightNode(w http.ResponseWriter, r *http.Request) {
+	verified := false
+	if raw := r.URL.Query().Get("verified"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "verified must be true or false"})
+			return
+		}
+		verified = parsed
+	}
+
+	var node *models.Node
+	var err error
+	if verified {
+		node, err = h.DAG.GetHighestCumulativeWeightNodeVerified()
+	} else {
+		node, err = h.DAG.GetHighestCumulativeWeightNode()
+	}
+	if h.writeEmptyGraph(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to get highest cumulative weight node", zap.Error(err))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"message":  "highest cumulative weighted node",
+		"node":     node,
+		"verified": verified,
+		"weight_info": map[string]interface{}{
+			"direct_weight":     node.Weight,
+			"cumulative_weight": node.CumulativeWeight,
+		},
+	})
+	logger.Logger.Info("Highest cumulative weighted node", zap.String("node_id", node.ID))
+}
+
+// StreamNodes handles GET requests dumping every node as NDJSON straight from the
+// store, flushing every batchFlushInterval nodes. Iteration stops when the client goes away.
+// ?created_by= keeps only one author's nodes.
+func (h *Handler) StreamNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	author := r.URL.Query().Get("created_by")
+	flusher, _ := w.(http.Flusher)
+	streamed := 0
+	err := h.DAG.StreamNodes(func(node *models.Node) error {
+		if author != "" && node.CreatedBy != author {
+			return nil
+		}
+		if err := h.encodeWeighted(w, r, node); err != nil {
+			return err
+		}
+		streamed++
+		if flusher != nil && streamed%batchFlushInterval == 0 {
+			flusher.Flush()
+		}
+		return r.Context().Err()
+	})
+	if flusher != nil {
+		flusher.Flush()
+	}
+	if err != nil {
+		logger.Logger.Warn("Node stream aborted", zap.Int("streamed", streamed), zap.Error(err))
+		return
+	}
+	logger.Logger.Info("Node stream finished", zap.Int("streamed", streamed))
+}
+
+// ListNodes handles GET requests for one page of nodes in the configured listing
+// order (by default created_at, then ID), which keeps offsets stable between pages.
+// Archived nodes are left out unless include_deleted=true, and ?created_by= keeps
+// only one author's nodes.
+func (h *Handler) ListNodes(w http.ResponseWriter, r *http.Request) {
+	limit, ok := h.pageLimit(w, r)
+	if !ok {
+		return
+	}
+	offset, ok := pageOffset(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	includeDeleted := false
+	if raw := r.URL.Query().Get("include_deleted"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "include_deleted must be true or false"})
+			return
+		}
+		includeDeleted = parsed
+	}
+
+	nodes, err := h.DAG.ListNodes()
+	if err != nil {
+		logger.Logger.Error("Failed to list nodes", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	author := r.URL.Query().Get("created_by")
+	if !includeDeleted || author != "" {
+		kept := nodes[:0]
+		for _, n := range nodes {
+			if (includeDeleted || !n.Deleted) && (author == "" || n.CreatedBy == author) {
+				kept = append(kept, n)
+			}
+		}
+		nodes = kept
+	}
+
+	total := len(nodes)
+	page := []*models.Node{}
+	if offset < total {
+		page = nodes[offset:min(offset+limit, total)]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"nodes":  page,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetLongestChain handles GET requests for the longest genesis-to-tip path
+func (h *Handler) GetLongestChain(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	chain, err := h.DAG.LongestChain()
+	if h.writeEmptyGraph(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to compute longest chain", zap.Error(err))
+		if errors.Is(err, dag.ErrCycleDetected) {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"length": len(chain),
+		"chain":  chain,
+	})
+}
+
+// GetTipMCMC handles GET requests for a tip selected using MCMC
+func (h *Handler) GetTipMCMC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := dag.DefaultTipSelectionParams()
+	if raw := r.URL.Query().Get("alpha"); raw != "" {
+		alpha, err := strconv.ParseFloat(raw, 64)
+		if err != nil || !(alpha > 0 && alpha <= maxAlpha) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("alpha must be a number greater than 0 and at most %g", maxAlpha),
+			})
+			return
+		}
+		params.Alpha = alpha
+	}
+	if raw := r.URL.Query().Get("exploration"); raw != "" {
+		exploration, err := strconv.ParseFloat(raw, 64)
+		if err != nil || exploration < 0 || exploration > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "exploration must be a number between 0 and 1"})
+			return
+		}
+		params.Exploration = exploration
+	}
+	// budget alone lifts the step bound; with max_steps too, whichever hits first wins
+	if raw := r.URL.Query().Get("budget"); raw != "" {
+		budget, err := time.ParseDuration(raw)
+		if err != nil || budget <= 0 || budget > maxTipSelectionBudget {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("budget must be a duration between 0 and %s", maxTipSelectionBudget),
+			})
+			return
+		}
+		params.Budget = budget
+		params.MaxSteps = 0
+	}
+	if raw := r.URL.Query().Get("max_steps"); raw != "" {
+		maxSteps, err := strconv.Atoi(raw)
+		if err != nil || maxSteps <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "max_steps must be a positive integer"})
+			return
+		}
+		params.MaxSteps = maxSteps
+	}
+	if raw := r.URL.Query().Get("min_weight"); raw != "" {
+		minWeight, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || minWeight < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "min_weight must be a non-negative integer"})
+			return
+		}
+		params.MinWeight = minWeight
+	}
+
+	if raw := r.URL.Query().Get("count"); raw != "" {
+		count, err := strconv.Atoi(raw)
+		if err != nil || count <= 0 || count > maxDistinctTips {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("count must be between 1 and %d", maxDistinctTips),
+			})
+			return
+		}
+		h.writeDistinctTips(w, r, params, count)
+		return
+	}
+
+	tip, steps, err := h.DAG.TipSelectionWithSteps(params)
+	if h.writeEmptyGraph(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to select tip with MCMC", zap.Error(err))
+		w.Header().Set("Content-Type", "application/json")
+
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	w.Header().Set(mcmcStepsHeader, strconv.Itoa(steps))
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, tip)
+	logger.Logger.Info("Tip selected using MCMC", zap.String("node_id", tip.ID))
+}
+
+// writeDistinctTips answers a tip selection with count set: up to count distinct tips,
+// with distinct false when fewer could be reached
+func (h *Handler) writeDistinctTips(w http.ResponseWriter, r *http.Request, params dag.TipSelectionParams, count int) {
+	tips, steps, err := h.DAG.TipSelectionDistinct(params, count)
+	if h.writeEmptyGraph(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to select tips with MCMC", zap.Int("count", count), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set(mcmcStepsHeader, strconv.Itoa(steps))
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"tips":     tips,
+		"count":    len(tips),
+		"distinct": len(tips) == count,
+	})
+	logger.Logger.Info("Tips selected using MCMC", zap.Int("requested", count), zap.Int("selected", len(tips)))
+}
+
+// GetTips handles GET requests listing every current tip with their count, or with
+// ?sample=n a weighted sample of up to n distinct tips
+func (h *Handler) GetTips(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var tips []*models.Node
+	var err error
+	if raw := r.URL.Query().Get("sample"); raw != "" {
+		n, parseErr := strconv.Atoi(raw)
+		if parseErr != nil || n <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "sample must be a positive integer"})
+			return
+		}
+		if tips, err = h.DAG.SelectTips(n); errors.Is(err, dag.ErrEmptyGraph) {
+			tips, err = []*models.Node{}, nil
+		}
+	} else {
+		tips, err = h.DAG.GetTips()
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to list tips", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"tips":  tips,
+		"count": len(tips),
+	})
+}
+
+// GetTopological handles GET requests returning every node in topological order,
+// parents before children, so clients can replay the DAG deterministically.
+// Archived nodes are left out unless include_deleted=true.
+func (h *Handler) GetTopological(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	includeDeleted := false
+	if raw := r.URL.Query().Get("include_deleted"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "include_deleted must be true or false"})
+			return
+		}
+		includeDeleted = parsed
+	}
+
+	nodes, err := h.DAG.TopologicalSort()
+	if err != nil {
+		logger.Logger.Error("Failed to sort nodes topologically", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if !includeDeleted {
+		live := nodes[:0]
+		for _, n := range nodes {
+			if !n.Deleted {
+				live = append(live, n)
+			}
+		}
+		nodes = live
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"nodes": nodes,
+		"count": len(nodes),
+	})
+}
+
+// GetTipsBulk handles POST requests running many independent MCMC walks in one call,
+// amortizing request overhead for clients that need a stream of tips
+func (h *Handler) GetTipsBulk(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	defaults := dag.DefaultTipSelectionParams()
+	body := struct {
+		Count       int      `json:"count"`
+		Alpha       *float64 `json:"alpha"`
+		MaxSteps    int      `json:"max_steps"`
+		Exploration float64  `json:"exploration"`
+		Budget      string   `json:"budget"`
+		MinWeight   int64    `json:"min_weight"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request payload"})
+		return
+	}
+	if body.Count <= 0 || body.Count > maxBulkTips {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("count must be between 1 and %d", maxBulkTips),
+		})
+		return
+	}
+	if body.Exploration < 0 || body.Exploration > 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "exploration must be a number between 0 and 1"})
+		return
+	}
+	if body.Alpha != nil && !(*body.Alpha > 0 && *body.Alpha <= maxAlpha) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("alpha must be a number greater than 0 and at most %g", maxAlpha),
+		})
+		return
+	}
+	if body.MaxSteps < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "max_steps must be a positive integer"})
+		return
+	}
+	if body.MinWeight < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "min_weight must be a non-negative integer"})
+		return
+	}
+
+	params := dag.TipSelectionParams{
+		Alpha:       defaults.Alpha,
+		MaxSteps:    defaults.MaxSteps,
+		Exploration: body.Exploration,
+		MinWeight:   body.MinWeight,
+	}
+	if body.Alpha != nil {
+		params.Alpha = *body.Alpha
+	}
+	// the budget bounds each walk, so all walks together must fit the per-request cap
+	if body.Budget != "" {
+		budget, err := time.ParseDuration(body.Budget)
+		if err != nil || budget <= 0 || budget*time.Duration(body.Count) > maxTipSelectionBudget {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("budget must be a positive duration and count x budget at most %s", maxTipSelectionBudget),
+			})
+			return
+		}
+		params.Budget = budget
+		params.MaxSteps = 0
+	}
+	if body.MaxSteps > 0 {
+		params.MaxSteps = body.MaxSteps
+	}
+
+	tips, steps, err := h.DAG.TipSelectionBulk(body.Count, params)
+	if h.writeEmptyGraph(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Logger.Error("Failed to select tips in bulk", zap.Int("count", body.Count), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set(mcmcStepsHeader, strconv.Itoa(steps))
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"count": len(tips),
+		"tips":  tips,
+	})
+}
+
+// GetPending handles GET requests listing approvals parked until their parents arrive
+func (h *Handler) GetPending(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	pending, err := h.DAG.PendingNodes()
+	if err != nil {
+		logger.Logger.Error("Failed to list pending nodes", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	h.encodeWeighted(w, r, map[string]interface{}{
+		"count":   len(pending),
+		"pending": pending,
+	})
+}
+
+// CreateCheckpoint handles POST requests to create a new checkpoint
+func (h *Handler) CreateCheckpoint(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// without an ID the checkpoint is content-addressed and retries return the existing one
+	cp, created, err := h.DAG.CreateCheckpoint(body.ID)
+	if err != nil {
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(cp)
+}
+
+// Get LatestCheckpoint handles GET requests for the latest checkpoint
+func (h *Handler) GetLatestCheckpoint(w http.ResponseWriter, r *http.Request) {
+	cp, err := h.DAG.GetLatestCheckpoint()
+	if err != nil || cp == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "No checkpoint found"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cp)
+}
+
+// GetCheckpointDiff handles GET requests comparing the checkpoints named by ?from= and ?to=
+func (h *Handler) GetCheckpointDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" || to == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "from and to checkpoint IDs are required"})
+		return
+	}
+
+	diff, err := h.DAG.CheckpointDiff(from, to)
+	if err != nil {
+		logger.Logger.Error("Failed to diff checkpoints", zap.String("from", from), zap.String("to", to), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(diff)
+}
+
+// VerifyCheckpoint handles GET requests recomputing a checkpoint's root over the current nodes
+func (h *Handler) VerifyCheckpoint(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id := mux.Vars(r)["id"]
+
+	cp, err := h.DAG.GetCheckpoint(id)
+	if err != nil {
+		logger.Logger.Error("Failed to load checkpoint", zap.String("checkpoint_id", id), zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	valid, err := h.DAG.VerifyCheckpoint(cp)
+	if err != nil {
+		logger.Logger.Error("Failed to verify checkpoint", zap.String("checkpoint_id", id), zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"checkpoint_id": cp.ID,
+		"root_hash":     cp.RootHash,
+		"root_format":   cp.RootFormat,
+		"valid":         valid,
+	})
+}
+
+// GetSyncState handles GET requests for the current DAG sync state
+func (h *Handler) GetSyncState(w http.ResponseWriter, r *http.Request) {
+	state, err := h.DAG.GetSyncState()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(state)
+}
+
+// GetStats handles GET requests for runtime statistics and a summary of the graph
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	summary, err := h.DAG.Summary()
+	if err != nil {
+		logger.Logger.Error("Failed to summarize the DAG", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	stats := h.DAG.GetStats()
+	stats.GraphSummary = *summary
+	stats.InFlightReads = h.reads.current.Load()
+	stats.InFlightWrites = h.writes.current.Load()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetShapeReport handles GET requests for graph structure analytics
+func (h *Handler) GetShapeReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	report, err := h.DAG.ShapeReport()
+	if err != nil {
+		logger.Logger.Error("Failed to compute shape report", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetConfirmationReport handles GET requests for confirmation-rate analytics
+func (h *Handler) GetConfirmationReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var threshold int64
+	if raw := r.URL.Query().Get("threshold"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "threshold must be a positive integer"})
+			return
+		}
+		threshold = parsed
+	}
+
+	report, err := h.DAG.ConfirmationReport(threshold)
+	if err != nil {
+		logger.Logger.Error("Failed to compute confirmation report", zap.Error(err))
+		w.WriteHeader(errorStatus(err, http.StatusInternalServerError))
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetStatus handles GET requests for a greppable plaintext summary for operators
+func (h *Handler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.DAG.Status()
+	if err != nil {
+		logger.Logger.Error("Failed to read status", zap.Error(err))
+		http.Error(w, "error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	checkpoint := "none"
+	if cp := status.LatestCheckpoint; cp != nil {
+		checkpoint = fmt.Sprintf("%s %s", cp.ID, models.FormatTimestamp(cp.Timestamp))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "uptime: %s\n", time.Since(h.startedAt).Truncate(time.Second))
+	fmt.Fprintf(w, "nodes: %d\n", status.NodeCount)
+	fmt.Fprintf(w, "tips: %d\n", status.TipCount)
+	fmt.Fprintf(w, "latest_checkpoint: %s\n", checkpoint)
+	fmt.Fprintf(w, "read_only: %t\n", h.ReadOnly())
+}
+
+// Health handles liveness probes; it answers 200 as long as the process serves HTTP
+func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Ready handles readiness probes, answering 503 while the storage can't be read
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.DAG.Ping(); err != nil {
+		logger.Logger.Error("Readiness check failed", zap.Error(err))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "unavailable", "error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// GetLifetimeStats handles GET requests for the durable addition/approval counters
+func (h *Handler) GetLifetimeStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	stats, err := h.DAG.GetLifetimeStats()
+	if err != nil {
+		logger.Logger.Error("Failed to read lifetime counters", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// ExportNodes handles GET requests dumping every node for merging into another instance
+func (h *Handler) ExportNodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	export, err := h.DAG.Export()
+	if err != nil {
+		logger.Logger.Error("Failed to export nodes", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(export)
+}
+
+// MergeExport handles POST requests ingesting another instance's export
+func (h *Handler) MergeExport(w http.ResponseWriter, r *http.Request) {
+	if h.rejectIfReadOnly(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var opts dag.MergeOptions
+	if raw := r.URL.Query().Get("preserve_weights"); raw != "" {
+		preserve, err := strconv.ParseBool(raw)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "preserve_weights must be true or false"})
+			return
+		}
+		opts.PreserveWeights = preserve
+	}
+
+	var export models.Export
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		logger.Logger.Error("Failed to decode export", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request payload"})
+		return
+	}
+
+	result, err := h.DAG.MergeWithOptions(&export, opts)
+	if err != nil {
+		logger.Logger.Error("Failed to merge export", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	logger.Logger.Info("Merged export",
+		zap.Int("added", result.Added), zap.Int("skipped", result.Skipped), zap.Int("conflicted", result.Conflicted),
+		zap.Bool("preserve_weights", opts.PreserveWeights))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
 }
@@ -2,18 +2,27 @@ package handlers_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"dag-project/dag"
+	"dag-project/db"
 	"dag-project/handlers"
 	"dag-project/logger"
 	"dag-project/models"
@@ -22,13 +31,25 @@ import (
 )
 
 type mockRepo struct {
-	mu          sync.Mutex
-	nodes       map[string]*models.Node
-	checkpoints map[string]*models.Checkpoint
+	mu               sync.Mutex
+	nodes            map[string]*models.Node
+	checkpoints      map[string]*models.Checkpoint
+	checkpointNodes  map[string]map[string]string
+	checkpointFrozen map[string][]string
+	counters         map[string]uint64
+	parked           map[string]*models.ParkedNode
+	pingErr          error
 }
 
 func newMockRepo() *mockRepo {
-	return &mockRepo{nodes: make(map[string]*models.Node), checkpoints: make(map[string]*models.Checkpoint)}
+	return &mockRepo{
+		nodes:            make(map[string]*models.Node),
+		checkpoints:      make(map[string]*models.Checkpoint),
+		checkpointNodes:  make(map[string]map[string]string),
+		checkpointFrozen: make(map[string][]string),
+		counters:         make(map[string]uint64),
+		parked:           make(map[string]*models.ParkedNode),
+	}
 }
 
 func (m *mockRepo) PutNode(node *models.Node) error {
@@ -39,6 +60,21 @@ func (m *mockRepo) PutNode(node *models.Node) error {
 	return nil
 }
 
+func (m *mockRepo) PutNodeCounted(node *models.Node, counter string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copy := *node
+	m.nodes[node.ID] = &copy
+	m.counters[counter]++
+	return nil
+}
+
+func (m *mockRepo) GetCounter(name string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name], nil
+}
+
 func (m *mockRepo) GetNode(id string) (*models.Node, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -51,6 +87,29 @@ func (m *mockRepo) GetNode(id string) (*models.Node, error) {
 	return &copy, nil
 }
 
+func (m *mockRepo) HasNode(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.nodes[id]
+	return ok, nil
+}
+
+func (m *mockRepo) DeleteNode(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.nodes, id)
+	return nil
+}
+
+func (m *mockRepo) DeleteNodes(ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.nodes, id)
+	}
+	return nil
+}
+
 func (m *mockRepo) GetAllNodes() ([]*models.Node, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -59,9 +118,28 @@ func (m *mockRepo) GetAllNodes() ([]*models.Node, error) {
 		copy := *n
 		res = append(res, &copy)
 	}
+	// key order, like LevelDB, so seeded tip selections are reproducible
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
 	return res, nil
 }
 
+func (m *mockRepo) EachNode(fn func(*models.Node) error) error {
+	nodes, _ := m.GetAllNodes()
+	repository.SortNodes(nodes, repository.OrderCreatedAt)
+	for _, n := range nodes {
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) ListNodes(order repository.NodeOrder) ([]*models.Node, error) {
+	nodes, _ := m.GetAllNodes()
+	repository.SortNodes(nodes, order)
+	return nodes, nil
+}
+
 func (m *mockRepo) PutCheckpoint(cp *models.Checkpoint) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -70,6 +148,45 @@ func (m *mockRepo) PutCheckpoint(cp *models.Checkpoint) error {
 	return nil
 }
 
+func (m *mockRepo) PutCheckpointWithNodes(cp *models.Checkpoint, digests map[string]string, frozen []string) error {
+	m.PutCheckpoint(cp)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpointNodes[cp.ID] = digests
+	m.checkpointFrozen[cp.ID] = append([]string{}, frozen...)
+	return nil
+}
+
+func (m *mockRepo) GetCheckpointFrozen(id string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkpointFrozen[id], nil
+}
+
+func (m *mockRepo) GetCheckpointNodes(id string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkpointNodes[id], nil
+}
+
+func (m *mockRepo) HasCheckpoint(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.checkpoints[id]
+	return ok, nil
+}
+
+func (m *mockRepo) GetCheckpoint(id string) (*models.Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp, ok := m.checkpoints[id]
+	if !ok {
+		return nil, fmt.Errorf("not found")
+	}
+	c := *cp
+	return &c, nil
+}
+
 func (m *mockRepo) GetLatestCheckpoint() (*models.Checkpoint, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -86,6 +203,48 @@ func (m *mockRepo) GetLatestCheckpoint() (*models.Checkpoint, error) {
 	return latest, nil
 }
 
+func (m *mockRepo) PutParked(p *models.ParkedNode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copy := *p
+	m.parked[p.Node.ID] = &copy
+	return nil
+}
+
+func (m *mockRepo) DeleteParked(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.parked, id)
+	return nil
+}
+
+func (m *mockRepo) GetAllParked() ([]*models.ParkedNode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parked := make([]*models.ParkedNode, 0, len(m.parked))
+	for _, p := range m.parked {
+		copy := *p
+		parked = append(parked, &copy)
+	}
+	return parked, nil
+}
+
+func (m *mockRepo) Ping() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pingErr
+}
+
+// testAdminToken is the admin token testServer configures
+const testAdminToken = "admin-secret"
+
+// adminRequest builds a request to an /admin endpoint carrying testAdminToken
+func adminRequest(method, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
 func testServer() (*mux.Router, *mockRepo) {
 	logger.Logger = zap.NewNop()
 
@@ -93,11 +252,24 @@ func testServer() (*mux.Router, *mockRepo) {
 	var repoInterface repository.NodeRepositoryInterface = mockRepo
 	dag := dag.NewDAG(repoInterface)
 	handler := handlers.NewHandler(dag)
+	handler.SetAdminToken(testAdminToken)
 	router := mux.NewRouter()
 	routers.RegisterRoutes(router, handler)
 	return router, mockRepo
 }
 
+// seededServer is testServer with tip selection seeded from seed
+func seededServer(seed int64) (*mux.Router, *mockRepo) {
+	logger.Logger = zap.NewNop()
+
+	mockRepo := newMockRepo()
+	d := dag.NewDAG(mockRepo)
+	d.SetRandSource(rand.NewSource(seed))
+	router := mux.NewRouter()
+	routers.RegisterRoutes(router, handlers.NewHandler(d))
+	return router, mockRepo
+}
+
 func TestAddNode_Success(t *testing.T) {
 	router, mockRepo := testServer()
 
@@ -148,6 +320,22 @@ func TestAddNode_Duplicate(t *testing.T) {
 	}
 }
 
+func TestAddNode_InvalidID(t *testing.T) {
+	router, mockRepo := testServer()
+
+	for _, id := range []string{"", "checkpoint:x"} {
+		bodyJSON, _ := json.Marshal(map[string]interface{}{"id": id})
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(bodyJSON)))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for id %q, got %d, body: %s", id, res.Code, res.Body.String())
+		}
+	}
+	if nodes, _ := mockRepo.GetAllNodes(); len(nodes) != 0 {
+		t.Fatalf("expected no node to be stored, got %d", len(nodes))
+	}
+}
+
 func TestApproveNode_SuccessAndParentWeightIncrement(t *testing.T) {
 	router, mockRepo := testServer()
 
@@ -450,75 +638,74 @@ func TestCumulativeWeight_ChainScenario(t *testing.T) {
 	if weightInfo["cumulative_weight"] != float64(2) {
 		t.Fatalf("Expected cumulative weight 2, got %v", weightInfo["cumulative_weight"])
 	}
-}
 
-func TestGetTipMCMC_WeightBasedSelection(t *testing.T) {
-	router, _ := testServer()
-	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
-	nodeAJSON, _ := json.Marshal(nodeA)
-	respCreateA := httptest.NewRecorder()
-	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
-	if respCreateA.Code != http.StatusCreated {
-		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	respVerified := httptest.NewRecorder()
+	router.ServeHTTP(respVerified, httptest.NewRequest(http.MethodGet, "/nodes/highest-cumulative-weight?verified=true", nil))
+	if respVerified.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for verified=true, got %d", respVerified.Code)
 	}
-
-	nodeB := map[string]interface{}{"id": "B", "parents": []string{"A"}}
-	nodeBJSON, _ := json.Marshal(nodeB)
-	respApproveB := httptest.NewRecorder()
-	router.ServeHTTP(respApproveB, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(nodeBJSON)))
-	if respApproveB.Code != http.StatusCreated {
-		t.Fatalf("Failed to approve node B: %d", respApproveB.Code)
+	var verifiedResponse map[string]interface{}
+	if err := json.Unmarshal(respVerified.Body.Bytes(), &verifiedResponse); err != nil {
+		t.Fatalf("Failed to parse verified response: %v", err)
 	}
-
-	nodeC := map[string]interface{}{"id": "C", "parents": []string{"B"}}
-	nodeCJSON, _ := json.Marshal(nodeC)
-	respApproveC := httptest.NewRecorder()
-	router.ServeHTTP(respApproveC, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(nodeCJSON)))
-	if respApproveC.Code != http.StatusCreated {
-		t.Fatalf("Failed to approve node C: %d", respApproveC.Code)
+	if verifiedResponse["verified"] != true || verifiedResponse["node"].(map[string]interface{})["id"] != "1" {
+		t.Fatalf("Expected verified answer for node 1, got %v", verifiedResponse)
 	}
 
-	nodeD := map[string]interface{}{"id": "D", "parents": []string{"A"}}
-	nodeDJSON, _ := json.Marshal(nodeD)
-	respApproveD := httptest.NewRecorder()
-	router.ServeHTTP(respApproveD, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(nodeDJSON)))
-	if respApproveD.Code != http.StatusCreated {
-		t.Fatalf("Failed to approve node D: %d", respApproveD.Code)
+	respInvalid := httptest.NewRecorder()
+	router.ServeHTTP(respInvalid, httptest.NewRequest(http.MethodGet, "/nodes/highest-cumulative-weight?verified=maybe", nil))
+	if respInvalid.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for verified=maybe, got %d", respInvalid.Code)
 	}
+}
 
-	tipSelections := make(map[string]int)
-	numSelections := 20
-
-	for i := 0; i < numSelections; i++ {
-		respTipSelection := httptest.NewRecorder()
-		router.ServeHTTP(respTipSelection, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection", nil))
-		if respTipSelection.Code != http.StatusOK {
-			t.Fatalf("Expected status 200, got %d, body: %s", respTipSelection.Code, respTipSelection.Body.String())
+func TestGetTipMCMC_WeightBasedSelection(t *testing.T) {
+	// A <- B <- C and A <- D: tips C and D
+	selections := func() []string {
+		router, _ := seededServer(7)
+		nodeAJSON, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+		respCreateA := httptest.NewRecorder()
+		router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+		if respCreateA.Code != http.StatusCreated {
+			t.Fatalf("Failed to add node A: %d", respCreateA.Code)
 		}
-
-		var selectedTip models.Node
-		if err := json.Unmarshal(respTipSelection.Body.Bytes(), &selectedTip); err != nil {
-			t.Fatalf("Invalid JSON response: %v", err)
+		for _, approval := range []map[string]interface{}{
+			{"id": "B", "parents": []string{"A"}},
+			{"id": "C", "parents": []string{"B"}},
+			{"id": "D", "parents": []string{"A"}},
+		} {
+			approvalJSON, _ := json.Marshal(approval)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approvalJSON)))
+			if resp.Code != http.StatusCreated {
+				t.Fatalf("Failed to approve node %v: %d", approval["id"], resp.Code)
+			}
 		}
 
-		tipSelections[selectedTip.ID]++
+		var ids []string
+		for i := 0; i < 20; i++ {
+			respTipSelection := httptest.NewRecorder()
+			router.ServeHTTP(respTipSelection, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection", nil))
+			if respTipSelection.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d, body: %s", respTipSelection.Code, respTipSelection.Body.String())
+			}
+			var selectedTip models.Node
+			if err := json.Unmarshal(respTipSelection.Body.Bytes(), &selectedTip); err != nil {
+				t.Fatalf("Invalid JSON response: %v", err)
+			}
+			ids = append(ids, selectedTip.ID)
+		}
+		return ids
 	}
 
-	// Verify that both tips C and D were selected (since they're both valid tips)
-	if tipSelections["C"] == 0 {
-		t.Fatalf("Tip C was never selected, got selections: %v", tipSelections)
+	// with a pinned source the walk is reproducible, so exact tips can be asserted
+	first, second := selections(), selections()
+	if strings.Join(first, "") != strings.Join(second, "") {
+		t.Fatalf("Expected the same selections from the same seed, got %v and %v", first, second)
 	}
-	if tipSelections["D"] == 0 {
-		t.Fatalf("Tip D was never selected, got selections: %v", tipSelections)
-	}
-
-	// The MCMC should show some variation in selection, not always pick the same tip
-	if tipSelections["C"] == numSelections || tipSelections["D"] == numSelections {
-		t.Logf("Warning: MCMC always selected the same tip, selections: %v", tipSelections)
-		t.Logf("This might indicate the algorithm is not properly randomizing, but it's not necessarily wrong")
+	if got := strings.Join(first, ""); got != "DDDCCDDCDDCCCDDDCCCD" {
+		t.Fatalf("Unexpected selections for seed 7: %s", got)
 	}
-
-	t.Logf("Tip selection distribution: %v", tipSelections)
 }
 
 func TestCreateCheckpoint_Success(t *testing.T) {
@@ -576,7 +763,7 @@ func TestCreateCheckpoint_Success(t *testing.T) {
 func TestCreateCheckpoint_InvalidBody(t *testing.T) {
 	router, _ := testServer()
 	resp := httptest.NewRecorder()
-	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{}`))))
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{"id":`))))
 	if resp.Code != http.StatusBadRequest {
 		t.Fatalf("expected 400 for invalid body, got %d", resp.Code)
 	}
@@ -634,3 +821,2470 @@ func TestGetLatestCheckpoint_ReturnsLatest(t *testing.T) {
 		t.Fatalf("expected latest checkpoint cp2, got %s", got.ID)
 	}
 }
+
+func TestGetStats_GraphSummary(t *testing.T) {
+	router, _ := testServer()
+
+	for _, body := range []string{`{"id":"1"}`, `{"id":"2","parents":["1"]}`, `{"id":"3","parents":["2"]}`} {
+		path := "/nodes/approve"
+		if !strings.Contains(body, "parents") {
+			path = "/nodes"
+		}
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	var stats models.Stats
+	if err := json.Unmarshal(resp.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if stats.NodeCount != 3 || stats.TipCount != 1 || stats.MaxDepth != 2 || stats.HighestCumulativeWeightID != "1" {
+		t.Fatalf("Unexpected graph summary: %+v", stats.GraphSummary)
+	}
+	if stats.LatestCheckpointID != "" {
+		t.Fatalf("Expected no checkpoint, got %q", stats.LatestCheckpointID)
+	}
+}
+
+func TestGetStats_TipSelectionLatency(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		respTip := httptest.NewRecorder()
+		router.ServeHTTP(respTip, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection", nil))
+		if respTip.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d, body: %s", respTip.Code, respTip.Body.String())
+		}
+	}
+
+	respStats := httptest.NewRecorder()
+	router.ServeHTTP(respStats, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if respStats.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", respStats.Code, respStats.Body.String())
+	}
+
+	var stats models.Stats
+	if err := json.Unmarshal(respStats.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if stats.TipSelections != 3 {
+		t.Fatalf("Expected 3 tip selections, got %d", stats.TipSelections)
+	}
+	if stats.TipSelectionLatencyEMA <= 0 {
+		t.Fatalf("Expected positive latency average, got %f", stats.TipSelectionLatencyEMA)
+	}
+}
+
+func TestApproveNodesBatch_StreamsResults(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	batch := []map[string]interface{}{
+		{"id": "B", "parents": []string{"A"}},
+		{"id": "C", "parents": []string{"B"}},
+		{"id": "D", "parents": []string{"NOPE"}},
+	}
+	batchJSON, _ := json.Marshal(batch)
+	respBatch := httptest.NewRecorder()
+	router.ServeHTTP(respBatch, httptest.NewRequest(http.MethodPost, "/nodes/approve/batch", bytes.NewReader(batchJSON)))
+	if respBatch.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", respBatch.Code, respBatch.Body.String())
+	}
+	if ct := respBatch.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Expected NDJSON content type, got %s", ct)
+	}
+
+	lines := strings.Split(strings.TrimSpace(respBatch.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 result lines, got %d: %s", len(lines), respBatch.Body.String())
+	}
+
+	expected := []models.BatchResult{
+		{Index: 0, ID: "B", Status: models.BatchStatusApproved},
+		{Index: 1, ID: "C", Status: models.BatchStatusApproved},
+		{Index: 2, ID: "D", Status: models.BatchStatusFailed},
+	}
+	for i, line := range lines {
+		var result models.BatchResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("Invalid result line %q: %v", line, err)
+		}
+		if result.Index != expected[i].Index || result.ID != expected[i].ID || result.Status != expected[i].Status {
+			t.Fatalf("Expected result %v, got %v", expected[i], result)
+		}
+	}
+
+	nodeAFromRepo, err := mockRepo.GetNode("A")
+	if err != nil {
+		t.Fatalf("Node A not found: %v", err)
+	}
+	if nodeAFromRepo.CumulativeWeight != 2 {
+		t.Fatalf("Expected node A cumulative weight 2, got %d", nodeAFromRepo.CumulativeWeight)
+	}
+}
+
+func TestCumulativeWeight_DiamondScenario(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	// A <- B, A <- C, B <- D, C <- D, D <- E
+	approvals := []map[string]interface{}{
+		{"id": "B", "parents": []string{"A"}},
+		{"id": "C", "parents": []string{"A"}},
+		{"id": "D", "parents": []string{"B", "C"}},
+		{"id": "E", "parents": []string{"D"}},
+	}
+	for _, approval := range approvals {
+		approvalJSON, _ := json.Marshal(approval)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approvalJSON)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %v: %d", approval["id"], resp.Code)
+		}
+	}
+
+	nodeAFromRepo, err := mockRepo.GetNode("A")
+	if err != nil {
+		t.Fatalf("Node A not found: %v", err)
+	}
+	// A's direct weight 2 plus B(1), C(1) and D(1) counted once each
+	if nodeAFromRepo.CumulativeWeight != 5 {
+		t.Fatalf("Expected node A cumulative weight 5, got %d", nodeAFromRepo.CumulativeWeight)
+	}
+}
+
+func TestCreateCheckpoint_RecordsHashAlgo(t *testing.T) {
+	router, mockRepo := testServer()
+
+	body := map[string]interface{}{"id": "A", "parents": []string{}}
+	b, _ := json.Marshal(body)
+	respNode := httptest.NewRecorder()
+	router.ServeHTTP(respNode, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(b)))
+	if respNode.Code != http.StatusCreated {
+		t.Fatalf("failed to create node: %d", respNode.Code)
+	}
+
+	respCP := httptest.NewRecorder()
+	router.ServeHTTP(respCP, httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{"id":"cp1"}`))))
+	if respCP.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for checkpoint, got %d, body: %s", respCP.Code, respCP.Body.String())
+	}
+
+	var cp models.Checkpoint
+	if err := json.Unmarshal(respCP.Body.Bytes(), &cp); err != nil {
+		t.Fatalf("invalid checkpoint response: %v", err)
+	}
+	if cp.HashAlgo != dag.HashSHA256 {
+		t.Fatalf("expected default hash_algo %s, got %s", dag.HashSHA256, cp.HashAlgo)
+	}
+
+	if cp.RootFormat != dag.RootFormatMerkle {
+		t.Fatalf("expected root_format %s, got %q", dag.RootFormatMerkle, cp.RootFormat)
+	}
+
+	nodeA, err := mockRepo.GetNode("A")
+	if err != nil {
+		t.Fatalf("Node A not found: %v", err)
+	}
+	if want := dag.ComputeMerkleRoot([]*models.Node{nodeA}); cp.RootHash != want {
+		t.Fatalf("expected root_hash %s, got %s", want, cp.RootHash)
+	}
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	router, _ := testServer()
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", strings.NewReader(`{"id":"A"}`)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/checkpoints", strings.NewReader(`{"id":"cp1"}`)))
+
+	verify := func(id string) (int, map[string]interface{}) {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/checkpoints/"+id+"/verify", nil))
+		var body map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		return resp.Code, body
+	}
+
+	if code, body := verify("cp1"); code != http.StatusOK || body["valid"] != true || body["root_format"] != dag.RootFormatMerkle {
+		t.Fatalf("Expected cp1 to verify, got %d: %v", code, body)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", strings.NewReader(`{"id":"B","parents":["A"]}`)))
+	if code, body := verify("cp1"); code != http.StatusOK || body["valid"] != false {
+		t.Fatalf("Expected cp1 to stop matching after an approval, got %d: %v", code, body)
+	}
+	if code, _ := verify("missing"); code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for an unknown checkpoint, got %d", code)
+	}
+}
+
+func TestGetNodeProof(t *testing.T) {
+	router, _ := testServer()
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", strings.NewReader(`{"id":"A"}`)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", strings.NewReader(`{"id":"B","parents":["A"]}`)))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/B/proof", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	var proof models.MerkleProof
+	if err := json.Unmarshal(resp.Body.Bytes(), &proof); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if proof.NodeID != "B" || proof.Index != 1 || proof.LeafCount != 2 || len(proof.Proof) != 1 {
+		t.Fatalf("Unexpected proof: %+v", proof)
+	}
+
+	respState := httptest.NewRecorder()
+	router.ServeHTTP(respState, httptest.NewRequest(http.MethodGet, "/sync/state", nil))
+	var state models.SyncState
+	json.Unmarshal(respState.Body.Bytes(), &state)
+	if proof.Root != state.RootHash {
+		t.Fatalf("Expected the proof root to match /sync/state, got %s and %s", proof.Root, state.RootHash)
+	}
+
+	respMissing := httptest.NewRecorder()
+	router.ServeHTTP(respMissing, httptest.NewRequest(http.MethodGet, "/nodes/missing/proof", nil))
+	if respMissing.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a missing node, got %d", respMissing.Code)
+	}
+}
+
+func TestNodeExists_Head(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	respFound := httptest.NewRecorder()
+	router.ServeHTTP(respFound, httptest.NewRequest(http.MethodHead, "/nodes/A", nil))
+	if respFound.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for existing node, got %d", respFound.Code)
+	}
+	if respFound.Body.Len() != 0 {
+		t.Fatalf("Expected empty body, got %s", respFound.Body.String())
+	}
+
+	respMissing := httptest.NewRecorder()
+	router.ServeHTTP(respMissing, httptest.NewRequest(http.MethodHead, "/nodes/NOPE", nil))
+	if respMissing.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for missing node, got %d", respMissing.Code)
+	}
+}
+
+func TestNodeExists_HeadArchived(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/B/archive", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("failed to archive B: %d %s", resp.Code, resp.Body.String())
+	}
+
+	// HEAD answers exactly like GET
+	for _, target := range []string{"/nodes/B", "/nodes/B?include_deleted=true", "/nodes/B?include_deleted=nope"} {
+		get := httptest.NewRecorder()
+		router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, target, nil))
+		head := httptest.NewRecorder()
+		router.ServeHTTP(head, httptest.NewRequest(http.MethodHead, target, nil))
+		if head.Code != get.Code {
+			t.Fatalf("HEAD %s: expected %d like GET, got %d", target, get.Code, head.Code)
+		}
+		if head.Body.Len() != 0 {
+			t.Fatalf("HEAD %s: expected empty body, got %s", target, head.Body.String())
+		}
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodHead, "/nodes/B", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an archived node, got %d", resp.Code)
+	}
+}
+
+func TestGetDepthBelow(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	// A <- B <- C, A <- D
+	approvals := []map[string]interface{}{
+		{"id": "B", "parents": []string{"A"}},
+		{"id": "C", "parents": []string{"B"}},
+		{"id": "D", "parents": []string{"A"}},
+	}
+	for _, approval := range approvals {
+		approvalJSON, _ := json.Marshal(approval)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approvalJSON)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %v: %d", approval["id"], resp.Code)
+		}
+	}
+
+	respDepth := httptest.NewRecorder()
+	router.ServeHTTP(respDepth, httptest.NewRequest(http.MethodGet, "/nodes/A/depth-below", nil))
+	if respDepth.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", respDepth.Code, respDepth.Body.String())
+	}
+
+	var depthResponse map[string]interface{}
+	if err := json.Unmarshal(respDepth.Body.Bytes(), &depthResponse); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if depthResponse["depth_below"] != float64(2) {
+		t.Fatalf("Expected depth below A of 2, got %v", depthResponse["depth_below"])
+	}
+
+	respMissing := httptest.NewRecorder()
+	router.ServeHTTP(respMissing, httptest.NewRequest(http.MethodGet, "/nodes/NOPE/depth-below", nil))
+	if respMissing.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for missing node, got %d", respMissing.Code)
+	}
+}
+
+func TestReadOnlyMode_RejectsMutations(t *testing.T) {
+	router, _ := testServer()
+
+	respEnable := httptest.NewRecorder()
+	router.ServeHTTP(respEnable, adminRequest(http.MethodPost, "/admin/read-only?enabled=true"))
+	if respEnable.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 enabling read-only, got %d", respEnable.Code)
+	}
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respRejected := httptest.NewRecorder()
+	router.ServeHTTP(respRejected, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respRejected.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503 in read-only mode, got %d", respRejected.Code)
+	}
+
+	respRead := httptest.NewRecorder()
+	router.ServeHTTP(respRead, httptest.NewRequest(http.MethodGet, "/sync/state", nil))
+	if respRead.Code != http.StatusOK {
+		t.Fatalf("Expected reads to succeed in read-only mode, got %d", respRead.Code)
+	}
+
+	respDisable := httptest.NewRecorder()
+	router.ServeHTTP(respDisable, adminRequest(http.MethodPost, "/admin/read-only?enabled=false"))
+	if respDisable.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 disabling read-only, got %d", respDisable.Code)
+	}
+
+	respAccepted := httptest.NewRecorder()
+	router.ServeHTTP(respAccepted, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respAccepted.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 after leaving read-only mode, got %d", respAccepted.Code)
+	}
+}
+
+func TestApproveNode_DuplicateID(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	nodeB := map[string]interface{}{"id": "B", "parents": []string{"A"}}
+	nodeBJSON, _ := json.Marshal(nodeB)
+	respApproveB := httptest.NewRecorder()
+	router.ServeHTTP(respApproveB, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(nodeBJSON)))
+	if respApproveB.Code != http.StatusCreated {
+		t.Fatalf("Failed to approve node B: %d", respApproveB.Code)
+	}
+
+	// Re-approving A with a parent must not clobber the stored node
+	duplicate := map[string]interface{}{"id": "A", "parents": []string{"B"}}
+	duplicateJSON, _ := json.Marshal(duplicate)
+	respDuplicate := httptest.NewRecorder()
+	router.ServeHTTP(respDuplicate, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(duplicateJSON)))
+	if respDuplicate.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 for duplicate approve, got %d, body: %s", respDuplicate.Code, respDuplicate.Body.String())
+	}
+
+	nodeAFromRepo, err := mockRepo.GetNode("A")
+	if err != nil {
+		t.Fatalf("Node A not found: %v", err)
+	}
+	if nodeAFromRepo.Weight != 1 || len(nodeAFromRepo.Parents) != 0 {
+		t.Fatalf("Expected node A untouched, got weight %d parents %v", nodeAFromRepo.Weight, nodeAFromRepo.Parents)
+	}
+}
+
+func TestMergeExport(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	nodeE := map[string]interface{}{"id": "E", "parents": []string{"A"}}
+	nodeEJSON, _ := json.Marshal(nodeE)
+	respApproveE := httptest.NewRecorder()
+	router.ServeHTTP(respApproveE, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(nodeEJSON)))
+	if respApproveE.Code != http.StatusCreated {
+		t.Fatalf("Failed to approve node E: %d", respApproveE.Code)
+	}
+
+	// C arrives before its parent B to exercise topological insertion
+	export := models.Export{Nodes: []*models.Node{
+		{ID: "A"},
+		{ID: "C", Parents: []string{"B"}},
+		{ID: "B", Parents: []string{"A"}},
+		{ID: "D", Parents: []string{"MISSING"}},
+		{ID: "E", Parents: []string{"B"}},
+	}}
+	exportJSON, _ := json.Marshal(export)
+	respMerge := httptest.NewRecorder()
+	router.ServeHTTP(respMerge, httptest.NewRequest(http.MethodPost, "/sync/merge", bytes.NewReader(exportJSON)))
+	if respMerge.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", respMerge.Code, respMerge.Body.String())
+	}
+
+	var result models.MergeResult
+	if err := json.Unmarshal(respMerge.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result.Added != 2 || result.Skipped != 1 || result.Conflicted != 2 {
+		t.Fatalf("Expected added=2 skipped=1 conflicted=2, got %+v", result)
+	}
+
+	nodeAFromRepo, err := mockRepo.GetNode("A")
+	if err != nil {
+		t.Fatalf("Node A not found: %v", err)
+	}
+	// A is approved by B and E; B by C
+	if nodeAFromRepo.Weight != 2 || nodeAFromRepo.CumulativeWeight != 3 {
+		t.Fatalf("Expected node A weight 2 cumulative 3, got %d/%d", nodeAFromRepo.Weight, nodeAFromRepo.CumulativeWeight)
+	}
+}
+
+func TestMergeExport_DifferentContent(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "data": map[string]string{"v": "local"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+
+	// same ID and parents, different data: a conflict, not a silent skip
+	export := models.Export{Nodes: []*models.Node{
+		{ID: "A", Data: json.RawMessage(`{"v":"remote"}`)},
+	}}
+	exportJSON, _ := json.Marshal(export)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/sync/merge", bytes.NewReader(exportJSON)))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+
+	var result models.MergeResult
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result.Skipped != 0 || result.Conflicted != 1 || result.Conflicts[0].Reason != "node exists with different content" {
+		t.Fatalf("Expected one content conflict, got %+v", result)
+	}
+	if stored, _ := mockRepo.GetNode("A"); string(stored.Data) != `{"v":"local"}` {
+		t.Fatalf("Expected local data to be kept, got %s", stored.Data)
+	}
+
+	// the same data with different whitespace is still identical
+	export.Nodes[0].Data = json.RawMessage(`{ "v": "local" }`)
+	exportJSON, _ = json.Marshal(export)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/sync/merge", bytes.NewReader(exportJSON)))
+	result = models.MergeResult{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result.Skipped != 1 || result.Conflicted != 0 {
+		t.Fatalf("Expected the identical node to be skipped, got %+v", result)
+	}
+}
+
+func TestMergeExport_PreserveWeights(t *testing.T) {
+	router, mockRepo := testServer()
+
+	// deliberately drifted weights must survive the round trip untouched
+	export := models.Export{Nodes: []*models.Node{
+		{ID: "A", Weight: 5, CumulativeWeight: 42, CreatedAt: 1},
+		{ID: "B", Parents: []string{"A"}, Weight: 0, CumulativeWeight: 7, CreatedAt: 2},
+	}}
+	exportJSON, _ := json.Marshal(export)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/sync/merge?preserve_weights=true", bytes.NewReader(exportJSON)))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+
+	for _, want := range export.Nodes {
+		got, err := mockRepo.GetNode(want.ID)
+		if err != nil {
+			t.Fatalf("Node %s not found: %v", want.ID, err)
+		}
+		if got.Weight != want.Weight || got.CumulativeWeight != want.CumulativeWeight || got.CreatedAt != want.CreatedAt {
+			t.Fatalf("Expected %s stored verbatim as %d/%d, got %d/%d",
+				want.ID, want.Weight, want.CumulativeWeight, got.Weight, got.CumulativeWeight)
+		}
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/sync/merge?preserve_weights=yes", bytes.NewReader(exportJSON)))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an invalid preserve_weights value, got %d", resp.Code)
+	}
+}
+
+func TestGetTipMCMC_AlphaAndMaxSteps(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	cases := map[string]int{
+		"?alpha=0.5&max_steps=50": http.StatusOK,
+		"?alpha=10":               http.StatusOK,
+		"?alpha=0":                http.StatusBadRequest,
+		"?alpha=-1":               http.StatusBadRequest,
+		"?alpha=10.5":             http.StatusBadRequest,
+		"?alpha=NaN":              http.StatusBadRequest,
+		"?alpha=abc":              http.StatusBadRequest,
+		"?max_steps=0":            http.StatusBadRequest,
+	}
+	for query, code := range cases {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection"+query, nil))
+		if resp.Code != code {
+			t.Fatalf("%s: expected status %d, got %d, body: %s", query, code, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestGetTipMCMC_Count(t *testing.T) {
+	router, _ := testServer()
+
+	selectTips := func(query string) (ids []string, distinct bool) {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection"+query, nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d, body: %s", query, resp.Code, resp.Body.String())
+		}
+		var body struct {
+			Tips     []models.Node `json:"tips"`
+			Distinct bool          `json:"distinct"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", query, err)
+		}
+		for _, tip := range body.Tips {
+			ids = append(ids, tip.ID)
+		}
+		sort.Strings(ids)
+		return ids, body.Distinct
+	}
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	if ids, distinct := selectTips("?count=2"); distinct || fmt.Sprint(ids) != "[A]" {
+		t.Fatalf("Expected only A and distinct=false, got %v distinct=%v", ids, distinct)
+	}
+
+	for _, id := range []string{"B", "C"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	}
+	if ids, distinct := selectTips("?count=2"); !distinct || fmt.Sprint(ids) != "[B C]" {
+		t.Fatalf("Expected tips B and C with distinct=true, got %v distinct=%v", ids, distinct)
+	}
+
+	for _, query := range []string{"?count=0", "?count=9", "?count=two"} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection"+query, nil))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", query, resp.Code)
+		}
+	}
+}
+
+func TestGetTipMCMC_Exploration(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	// A long branch A <- B <- C <- D and a short one A <- E
+	approvals := []map[string]interface{}{
+		{"id": "B", "parents": []string{"A"}},
+		{"id": "C", "parents": []string{"B"}},
+		{"id": "D", "parents": []string{"C"}},
+		{"id": "E", "parents": []string{"A"}},
+	}
+	for _, approval := range approvals {
+		approvalJSON, _ := json.Marshal(approval)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approvalJSON)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %v: %d", approval["id"], resp.Code)
+		}
+	}
+
+	tipSelections := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		respTip := httptest.NewRecorder()
+		router.ServeHTTP(respTip, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection?exploration=1", nil))
+		if respTip.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d, body: %s", respTip.Code, respTip.Body.String())
+		}
+		var selectedTip models.Node
+		if err := json.Unmarshal(respTip.Body.Bytes(), &selectedTip); err != nil {
+			t.Fatalf("Invalid JSON response: %v", err)
+		}
+		tipSelections[selectedTip.ID]++
+	}
+	if tipSelections["D"] == 0 || tipSelections["E"] == 0 {
+		t.Fatalf("Expected full exploration to reach both tips, got %v", tipSelections)
+	}
+
+	respInvalid := httptest.NewRecorder()
+	router.ServeHTTP(respInvalid, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection?exploration=2", nil))
+	if respInvalid.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for out-of-range exploration, got %d", respInvalid.Code)
+	}
+}
+
+func TestCreateCheckpoint_InvalidAndDuplicateID(t *testing.T) {
+	router, _ := testServer()
+
+	for _, id := range []string{"cp:1", "latest", strings.Repeat("x", 129)} {
+		body, _ := json.Marshal(map[string]string{"id": id})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader(body)))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for checkpoint id %q, got %d", id, resp.Code)
+		}
+	}
+
+	cp1 := httptest.NewRecorder()
+	router.ServeHTTP(cp1, httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{"id":"cp1"}`))))
+	if cp1.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for cp1, got %d", cp1.Code)
+	}
+
+	dup := httptest.NewRecorder()
+	router.ServeHTTP(dup, httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{"id":"cp1"}`))))
+	if dup.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate checkpoint, got %d", dup.Code)
+	}
+}
+
+func TestAttachNode(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	for _, id := range []string{"B", "C"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %s: %d", id, resp.Code)
+		}
+	}
+
+	respAttach := httptest.NewRecorder()
+	router.ServeHTTP(respAttach, httptest.NewRequest(http.MethodPost, "/nodes/attach", bytes.NewReader([]byte(`{"id":"D"}`))))
+	if respAttach.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d, body: %s", respAttach.Code, respAttach.Body.String())
+	}
+
+	nodeD, err := mockRepo.GetNode("D")
+	if err != nil {
+		t.Fatalf("Node D not stored: %v", err)
+	}
+	if len(nodeD.Parents) != 2 {
+		t.Fatalf("Expected D to attach to both tips, got parents %v", nodeD.Parents)
+	}
+	for _, pid := range nodeD.Parents {
+		if pid != "B" && pid != "C" {
+			t.Fatalf("Expected D's parents to be tips B and C, got %v", nodeD.Parents)
+		}
+	}
+}
+
+func TestApproveNode_ParentLimits(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	handler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+	handler.SetParentLimits(2, 3)
+	router := mux.NewRouter()
+	routers.RegisterRoutes(router, handler)
+
+	for _, id := range []string{"A", "B", "C", "D"} {
+		genesis, _ := json.Marshal(map[string]interface{}{"id": id})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(genesis)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to add node %s: %d", id, resp.Code)
+		}
+	}
+
+	cases := []struct {
+		id      string
+		parents []string
+		code    int
+	}{
+		{"N0", []string{}, http.StatusBadRequest},
+		{"N1", []string{"A"}, http.StatusBadRequest},
+		{"N2", []string{"A", "B"}, http.StatusCreated},
+		{"N3", []string{"A", "B", "C"}, http.StatusCreated},
+		{"N4", []string{"A", "B", "C", "D"}, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		approval, _ := json.Marshal(map[string]interface{}{"id": tc.id, "parents": tc.parents})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+		if resp.Code != tc.code {
+			t.Fatalf("%d parents: expected status %d, got %d, body: %s", len(tc.parents), tc.code, resp.Code, resp.Body.String())
+		}
+	}
+
+	// attach asks for at most as many tips as an approval may list
+	respAttach := httptest.NewRecorder()
+	router.ServeHTTP(respAttach, httptest.NewRequest(http.MethodPost, "/nodes/attach", strings.NewReader(`{"id":"T1","count":4}`)))
+	if respAttach.Code != http.StatusBadRequest || !strings.Contains(respAttach.Body.String(), "count must be between 1 and 3") {
+		t.Fatalf("Expected a four-tip attach to be rejected, got %d: %s", respAttach.Code, respAttach.Body.String())
+	}
+	respAttach = httptest.NewRecorder()
+	router.ServeHTTP(respAttach, httptest.NewRequest(http.MethodPost, "/nodes/attach", strings.NewReader(`{"id":"T2","count":3}`)))
+	if respAttach.Code != http.StatusCreated {
+		t.Fatalf("Expected a three-tip attach to pass, got %d: %s", respAttach.Code, respAttach.Body.String())
+	}
+}
+
+func TestParentLimits_EveryApprovalPath(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	cfg := dag.DefaultConfig()
+	cfg.MinParents = 2
+	cfg.MaxParents = 3
+	router := mux.NewRouter()
+	routers.RegisterRoutes(router, handlers.NewHandler(dag.NewDAGWithConfig(newMockRepo(), cfg)))
+
+	for _, id := range []string{"A", "B", "C", "D"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", strings.NewReader(`{"id":"`+id+`"}`)))
+	}
+
+	// batch nodes outside the limits fail, the one within them is approved
+	batch := `[{"id":"N1","parents":["A"]},{"id":"N2","parents":["A","B"]},{"id":"N4","parents":["A","B","C","D"]}]`
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve/batch", strings.NewReader(batch)))
+	want := map[string]string{"N1": models.BatchStatusFailed, "N2": models.BatchStatusApproved, "N4": models.BatchStatusFailed}
+	for _, line := range strings.Split(strings.TrimSpace(resp.Body.String()), "\n") {
+		var result models.BatchResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("Invalid batch result %q: %v", line, err)
+		}
+		if result.Status != want[result.ID] {
+			t.Fatalf("Expected %s to be %s, got %+v", result.ID, want[result.ID], result)
+		}
+	}
+
+	// attach can't pick fewer parents than the minimum either
+	respAttach := httptest.NewRecorder()
+	router.ServeHTTP(respAttach, httptest.NewRequest(http.MethodPost, "/nodes/attach", strings.NewReader(`{"id":"T1","count":1}`)))
+	if respAttach.Code != http.StatusBadRequest || !strings.Contains(respAttach.Body.String(), "too few parents (min 2)") {
+		t.Fatalf("Expected a one-parent attach to be rejected, got %d: %s", respAttach.Code, respAttach.Body.String())
+	}
+	respAttach = httptest.NewRecorder()
+	router.ServeHTTP(respAttach, httptest.NewRequest(http.MethodPost, "/nodes/attach", strings.NewReader(`{"id":"T2","count":2}`)))
+	if respAttach.Code != http.StatusCreated {
+		t.Fatalf("Expected a two-parent attach to pass, got %d: %s", respAttach.Code, respAttach.Body.String())
+	}
+}
+
+func TestApproveNode_TooManyParents(t *testing.T) {
+	router, _ := testServer()
+
+	parents := make([]string, 9)
+	for i := range parents {
+		parents[i] = fmt.Sprintf("P%d", i)
+		genesis, _ := json.Marshal(map[string]interface{}{"id": parents[i]})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(genesis)))
+	}
+
+	// no handler limit is set, so the DAG's default of 8 applies
+	approval, _ := json.Marshal(map[string]interface{}{"id": "N", "parents": parents})
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	if !strings.Contains(resp.Body.String(), "too many parents (max 8)") {
+		t.Fatalf("Expected the limit in the error, got %s", resp.Body.String())
+	}
+}
+
+func TestGetCheckpointDiff(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{"id":"cp1"}`))))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{"id":"cp2"}`))))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/checkpoints/diff?from=cp1&to=cp2", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	var diff models.CheckpointDiff
+	if err := json.Unmarshal(resp.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !diff.Detailed || diff.NodeCountDelta != 1 || len(diff.Added) != 1 || diff.Added[0] != "B" {
+		t.Fatalf("Unexpected diff: %+v", diff)
+	}
+
+	for query, code := range map[string]int{
+		"?from=cp1&to=nope": http.StatusNotFound,
+		"?from=cp1":         http.StatusBadRequest,
+	} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/checkpoints/diff"+query, nil))
+		if resp.Code != code {
+			t.Fatalf("%s: expected status %d, got %d", query, code, resp.Code)
+		}
+	}
+}
+
+func TestAnnotateNode(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+
+	for _, body := range []string{`{"status":"flagged","owner":"ops"}`, `{"owner":null}`} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPatch, "/nodes/A/annotations", strings.NewReader(body)))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d, body: %s", body, resp.Code, resp.Body.String())
+		}
+	}
+	stored, _ := mockRepo.GetNode("A")
+	if len(stored.Annotations) != 1 || stored.Annotations["status"] != "flagged" {
+		t.Fatalf("Expected only the status annotation, got %v", stored.Annotations)
+	}
+
+	cases := map[string]struct {
+		path string
+		body string
+		code int
+	}{
+		"unknown node": {"/nodes/nope/annotations", `{"status":"x"}`, http.StatusNotFound},
+		"empty key":    {"/nodes/A/annotations", `{"":"x"}`, http.StatusBadRequest},
+		"not a string": {"/nodes/A/annotations", `{"status":1}`, http.StatusBadRequest},
+	}
+	for name, tc := range cases {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPatch, tc.path, strings.NewReader(tc.body)))
+		if resp.Code != tc.code {
+			t.Fatalf("%s: expected status %d, got %d", name, tc.code, resp.Code)
+		}
+	}
+}
+
+func TestListNodes_Pagination(t *testing.T) {
+	router, _ := testServer()
+
+	for _, id := range []string{"A", "B", "C", "D", "E"} {
+		genesis, _ := json.Marshal(map[string]interface{}{"id": id})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(genesis)))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/E/archive", nil))
+
+	cases := []struct {
+		query string
+		ids   []string
+		total int
+	}{
+		{"?limit=2", []string{"A", "B"}, 4},
+		{"?limit=2&offset=2", []string{"C", "D"}, 4},
+		{"?limit=2&offset=3", []string{"D"}, 4},
+		{"?offset=10", []string{}, 4},
+		{"?include_deleted=true&offset=4", []string{"E"}, 5},
+	}
+	for _, tc := range cases {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes"+tc.query, nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tc.query, resp.Code)
+		}
+		var body struct {
+			Nodes  []models.Node `json:"nodes"`
+			Total  int           `json:"total"`
+			Offset int           `json:"offset"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tc.query, err)
+		}
+		ids := []string{}
+		for _, n := range body.Nodes {
+			ids = append(ids, n.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tc.ids) || body.Total != tc.total {
+			t.Fatalf("%s: expected %v of %d, got %v of %d", tc.query, tc.ids, tc.total, ids, body.Total)
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes?offset=-1", nil))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a negative offset, got %d", resp.Code)
+	}
+}
+
+func TestGetTips(t *testing.T) {
+	router, _ := testServer()
+
+	get := func() (tips []models.Node, count int) {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tips", nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+		}
+		var body struct {
+			Tips  []models.Node `json:"tips"`
+			Count int           `json:"count"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body.Tips == nil {
+			t.Fatalf("Expected a tips array, got %s", resp.Body.String())
+		}
+		return body.Tips, body.Count
+	}
+
+	if tips, count := get(); len(tips) != 0 || count != 0 {
+		t.Fatalf("Expected no tips on an empty DAG, got %v", tips)
+	}
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, id := range []string{"B", "C"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	}
+	tips, count := get()
+	if count != 2 || len(tips) != 2 || tips[0].ID != "B" || tips[1].ID != "C" {
+		t.Fatalf("Expected tips B and C, got %v (count %d)", tips, count)
+	}
+
+	// a weighted sample of distinct tips, capped at the tips available
+	for query, want := range map[string]int{"?sample=1": 1, "?sample=5": 2} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tips"+query, nil))
+		var body struct {
+			Tips  []models.Node `json:"tips"`
+			Count int           `json:"count"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil || resp.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d, body: %s", query, resp.Code, resp.Body.String())
+		}
+		if body.Count != want || len(body.Tips) != want || (want == 2 && body.Tips[0].ID == body.Tips[1].ID) {
+			t.Fatalf("%s: expected %d distinct tips, got %+v", query, want, body.Tips)
+		}
+	}
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tips?sample=0", nil))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for sample=0, got %d", resp.Code)
+	}
+}
+
+func TestGetTopological(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, approval := range []map[string]interface{}{
+		{"id": "C", "parents": []string{"A"}},
+		{"id": "B", "parents": []string{"C"}},
+	} {
+		body, _ := json.Marshal(approval)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(body)))
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/topological", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	var result struct {
+		Nodes []models.Node `json:"nodes"`
+		Count int           `json:"count"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &result)
+	if result.Count != 3 || result.Nodes[0].ID != "A" || result.Nodes[1].ID != "C" || result.Nodes[2].ID != "B" {
+		t.Fatalf("Expected A, C, B in topological order, got %+v", result)
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/topological?include_deleted=maybe", nil))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for a malformed include_deleted, got %d", resp.Code)
+	}
+}
+
+func TestGetAncestorsAndDescendants(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	for _, tc := range []struct {
+		path, key, want string
+	}{
+		{"/nodes/B/ancestors", "ancestors", "A"},
+		{"/nodes/A/descendants", "descendants", "B"},
+	} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d", tc.path, resp.Code)
+		}
+		var result map[string]json.RawMessage
+		json.Unmarshal(resp.Body.Bytes(), &result)
+		var nodes []models.Node
+		json.Unmarshal(result[tc.key], &nodes)
+		if len(nodes) != 1 || nodes[0].ID != tc.want {
+			t.Fatalf("GET %s: expected [%s], got %+v", tc.path, tc.want, nodes)
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/missing/descendants", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 for a missing node, got %d", resp.Code)
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, approval := range []map[string]interface{}{
+		{"id": "B", "parents": []string{"A"}},
+		{"id": "C", "parents": []string{"B"}},
+	} {
+		body, _ := json.Marshal(approval)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(body)))
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/path?from=A&to=C", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	var result struct {
+		Path   []string `json:"path"`
+		Length int      `json:"length"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &result)
+	if strings.Join(result.Path, ",") != "A,B,C" || result.Length != 3 {
+		t.Fatalf("Expected path A,B,C of length 3, got %+v", result)
+	}
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"from=C&to=A", http.StatusNotFound},
+		{"from=A&to=missing", http.StatusNotFound},
+		{"from=A", http.StatusBadRequest},
+	} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/path?"+tc.query, nil))
+		if resp.Code != tc.code {
+			t.Fatalf("GET ?%s: expected status %d, got %d", tc.query, tc.code, resp.Code)
+		}
+	}
+}
+
+func TestDeleteNode(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	for _, tc := range []struct {
+		id   string
+		code int
+	}{
+		{"A", http.StatusConflict},
+		{"B", http.StatusOK},
+		{"B", http.StatusNotFound},
+		{"A", http.StatusOK},
+	} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodDelete, "/nodes/"+tc.id, nil))
+		if resp.Code != tc.code {
+			t.Fatalf("DELETE %s: expected status %d, got %d, body: %s", tc.id, tc.code, resp.Code, resp.Body.String())
+		}
+	}
+	if nodes, _ := mockRepo.GetAllNodes(); len(nodes) != 0 {
+		t.Fatalf("Expected every node to be deleted, got %d", len(nodes))
+	}
+}
+
+func TestDeleteNodesBatch(t *testing.T) {
+	router, mockRepo := testServer()
+
+	// A <- B <- C and A <- D
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, n := range []struct{ id, parent string }{{"B", "A"}, {"C", "B"}, {"D", "A"}} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": n.id, "parents": []string{n.parent}})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	}
+
+	deleteBatch := func(body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/delete/batch", strings.NewReader(body)))
+		return resp
+	}
+	for body, code := range map[string]int{
+		`{"ids":["B"]}`:               http.StatusConflict, // C still approves B
+		`{"ids":["A","B","C"]}`:       http.StatusConflict, // D still approves A
+		`{"ids":["C","B","MISSING"]}`: http.StatusNotFound,
+		`{"ids":[]}`:                  http.StatusBadRequest,
+		`not json`:                    http.StatusBadRequest,
+	} {
+		if resp := deleteBatch(body); resp.Code != code {
+			t.Fatalf("%s: expected status %d, got %d, body: %s", body, code, resp.Code, resp.Body.String())
+		}
+	}
+	// a rejected batch deletes nothing
+	if nodes, _ := mockRepo.GetAllNodes(); len(nodes) != 4 {
+		t.Fatalf("Expected all 4 nodes to survive rejected batches, got %d", len(nodes))
+	}
+
+	resp := deleteBatch(`{"ids":["B","C"]}`)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	var body struct {
+		Deleted []string `json:"deleted"`
+		Count   int      `json:"count"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if strings.Join(body.Deleted, ",") != "C,B" || body.Count != 2 {
+		t.Fatalf("Expected C deleted before B, got %+v", body)
+	}
+	if _, err := mockRepo.GetNode("B"); err == nil {
+		t.Fatal("Expected B to be deleted")
+	}
+	// A keeps only D's approval
+	if a, _ := mockRepo.GetNode("A"); a.Weight != 1 || a.CumulativeWeight != 1 {
+		t.Fatalf("Expected A recomputed to 1/1, got %d/%d", a.Weight, a.CumulativeWeight)
+	}
+}
+
+func TestSubmitNode(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeAJSON, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	// a single tip is not enough
+	respShort := httptest.NewRecorder()
+	router.ServeHTTP(respShort, httptest.NewRequest(http.MethodPost, "/nodes/submit", bytes.NewReader([]byte(`{"id":"X"}`))))
+	if respShort.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 with one tip, got %d, body: %s", respShort.Code, respShort.Body.String())
+	}
+	if _, err := mockRepo.GetNode("X"); err == nil {
+		t.Fatal("Expected X not to be stored")
+	}
+
+	for _, id := range []string{"B", "C"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %s: %d", id, resp.Code)
+		}
+	}
+
+	respSubmit := httptest.NewRecorder()
+	router.ServeHTTP(respSubmit, httptest.NewRequest(http.MethodPost, "/nodes/submit",
+		bytes.NewReader([]byte(`{"id":"D","data":{"value":7}}`))))
+	if respSubmit.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d, body: %s", respSubmit.Code, respSubmit.Body.String())
+	}
+
+	nodeD, err := mockRepo.GetNode("D")
+	if err != nil {
+		t.Fatalf("Node D not stored: %v", err)
+	}
+	parents := append([]string(nil), nodeD.Parents...)
+	sort.Strings(parents)
+	if len(parents) != 2 || parents[0] != "B" || parents[1] != "C" {
+		t.Fatalf("Expected D's parents to be tips B and C, got %v", nodeD.Parents)
+	}
+	if string(nodeD.Data) != `{"value":7}` {
+		t.Fatalf("Expected data to be stored, got %s", nodeD.Data)
+	}
+}
+
+func TestGetHighestWeightNode_WeightsAsStrings(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA := map[string]interface{}{"id": "A", "parents": []string{}}
+	nodeAJSON, _ := json.Marshal(nodeA)
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeAJSON)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/nodes/highest-weight", nil)
+	req.Header.Set("Accept", "application/json; weights=string")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	node, ok := body["node"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected node object in response, got %v", body)
+	}
+	if _, ok := node["weight"].(string); !ok {
+		t.Fatalf("Expected weight as string, got %T", node["weight"])
+	}
+	if _, ok := node["cumulative_weight"].(string); !ok {
+		t.Fatalf("Expected cumulative_weight as string, got %T", node["cumulative_weight"])
+	}
+
+	respNumber := httptest.NewRecorder()
+	router.ServeHTTP(respNumber, httptest.NewRequest(http.MethodGet, "/nodes/highest-weight", nil))
+	var numberBody map[string]map[string]interface{}
+	json.Unmarshal(respNumber.Body.Bytes(), &numberBody)
+	if _, ok := numberBody["node"]["weight"].(float64); !ok {
+		t.Fatalf("Expected numeric weight by default, got %T", numberBody["node"]["weight"])
+	}
+}
+
+func TestWeightsAsStrings_LeavesDataAlone(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{
+		"id":   "A",
+		"data": map[string]interface{}{"weight": 3, "nested": map[string]interface{}{"cumulative_weight": 5}},
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+
+	req := httptest.NewRequest(http.MethodGet, "/nodes/A", nil)
+	req.Header.Set("Accept", "application/json; weights=string")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+
+	var body struct {
+		Weight interface{} `json:"weight"`
+		Data   struct {
+			Weight interface{} `json:"weight"`
+			Nested struct {
+				CumulativeWeight interface{} `json:"cumulative_weight"`
+			} `json:"nested"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if _, ok := body.Weight.(string); !ok {
+		t.Fatalf("Expected the node's weight as string, got %T", body.Weight)
+	}
+	if body.Data.Weight != float64(3) || body.Data.Nested.CumulativeWeight != float64(5) {
+		t.Fatalf("Expected the data payload untouched, got %s", resp.Body.String())
+	}
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	router, _ := testServer()
+
+	for _, target := range []string{"/admin/read-only?enabled=true", "/admin/stats/reset", "/admin/flush"} {
+		for _, auth := range []string{"", "Bearer wrong", testAdminToken} {
+			req := httptest.NewRequest(http.MethodPost, target, nil)
+			req.Header.Set("Authorization", auth)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			if resp.Code != http.StatusUnauthorized {
+				t.Fatalf("%s: expected 401 with authorization %q, got %d", target, auth, resp.Code)
+			}
+		}
+	}
+
+	// the refused toggle above must not have switched read-only mode on
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected writes to stay open, got %d", resp.Code)
+	}
+
+	// without a configured token nobody is let in, not even with an empty bearer
+	handler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+	openRouter := mux.NewRouter()
+	routers.RegisterRoutes(openRouter, handler)
+	for _, auth := range []string{"", "Bearer "} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/flush", nil)
+		req.Header.Set("Authorization", auth)
+		resp := httptest.NewRecorder()
+		openRouter.ServeHTTP(resp, req)
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 with no token configured (auth %q), got %d", auth, resp.Code)
+		}
+	}
+}
+
+func TestFlush_SynchronousModeIsNoop(t *testing.T) {
+	router, _ := testServer()
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, adminRequest(http.MethodPost, "/admin/flush"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+
+	var body map[string]int64
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["processed"] != 0 {
+		t.Fatalf("Expected 0 processed in synchronous mode, got %d", body["processed"])
+	}
+}
+
+func TestDebugKeys_GatedAndPaginated(t *testing.T) {
+	router, _ := testServer()
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/debug/keys", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 while debugging is disabled, got %d", resp.Code)
+	}
+
+	ldb, err := db.NewLevelDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open leveldb: %v", err)
+	}
+	defer ldb.Close()
+	for _, key := range []string{"checkpoint:a", "checkpoint:b", "checkpoint:c", "node1"} {
+		ldb.Put([]byte(key), []byte("value"))
+	}
+
+	handler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+	handler.EnableDebug(ldb, "secret")
+	debugRouter := mux.NewRouter()
+	routers.RegisterRoutes(debugRouter, handler)
+
+	respNoToken := httptest.NewRecorder()
+	debugRouter.ServeHTTP(respNoToken, httptest.NewRequest(http.MethodGet, "/debug/keys", nil))
+	if respNoToken.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without token, got %d", respNoToken.Code)
+	}
+
+	var keys []string
+	after := ""
+	for page := 0; page < 3; page++ {
+		req := httptest.NewRequest(http.MethodGet, "/debug/keys?prefix=checkpoint:&limit=2&after="+after, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp := httptest.NewRecorder()
+		debugRouter.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.Code)
+		}
+		var body struct {
+			Keys []struct {
+				Key  string `json:"key"`
+				Size int    `json:"size"`
+			} `json:"keys"`
+			Next string `json:"next"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		for _, k := range body.Keys {
+			if k.Size != len("value") {
+				t.Fatalf("Expected size %d for %s, got %d", len("value"), k.Key, k.Size)
+			}
+			keys = append(keys, k.Key)
+		}
+		if body.Next == "" {
+			break
+		}
+		after = body.Next
+	}
+	if strings.Join(keys, ",") != "checkpoint:a,checkpoint:b,checkpoint:c" {
+		t.Fatalf("Unexpected keys across pages: %v", keys)
+	}
+
+	// without a configured token nobody is let in, not even with an empty bearer
+	openHandler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+	openHandler.EnableDebug(ldb, "")
+	openRouter := mux.NewRouter()
+	routers.RegisterRoutes(openRouter, openHandler)
+	for _, auth := range []string{"", "Bearer "} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/keys", nil)
+		req.Header.Set("Authorization", auth)
+		resp := httptest.NewRecorder()
+		openRouter.ServeHTTP(resp, req)
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 with no token configured (auth %q), got %d", auth, resp.Code)
+		}
+	}
+}
+
+func TestRegisterRoutesFiltered_DisabledEndpoint(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	handler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+	router := mux.NewRouter()
+	disabled := routers.RegisterRoutesFiltered(router, handler, func(name string) bool {
+		return name != "nodes.approve" && !strings.HasPrefix(name, "admin.")
+	})
+	if strings.Join(disabled, ",") != "nodes.approve,admin.read_only,admin.stats_reset,admin.flush" {
+		t.Fatalf("Unexpected disabled endpoints: %v", disabled)
+	}
+
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for disabled endpoint, got %d", resp.Code)
+	}
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	respAdd := httptest.NewRecorder()
+	router.ServeHTTP(respAdd, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	if respAdd.Code != http.StatusCreated {
+		t.Fatalf("Expected enabled endpoint to respond 201, got %d", respAdd.Code)
+	}
+}
+
+func TestGetLongestChain(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	respCreateA := httptest.NewRecorder()
+	router.ServeHTTP(respCreateA, httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	if respCreateA.Code != http.StatusCreated {
+		t.Fatalf("Failed to add node A: %d", respCreateA.Code)
+	}
+
+	// A <- B <- D and A <- C <- E <- F, with a shortcut A <- F
+	for _, n := range []struct {
+		id      string
+		parents []string
+	}{
+		{"B", []string{"A"}},
+		{"C", []string{"A"}},
+		{"D", []string{"B"}},
+		{"E", []string{"C"}},
+		{"F", []string{"E", "A"}},
+	} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": n.id, "parents": n.parents})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %s: %d", n.id, resp.Code)
+		}
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/longest-chain", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+	var body struct {
+		Length int            `json:"length"`
+		Chain  []*models.Node `json:"chain"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	var ids []string
+	for _, n := range body.Chain {
+		ids = append(ids, n.ID)
+	}
+	if body.Length != 4 || strings.Join(ids, ",") != "A,C,E,F" {
+		t.Fatalf("Expected chain A,C,E,F of length 4, got %v (length %d)", ids, body.Length)
+	}
+}
+
+func TestHealthAndReady(t *testing.T) {
+	router, mockRepo := testServer()
+
+	probe := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		return resp
+	}
+	for _, path := range []string{"/health", "/ready"} {
+		if resp := probe(path); resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"status":"ok"`) {
+			t.Fatalf("%s: expected 200 ok, got %d: %s", path, resp.Code, resp.Body.String())
+		}
+	}
+
+	// a storage failure fails readiness but not liveness
+	mockRepo.mu.Lock()
+	mockRepo.pingErr = fmt.Errorf("leveldb: closed")
+	mockRepo.mu.Unlock()
+	if resp := probe("/ready"); resp.Code != http.StatusServiceUnavailable {
+		t.Fatalf("/ready: expected 503, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := probe("/health"); resp.Code != http.StatusOK {
+		t.Fatalf("/health: expected 200, got %d", resp.Code)
+	}
+}
+
+func TestGetStatus_Plaintext(t *testing.T) {
+	router, _ := testServer()
+
+	readStatus := func() string {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.Code)
+		}
+		if ct := resp.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Fatalf("Expected text/plain, got %q", ct)
+		}
+		return resp.Body.String()
+	}
+
+	if body := readStatus(); !strings.Contains(body, "nodes: 0\n") || !strings.Contains(body, "latest_checkpoint: none\n") {
+		t.Fatalf("Unexpected empty status:\n%s", body)
+	}
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, n := range []struct {
+		id      string
+		parents []string
+	}{
+		{"B", []string{"A"}},
+		{"C", []string{"A"}},
+		{"D", []string{"B", "C"}},
+		{"E", []string{"A"}},
+	} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": n.id, "parents": n.parents})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %s: %d", n.id, resp.Code)
+		}
+	}
+	checkpoint, _ := json.Marshal(map[string]string{"id": "cp1"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader(checkpoint)))
+
+	body := readStatus()
+	for _, want := range []string{"nodes: 5\n", "tips: 2\n", "latest_checkpoint: cp1 ", "read_only: false\n", "uptime: "} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("Expected status to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestGetNode_LogLevels(t *testing.T) {
+	router, _ := testServer()
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger.Logger = zap.New(core)
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nodes/A", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nodes/missing", nil))
+
+	// lookups, found or not, are routine and never logged as errors
+	for message, want := range map[string]string{"Retrieved node": "A", "Node not found": "missing"} {
+		entries := logs.FilterMessage(message).All()
+		if len(entries) != 1 || entries[0].Level != zapcore.InfoLevel || entries[0].ContextMap()["node_id"] != want {
+			t.Fatalf("Expected one info entry %q for %s, got %+v", message, want, entries)
+		}
+	}
+	if n := logs.FilterLevelExact(zapcore.ErrorLevel).Len(); n != 0 {
+		t.Fatalf("Expected no error logs, got %d", n)
+	}
+}
+
+func TestGetNode_ETag(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/A", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+	etag := resp.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag header")
+	}
+
+	conditional := httptest.NewRequest(http.MethodGet, "/nodes/A", nil)
+	conditional.Header.Set("If-None-Match", etag)
+	respNotModified := httptest.NewRecorder()
+	router.ServeHTTP(respNotModified, conditional)
+	if respNotModified.Code != http.StatusNotModified || respNotModified.Body.Len() != 0 {
+		t.Fatalf("Expected empty 304, got %d with %q", respNotModified.Code, respNotModified.Body.String())
+	}
+
+	// an approval changes A's weight and therefore its ETag
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	conditional = httptest.NewRequest(http.MethodGet, "/nodes/A", nil)
+	conditional.Header.Set("If-None-Match", etag)
+	respChanged := httptest.NewRecorder()
+	router.ServeHTTP(respChanged, conditional)
+	if respChanged.Code != http.StatusOK || respChanged.Header().Get("ETag") == etag {
+		t.Fatalf("Expected 200 with a new ETag after approval, got %d", respChanged.Code)
+	}
+
+	respMissing := httptest.NewRecorder()
+	router.ServeHTTP(respMissing, httptest.NewRequest(http.MethodGet, "/nodes/missing", nil))
+	if respMissing.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for unknown node, got %d", respMissing.Code)
+	}
+}
+
+func TestStreamNodes_NDJSON(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, id := range []string{"B", "C"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/stream", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Expected application/x-ndjson, got %q", ct)
+	}
+
+	seen := map[string]bool{}
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var node models.Node
+		if err := decoder.Decode(&node); err != nil {
+			t.Fatalf("Failed to decode streamed node: %v", err)
+		}
+		seen[node.ID] = true
+	}
+	if len(seen) != 3 || !seen["A"] || !seen["B"] || !seen["C"] {
+		t.Fatalf("Expected nodes A, B and C, got %v", seen)
+	}
+}
+
+func TestListNodes_FilterByAuthor(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}, "created_by": "alice"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, id := range []string{"B", "C", "D"} {
+		author := "bob"
+		if id != "B" {
+			author = "alice"
+		}
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}, "created_by": author})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %s: %d", id, resp.Code)
+		}
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/D/archive", nil))
+
+	list := func(query string) (ids []string, total int) {
+		t.Helper()
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes?"+query, nil))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET /nodes?%s: expected status 200, got %d", query, resp.Code)
+		}
+		var page struct {
+			Nodes []models.Node `json:"nodes"`
+			Total int           `json:"total"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode page: %v", err)
+		}
+		for _, n := range page.Nodes {
+			if n.CreatedBy != "alice" {
+				t.Fatalf("GET /nodes?%s: expected only alice's nodes, got %+v", query, n)
+			}
+			ids = append(ids, n.ID)
+		}
+		return ids, page.Total
+	}
+
+	// the archived D only shows up on request; paging counts the filtered set
+	if ids, total := list("created_by=alice"); strings.Join(ids, ",") != "A,C" || total != 2 {
+		t.Fatalf("expected A,C of 2, got %v of %d", ids, total)
+	}
+	if ids, total := list("created_by=alice&include_deleted=true"); strings.Join(ids, ",") != "A,C,D" || total != 3 {
+		t.Fatalf("expected A,C,D of 3, got %v of %d", ids, total)
+	}
+	if ids, total := list("created_by=alice&limit=1&offset=1"); strings.Join(ids, ",") != "C" || total != 2 {
+		t.Fatalf("expected the second page to hold C of 2, got %v of %d", ids, total)
+	}
+}
+
+func TestStreamNodes_FilterByAuthor(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}, "created_by": "alice"})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for id, author := range map[string]string{"B": "bob", "C": "alice"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}, "created_by": author})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("Failed to approve node %s: %d", id, resp.Code)
+		}
+	}
+
+	tooLong, _ := json.Marshal(map[string]interface{}{"id": "D", "parents": []string{"A"}, "created_by": strings.Repeat("x", 129)})
+	respInvalid := httptest.NewRecorder()
+	router.ServeHTTP(respInvalid, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(tooLong)))
+	if respInvalid.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an overlong author, got %d", respInvalid.Code)
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/stream?created_by=alice", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+	seen := map[string]bool{}
+	decoder := json.NewDecoder(resp.Body)
+	for decoder.More() {
+		var node models.Node
+		if err := decoder.Decode(&node); err != nil {
+			t.Fatalf("Failed to decode streamed node: %v", err)
+		}
+		if node.CreatedBy != "alice" {
+			t.Fatalf("Expected only alice's nodes, got %+v", node)
+		}
+		seen[node.ID] = true
+	}
+	if len(seen) != 2 || !seen["A"] || !seen["C"] {
+		t.Fatalf("Expected nodes A and C, got %v", seen)
+	}
+}
+
+func TestLimitConcurrency_RejectsWhenSaturated(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	handler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+	handler.SetConcurrencyLimits(0, 1)
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	blocking := handler.LimitConcurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", nil))
+		close(done)
+	}()
+	<-entered
+
+	respStats := httptest.NewRecorder()
+	handler.GetStats(respStats, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats models.Stats
+	json.Unmarshal(respStats.Body.Bytes(), &stats)
+	if stats.InFlightWrites != 1 {
+		t.Fatalf("Expected 1 in-flight write, got %d", stats.InFlightWrites)
+	}
+
+	respRejected := httptest.NewRecorder()
+	blocking.ServeHTTP(respRejected, httptest.NewRequest(http.MethodPost, "/nodes", nil))
+	if respRejected.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 when saturated, got %d", respRejected.Code)
+	}
+
+	// reads are limited separately and stay available
+	reads := handler.LimitConcurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	respRead := httptest.NewRecorder()
+	reads.ServeHTTP(respRead, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if respRead.Code != http.StatusOK {
+		t.Fatalf("Expected reads to be unaffected, got %d", respRead.Code)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestCreateGenesis(t *testing.T) {
+	router, mockRepo := testServer()
+
+	withParents, _ := json.Marshal(map[string]interface{}{"id": "G", "parents": []string{"X"}})
+	respRejected := httptest.NewRecorder()
+	router.ServeHTTP(respRejected, httptest.NewRequest(http.MethodPost, "/nodes/genesis", bytes.NewReader(withParents)))
+	if respRejected.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for genesis with parents, got %d", respRejected.Code)
+	}
+
+	genesis, _ := json.Marshal(map[string]interface{}{"id": "G", "parents": []string{}})
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/genesis", bytes.NewReader(genesis)))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.Code)
+	}
+	if _, err := mockRepo.GetNode("G"); err != nil {
+		t.Fatalf("Genesis node not stored: %v", err)
+	}
+
+	respDuplicate := httptest.NewRecorder()
+	router.ServeHTTP(respDuplicate, httptest.NewRequest(http.MethodPost, "/nodes/genesis", bytes.NewReader(genesis)))
+	if respDuplicate.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for duplicate genesis, got %d", respDuplicate.Code)
+	}
+}
+
+func TestCreateCheckpoint_ContentAddressed(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+
+	create := func() (int, models.Checkpoint) {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/checkpoints", bytes.NewReader([]byte(`{}`))))
+		var cp models.Checkpoint
+		json.Unmarshal(resp.Body.Bytes(), &cp)
+		return resp.Code, cp
+	}
+
+	code, first := create()
+	if code != http.StatusCreated || !strings.HasPrefix(first.ID, "cp-") {
+		t.Fatalf("Expected 201 with a derived ID, got %d %q", code, first.ID)
+	}
+
+	// a retry over the unchanged graph returns the same checkpoint
+	code, retry := create()
+	if code != http.StatusOK || retry.ID != first.ID || retry.Timestamp != first.Timestamp {
+		t.Fatalf("Expected 200 with checkpoint %q, got %d %q", first.ID, code, retry.ID)
+	}
+
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	code, changed := create()
+	if code != http.StatusCreated || changed.ID == first.ID {
+		t.Fatalf("Expected a new checkpoint after the graph changed, got %d %q", code, changed.ID)
+	}
+}
+
+func TestCompression_Threshold(t *testing.T) {
+	small := strings.Repeat("a", 10)
+	large := strings.Repeat("b", 4096)
+	handler := handlers.Compression(6, 1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("size") == "large" {
+			w.Write([]byte(large))
+			return
+		}
+		w.Write([]byte(small))
+	}))
+
+	request := func(size string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/?size="+size, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	respSmall := request("small")
+	if respSmall.Header().Get("Content-Encoding") != "" || respSmall.Body.String() != small {
+		t.Fatalf("Expected small response uncompressed, got encoding %q", respSmall.Header().Get("Content-Encoding"))
+	}
+
+	respLarge := request("large")
+	if respLarge.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected large response gzipped, got encoding %q", respLarge.Header().Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(respLarge.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	body, _ := io.ReadAll(reader)
+	if string(body) != large || respLarge.Body.Len() >= len(large) {
+		t.Fatalf("Expected the decompressed body to round-trip and shrink, got %d bytes", len(body))
+	}
+}
+
+func TestIsReachable(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, n := range []struct {
+		id      string
+		parents []string
+	}{
+		{"B", []string{"A"}},
+		{"C", []string{"B"}},
+		{"D", []string{"A"}},
+	} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": n.id, "parents": n.parents})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	}
+
+	cases := []struct {
+		path string
+		code int
+		want bool
+	}{
+		{"/nodes/C/reachable?from=A", http.StatusOK, true},
+		{"/nodes/C/reachable?from=D", http.StatusOK, false},
+		{"/nodes/A/reachable?from=C", http.StatusOK, false},
+		{"/nodes/C/reachable?from=missing", http.StatusNotFound, false},
+		{"/nodes/C/reachable", http.StatusBadRequest, false},
+	}
+	for _, tc := range cases {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if resp.Code != tc.code {
+			t.Fatalf("%s: expected status %d, got %d", tc.path, tc.code, resp.Code)
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		var body map[string]interface{}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		if body["reachable"] != tc.want {
+			t.Fatalf("%s: expected reachable=%v, got %v", tc.path, tc.want, body["reachable"])
+		}
+	}
+}
+
+func TestGetLineage(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/B/lineage", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var body struct {
+		Lineage []struct {
+			Node     models.Node `json:"node"`
+			Distance int         `json:"distance"`
+		} `json:"lineage"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &body)
+	if len(body.Lineage) != 1 || body.Lineage[0].Node.ID != "A" || body.Lineage[0].Distance != 1 {
+		t.Fatalf("unexpected lineage: %s", resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/A/lineage", nil))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"lineage":[]`) {
+		t.Fatalf("expected empty lineage for genesis, got %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/missing/lineage", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.Code)
+	}
+}
+
+func TestGetSiblings(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, id := range []string{"B", "C"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/B/siblings", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.Code)
+	}
+	var body struct {
+		Siblings []models.Node `json:"siblings"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &body)
+	if len(body.Siblings) != 1 || body.Siblings[0].ID != "C" {
+		t.Fatalf("unexpected siblings: %s", resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/A/siblings", nil))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"siblings":[]`) {
+		t.Fatalf("expected no siblings for genesis, got %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/missing/siblings", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.Code)
+	}
+}
+
+func TestArchiveNode(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/B/archive", nil))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"deleted":true`) {
+		t.Fatalf("expected B to be archived, got %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/B", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected archived node to be hidden, got %d", resp.Code)
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/B?include_deleted=true", nil))
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"deleted":true`) {
+		t.Fatalf("expected archived node with include_deleted, got %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/missing/archive", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.Code)
+	}
+}
+
+func TestArchiveNode_ConfirmedIsImmutable(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	cfg := dag.DefaultConfig()
+	cfg.ImmutableWeight = 1
+	router := mux.NewRouter()
+	routers.RegisterRoutes(router, handlers.NewHandler(dag.NewDAGWithConfig(newMockRepo(), cfg)))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", strings.NewReader(`{"id":"A"}`)))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", strings.NewReader(`{"id":"B","parents":["A"]}`)))
+
+	// B's approval confirmed A, so A's archive flag is frozen
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/A/archive", nil))
+	if resp.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/B/archive", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected the unconfirmed tip to be archivable, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestEmptyGraphStatus(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	paths := []string{"/nodes/highest-weight", "/nodes/highest-cumulative-weight", "/nodes/longest-chain", "/nodes/tip-selection"}
+
+	cases := []struct {
+		mode handlers.EmptyGraphMode
+		code int
+		body string
+	}{
+		{handlers.EmptyGraphNoContent, http.StatusNoContent, ""},
+		{handlers.EmptyGraphNull, http.StatusOK, "null\n"},
+	}
+	for _, tc := range cases {
+		handler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+		handler.SetEmptyGraphMode(tc.mode)
+		router := mux.NewRouter()
+		routers.RegisterRoutes(router, handler)
+
+		for _, path := range paths {
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+			if resp.Code != tc.code || resp.Body.String() != tc.body {
+				t.Fatalf("mode %d %s: expected %d %q, got %d %q", tc.mode, path, tc.code, tc.body, resp.Code, resp.Body.String())
+			}
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/tips/bulk", strings.NewReader(`{"count": 2}`)))
+		if resp.Code != tc.code {
+			t.Fatalf("mode %d bulk: expected %d, got %d", tc.mode, tc.code, resp.Code)
+		}
+	}
+
+	// the default keeps the existing error responses
+	router, _ := testServer()
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/highest-weight", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected default 404, got %d", resp.Code)
+	}
+}
+
+func TestApproveNode_ParksOrphans(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	cfg := dag.DefaultConfig()
+	cfg.ParkOrphans = true
+	handler := handlers.NewHandler(dag.NewDAGWithConfig(newMockRepo(), cfg))
+	router := mux.NewRouter()
+	routers.RegisterRoutes(router, handler)
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+
+	orphan, _ := json.Marshal(map[string]interface{}{"id": "C", "parents": []string{"B"}})
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(orphan)))
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/pending", nil))
+	var body struct {
+		Count   int                 `json:"count"`
+		Pending []models.ParkedNode `json:"pending"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &body)
+	if resp.Code != http.StatusOK || body.Count != 1 || body.Pending[0].Node.ID != "C" || body.Pending[0].Missing[0] != "B" {
+		t.Fatalf("unexpected pending list: %d %s", resp.Code, resp.Body.String())
+	}
+
+	parent, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(parent)))
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/C", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected parked node to be approved once its parent arrived, got %d", resp.Code)
+	}
+}
+
+func TestGetConfirmationReport(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/stats/confirmation?threshold=1", nil))
+	var report models.ConfirmationReport
+	json.Unmarshal(resp.Body.Bytes(), &report)
+	if resp.Code != http.StatusOK || report.NodeCount != 2 || report.ConfirmedCount != 1 || report.UnconfirmedTips != 1 {
+		t.Fatalf("unexpected report: %d %s", resp.Code, resp.Body.String())
+	}
+
+	for _, query := range []string{"", "?threshold=0", "?threshold=x"} {
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/stats/confirmation"+query, nil))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%q: expected status 400, got %d", query, resp.Code)
+		}
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for i := 0; i < 2; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nodes/tip-selection", nil))
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, adminRequest(http.MethodPost, "/admin/stats/reset"))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+	var body struct {
+		Reset models.Stats `json:"reset"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Reset.TipSelections != 2 {
+		t.Fatalf("Expected 2 discarded tip selections, got %d", body.Reset.TipSelections)
+	}
+
+	respStats := httptest.NewRecorder()
+	router.ServeHTTP(respStats, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats models.Stats
+	json.Unmarshal(respStats.Body.Bytes(), &stats)
+	if stats.TipSelections != 0 || stats.TipSelectionLatencyEMA != 0 {
+		t.Fatalf("Expected zeroed stats after reset, got %+v", stats)
+	}
+}
+
+func TestGetTipsBulk(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	for _, id := range []string{"B", "C"} {
+		approval, _ := json.Marshal(map[string]interface{}{"id": id, "parents": []string{"A"}})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/tips/bulk", strings.NewReader(`{"count":20,"max_steps":10}`)))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", resp.Code, resp.Body.String())
+	}
+	var body struct {
+		Count int           `json:"count"`
+		Tips  []models.Node `json:"tips"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &body)
+	if body.Count != 20 || len(body.Tips) != 20 {
+		t.Fatalf("Expected 20 tips, got %d (%d listed)", body.Count, len(body.Tips))
+	}
+	if steps := resp.Header().Get("X-MCMC-Steps"); steps != "200" {
+		t.Fatalf("Expected X-MCMC-Steps 200 across 20 walks, got %q", steps)
+	}
+	for _, tip := range body.Tips {
+		if tip.ID != "B" && tip.ID != "C" {
+			t.Fatalf("Expected only tips B and C, got %s", tip.ID)
+		}
+	}
+
+	for _, payload := range []string{`{"count":0}`, `{"count":101}`, `{"count":10,"budget":"1s"}`, `{"count":1,"exploration":2}`} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/nodes/tips/bulk", strings.NewReader(payload)))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", payload, resp.Code)
+		}
+	}
+}
+
+func TestGetTipMCMC_StepsHeader(t *testing.T) {
+	router, _ := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection?max_steps=25", nil))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.Code)
+	}
+	if steps := resp.Header().Get("X-MCMC-Steps"); steps != "25" {
+		t.Fatalf("Expected X-MCMC-Steps 25, got %q", steps)
+	}
+
+	// under a budget the step count varies but is always reported
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/nodes/tip-selection?budget=1ms", nil))
+	if steps, err := strconv.Atoi(resp.Header().Get("X-MCMC-Steps")); err != nil || steps <= 0 {
+		t.Fatalf("Expected a positive X-MCMC-Steps under a budget, got %q", resp.Header().Get("X-MCMC-Steps"))
+	}
+}
+
+func TestDebugKeys_PagingPolicy(t *testing.T) {
+	logger.Logger = zap.NewNop()
+	ldb, err := db.NewLevelDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open leveldb: %v", err)
+	}
+	defer ldb.Close()
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		ldb.Put([]byte(key), []byte("value"))
+	}
+
+	handler := handlers.NewHandler(dag.NewDAG(newMockRepo()))
+	handler.EnableDebug(ldb, "secret")
+	handler.SetPageSizes(2, 3)
+	router := mux.NewRouter()
+	routers.RegisterRoutes(router, handler)
+
+	cases := []struct {
+		query   string
+		code    int
+		keys    int
+		warning bool
+	}{
+		{"", http.StatusOK, 2, false},
+		{"?limit=3", http.StatusOK, 3, false},
+		{"?limit=50", http.StatusOK, 3, true},
+		{"?limit=0", http.StatusBadRequest, 0, false},
+		{"?limit=abc", http.StatusBadRequest, 0, false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/debug/keys"+tc.query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != tc.code {
+			t.Fatalf("%q: expected status %d, got %d", tc.query, tc.code, resp.Code)
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Keys  []json.RawMessage `json:"keys"`
+			Limit int               `json:"limit"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		if len(body.Keys) != tc.keys || body.Limit != tc.keys {
+			t.Fatalf("%q: expected %d keys and limit, got %d keys, limit %d", tc.query, tc.keys, len(body.Keys), body.Limit)
+		}
+		if warned := resp.Header().Get("Warning") != ""; warned != tc.warning {
+			t.Fatalf("%q: expected warning header %v, got %q", tc.query, tc.warning, resp.Header().Get("Warning"))
+		}
+	}
+}
+
+func TestGetNode_Verify(t *testing.T) {
+	router, mockRepo := testServer()
+
+	nodeA, _ := json.Marshal(map[string]interface{}{"id": "A", "parents": []string{}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes", bytes.NewReader(nodeA)))
+	approval, _ := json.Marshal(map[string]interface{}{"id": "B", "parents": []string{"A"}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/nodes/approve", bytes.NewReader(approval)))
+
+	type verified struct {
+		ID          string                  `json:"id"`
+		Consistency *models.NodeConsistency `json:"consistency"`
+	}
+	get := func(path string) (int, verified) {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		var body verified
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		return resp.Code, body
+	}
+
+	code, body := get("/nodes/A?verify=true")
+	if code != http.StatusOK || body.ID != "A" || body.Consistency == nil || !body.Consistency.Consistent {
+		t.Fatalf("Expected consistent node A, got %d %+v", code, body.Consistency)
+	}
+
+	// drift the stored weights behind the DAG's back
+	drifted, _ := mockRepo.GetNode("A")
+	drifted.Weight, drifted.CumulativeWeight = 0, 0
+	mockRepo.PutNode(drifted)
+
+	_, body = get("/nodes/A?verify=true")
+	c := body.Consistency
+	if c == nil || c.Consistent || c.ExpectedWeight != 1 || c.StoredWeight != 0 || c.ExpectedCumulativeWeight != 1 {
+		t.Fatalf("Expected drift to be reported, got %+v", c)
+	}
+
+	if _, body = get("/nodes/A"); body.Consistency != nil {
+		t.Fatal("Expected no consistency object without verify")
+	}
+	if code, _ := get("/nodes/A?verify=maybe"); code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an invalid verify value, got %d", code)
+	}
+	if code, _ := get("/nodes/missing?verify=true"); code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a missing node, got %d", code)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// inflightLimit bounds concurrent requests of one class; a nil slots channel means unlimited
+type inflightLimit struct {
+	slots   chan struct{}
+	current atomic.Int64
+}
+
+func newInflightLimit(max int) *inflightLimit {
+	l := &inflightLimit{}
+	if max > 0 {
+		l.slots = make(chan struct{}, max)
+	}
+	return l
+}
+
+// acquire takes a slot without waiting and reports whether one was free
+func (l *inflightLimit) acquire() bool {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	l.current.Add(1)
+	return true
+}
+
+func (l *inflightLimit) release() {
+	l.current.Add(-1)
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// SetConcurrencyLimits bounds in-flight reads and writes separately; 0 is unlimited.
+// Call it before serving requests.
+func (h *Handler) SetConcurrencyLimits(maxReads, maxWrites int) {
+	h.reads = newInflightLimit(maxReads)
+	h.writes = newInflightLimit(maxWrites)
+}
+
+// LimitConcurrency is middleware that rejects requests with 503 once the in-flight
+// limit for their class is reached, giving backpressure instead of piling up
+// goroutines behind the DAG lock. GET, HEAD and OPTIONS count as reads.
+func (h *Handler) LimitConcurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := h.writes
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			limit = h.reads
+		}
+		if !limit.acquire() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "server is at its concurrent request limit, retry later",
+			})
+			return
+		}
+		defer limit.release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Paging policy used until SetPageSizes overrides it
+const (
+	defaultPageSize = 100
+	defaultMaxPage  = 1000
+)
+
+// SetPageSizes sets the page size used when a list request omits limit and the
+// largest page a request may ask for. Call it before serving requests.
+func (h *Handler) SetPageSizes(defaultSize, maxSize int) {
+	h.pageSize = defaultSize
+	h.maxPageSize = maxSize
+}
+
+// pageLimit reads the limit query parameter under the paging policy shared by every
+// list-style endpoint. A missing limit uses the default page size; one above the
+// maximum is clamped and flagged with a Warning header so the client can tell its
+// page is smaller than asked. A malformed or non-positive limit is answered with
+// 400 and ok is false.
+func (h *Handler) pageLimit(w http.ResponseWriter, r *http.Request) (limit int, ok bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return h.pageSize, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "limit must be a positive integer"})
+		return 0, false
+	}
+	if limit > h.maxPageSize {
+		w.Header().Set("Warning", fmt.Sprintf(`299 - "limit %d exceeds the maximum page size, clamped to %d"`, limit, h.maxPageSize))
+		limit = h.maxPageSize
+	}
+	return limit, true
+}
+
+// pageOffset reads the offset query parameter of offset-paged endpoints. A missing
+// offset starts at the beginning; a malformed or negative one is answered with 400
+// and ok is false.
+func pageOffset(w http.ResponseWriter, r *http.Request) (offset int, ok bool) {
+	raw := r.URL.Query().Get("offset")
+	if raw == "" {
+		return 0, true
+	}
+	offset, err := strconv.Atoi(raw)
+	if err != nil || offset < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "offset must be a non-negative integer"})
+		return 0, false
+	}
+	return offset, true
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"dag-project/dag"
+	"dag-project/logger"
+)
+
+// defaultMinParents keeps the historical rule that an approval needs a parent
+const defaultMinParents = 1
+
+// SetParentLimits sets how many parents an approval must list. Pass the limit the
+// DAG enforces, dag.EffectiveMaxParents, as maxParents so both report the same
+// bound; 0 skips the upper check here. Call it before serving requests.
+func (h *Handler) SetParentLimits(minParents, maxParents int) {
+	h.minParents = minParents
+	h.maxParents = maxParents
+}
+
+// attachParentLimit is the most tips an attach may ask for: the configured parent
+// limit, or the DAG's default when none is set
+func (h *Handler) attachParentLimit() int {
+	if h.maxParents > 0 {
+		return h.maxParents
+	}
+	return dag.EffectiveMaxParents(0)
+}
+
+// checkParentCount answers 400 and returns false when an approval lists fewer or
+// more parents than the configured limits allow
+func (h *Handler) checkParentCount(w http.ResponseWriter, id string, count int) bool {
+	var msg string
+	switch {
+	case count < h.minParents && h.minParents == 1:
+		msg = "Approved nodes must reference at least one parent node"
+	case count < h.minParents:
+		msg = fmt.Sprintf("Approved nodes must reference at least %d parent nodes", h.minParents)
+	case h.maxParents > 0 && count > h.maxParents:
+		msg = fmt.Sprintf("Approved nodes must reference at most %d parent nodes", h.maxParents)
+	default:
+		return true
+	}
+
+	logger.Logger.Warn("Approval parent count out of range", zap.String("node_id", id), zap.Int("parents", count))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+	return false
+}
+
+// countDistinct returns how many different IDs ids holds
+func countDistinct(ids []string) int {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return len(seen)
+}
@@ -1,18 +1,71 @@
 package models
 
+import "encoding/json"
+
 type Node struct {
-	ID               string   `json:"id"`                // unique id
-	Parents          []string `json:"parents"`           // parent node IDs
-	Weight           int      `json:"weight"`            // direct weight based on approvals
-	CumulativeWeight int64    `json:"cumulative_weight"` // total weight including indirect approvals
-	CreatedAt        int64    `json:"created_at"`        // unix timestamp in ms
+	ID               string          `json:"id"`                   // unique id
+	Parents          []string        `json:"parents"`              // parent node IDs
+	Weight           int             `json:"weight"`               // direct weight based on approvals
+	CumulativeWeight int64           `json:"cumulative_weight"`    // total weight including indirect approvals
+	CreatedAt        int64           `json:"created_at"`           // unix timestamp in ms
+	Deleted          bool            `json:"deleted,omitempty"`    // archived: kept for its children but no longer live
+	Data             json.RawMessage `json:"data,omitempty"`       // opaque client payload, stored as sent
+	CreatedBy        string          `json:"created_by,omitempty"` // actor that created the node
+	// Annotations are mutable operational notes, outside the hashed content
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Batch approval outcomes
+const (
+	BatchStatusApproved = "approved"
+	BatchStatusFailed   = "failed"
+)
+
+type BatchResult struct {
+	Index  int    `json:"index"`           // position of the node in the submitted batch
+	ID     string `json:"id"`              // node ID from the batch
+	Status string `json:"status"`          // approved | failed
+	Error  string `json:"error,omitempty"` // reason when the approval failed
+}
+
+// ParkedNode is an approval held back until its missing parents arrive
+type ParkedNode struct {
+	Node     *Node    `json:"node"`
+	Missing  []string `json:"missing"`   // parent IDs not stored yet
+	ParkedAt int64    `json:"parked_at"` // unix timestamp in ms
 }
 
 type Checkpoint struct {
 	ID        string `json:"checkpoint_id"` // checkpoint ID
 	Timestamp int64  `json:"timestamp"`     // when the checkpoint was created
 	RootHash  string `json:"root_hash"`     // Merkle root / hash of DAG state
+	HashAlgo  string `json:"hash_algo"`     // algorithm used to compute RootHash
 	NodeCount int    `json:"node_count"`    // how many nodes up to this checkpoint
+	// RootFormat is "merkle" for Merkle roots; empty for older checkpoints whose
+	// RootHash hashes the concatenated node IDs
+	RootFormat string `json:"root_format,omitempty"`
+}
+
+// MerkleProof shows that a node is a leaf of a Merkle root
+type MerkleProof struct {
+	NodeID    string   `json:"node_id"`
+	Leaf      string   `json:"leaf"`       // hash of the node's leaf
+	Index     int      `json:"index"`      // position of the leaf among the leaves sorted by node ID
+	LeafCount int      `json:"leaf_count"` // number of leaves, which decides where a hash has no sibling
+	Proof     []string `json:"proof"`      // sibling hashes from the leaf up to the root
+	Root      string   `json:"root"`
+	HashAlgo  string   `json:"hash_algo"`
+}
+
+// CheckpointDiff describes how the graph changed between two checkpoints
+type CheckpointDiff struct {
+	From           string   `json:"from"`
+	To             string   `json:"to"`
+	NodeCountDelta int      `json:"node_count_delta"`
+	Detailed       bool     `json:"detailed"`          // false when a checkpoint predates per-node digests
+	Added          []string `json:"added,omitempty"`   // node IDs only in To
+	Removed        []string `json:"removed,omitempty"` // node IDs only in From
+	Changed        []string `json:"changed,omitempty"` // node IDs whose parents, flags or content differ
 }
 
 type SyncState struct {
@@ -21,4 +74,89 @@ type SyncState struct {
 	TipCount         int         `json:"tip_count"`
 	RootHash         string      `json:"root_hash"`
 	Timestamp        int64       `json:"timestamp"`
+	// PendingPropagations counts queued weight updates not yet applied (async mode only)
+	PendingPropagations int64 `json:"pending_propagations"`
+}
+
+type Stats struct {
+	GraphSummary
+	TipSelectionLatencyEMA float64 `json:"tip_selection_latency_ema_ms"` // moving average of tip-selection duration
+	TipSelections          int64   `json:"tip_selections"`               // number of tip selections folded into the average
+	InFlightReads          int64   `json:"in_flight_reads"`              // read requests currently being served
+	InFlightWrites         int64   `json:"in_flight_writes"`             // write requests currently being served
+}
+
+// GraphSummary is the shape of the graph reported alongside the runtime stats
+type GraphSummary struct {
+	NodeCount                 int     `json:"node_count"`
+	TipCount                  int     `json:"tip_count"`
+	MaxDepth                  int     `json:"max_depth"`                              // longest chain below a genesis node, genesis being 0
+	AverageWeight             float64 `json:"average_weight"`                         // mean direct weight over all stored nodes
+	HighestCumulativeWeightID string  `json:"highest_cumulative_weight_id,omitempty"` // live node with the highest cumulative weight
+	LatestCheckpointID        string  `json:"latest_checkpoint_id,omitempty"`
+}
+
+type LifetimeStats struct {
+	Additions uint64 `json:"additions"` // nodes ever created via AddNode
+	Approvals uint64 `json:"approvals"` // nodes ever approved
+}
+
+// Export is a full dump of one instance's nodes, used to merge instances
+type Export struct {
+	Nodes      []*Node `json:"nodes"`
+	ExportedAt int64   `json:"exported_at"` // unix timestamp in ms
+}
+
+type MergeConflict struct {
+	ID     string `json:"id"`     // node ID that could not be merged
+	Reason string `json:"reason"` // why the node was not merged
+}
+
+type MergeResult struct {
+	Added      int             `json:"added"`      // nodes missing locally that were stored
+	Skipped    int             `json:"skipped"`    // nodes already present with identical parents
+	Conflicted int             `json:"conflicted"` // nodes that differ or cannot be attached
+	Conflicts  []MergeConflict `json:"conflicts,omitempty"`
+}
+
+// Event types published to external subscribers
+const (
+	EventNodeAdded         = "node.added"
+	EventNodeApproved      = "node.approved"
+	EventCheckpointCreated = "checkpoint.created"
+)
+
+// Event describes a committed change, delivered to webhooks
+type Event struct {
+	Type       string      `json:"type"`      // one of the Event* constants
+	Timestamp  int64       `json:"timestamp"` // unix timestamp in ms
+	Node       *Node       `json:"node,omitempty"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+type ShapeReport struct {
+	NodeCount        int         `json:"node_count"`
+	Components       int         `json:"components"`        // weakly-connected components
+	Diameter         int         `json:"diameter"`          // longest shortest directed path, in edges
+	DiameterComputed bool        `json:"diameter_computed"` // false when the graph exceeded the size guard
+	OutDegrees       map[int]int `json:"out_degrees"`       // children count -> number of nodes
+}
+
+type ConfirmationReport struct {
+	Threshold               int64          `json:"threshold"`                     // cumulative weight counted as confirmed
+	NodeCount               int            `json:"node_count"`                    // live nodes scanned
+	ConfirmedCount          int            `json:"confirmed_count"`               // nodes reaching the threshold
+	ConfirmationRate        float64        `json:"confirmation_rate"`             // confirmed_count / node_count
+	AverageCumulativeWeight float64        `json:"average_cumulative_weight"`     // mean over live nodes
+	UnconfirmedTips         int            `json:"unconfirmed_tips"`              // tips below the threshold
+	OldestUnconfirmedTipAge int64          `json:"oldest_unconfirmed_tip_age_ms"` // age of the longest-waiting tip
+	TipAges                 map[string]int `json:"unconfirmed_tip_ages"`          // age bucket -> unconfirmed tips
+}
+
+type NodeConsistency struct {
+	Consistent               bool  `json:"consistent"`                 // stored weights match the expected ones
+	StoredWeight             int   `json:"stored_weight"`              // direct weight as persisted
+	ExpectedWeight           int   `json:"expected_weight"`            // number of children in the live graph
+	StoredCumulativeWeight   int64 `json:"stored_cumulative_weight"`   // cumulative weight as persisted
+	ExpectedCumulativeWeight int64 `json:"expected_cumulative_weight"` // recomputed from the live graph
 }
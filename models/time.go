@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TimestampLayout renders timestamps as RFC 3339 with millisecond precision
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// FormatTimestamp renders a unix millisecond timestamp, as stored in CreatedAt,
+// checkpoint and event timestamps, in UTC so that output from instances in
+// different time zones compares equal
+func FormatTimestamp(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format(TimestampLayout)
+}
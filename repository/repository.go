@@ -1,28 +1,176 @@
 package repository
 
 import (
+	"crypto/sha1"
 	"dag-project/db"
 	"dag-project/models"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Key prefixes for records that share the keyspace with nodes
+const (
+	checkpointPrefix = "checkpoint:"
+	// checkpointNodesPrefix holds the per-node digests captured with a checkpoint
+	checkpointNodesPrefix = "checkpoint-nodes:"
+	// checkpointFrozenPrefix holds the IDs of the nodes frozen when a checkpoint was taken
+	checkpointFrozenPrefix = "checkpoint-frozen:"
+	counterPrefix          = "counter:"
+	// nodePrefix namespaces node keys under every key scheme
+	nodePrefix = "node:"
+	// parkedPrefix holds approvals parked until their missing parents arrive
+	parkedPrefix = "parked:"
+	// healthProbeKey is looked up by Ping; it is never written
+	healthProbeKey = "health:probe"
+)
+
+// reservedPrefixes mark the records that are not legacy node keys during migration
+var reservedPrefixes = []string{checkpointPrefix, checkpointNodesPrefix, checkpointFrozenPrefix, counterPrefix, nodePrefix, parkedPrefix}
+
+// migrationBatchSize bounds how many legacy keys one migration batch moves
+const migrationBatchSize = 1000
+
+// Durable lifetime counters
+const (
+	CounterAdditions = "additions"
+	CounterApprovals = "approvals"
+)
+
+// NodeOrder controls the order in which listed nodes are returned
+type NodeOrder int
+
+const (
+	// OrderStorage returns nodes in LevelDB key order, skipping the sort
+	OrderStorage NodeOrder = iota
+	// OrderCreatedAt returns nodes by creation time, ties broken by ID
+	OrderCreatedAt
+)
+
+// ParseNodeOrder converts a config value into a NodeOrder
+func ParseNodeOrder(s string) (NodeOrder, error) {
+	switch s {
+	case "", "created_at":
+		return OrderCreatedAt, nil
+	case "storage":
+		return OrderStorage, nil
+	}
+	return OrderStorage, fmt.Errorf("unknown node order %q", s)
+}
+
+// SortNodes orders nodes in place according to order
+func SortNodes(nodes []*models.Node, order NodeOrder) {
+	if order != OrderCreatedAt {
+		return
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].CreatedAt != nodes[j].CreatedAt {
+			return nodes[i].CreatedAt < nodes[j].CreatedAt
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+}
+
+// KeyScheme decides how a node ID maps to its LevelDB key
+type KeyScheme int
+
+const (
+	// KeyPlain stores a node under node:<id>, so no node key can fall into the
+	// range of another record type such as checkpoint:
+	KeyPlain KeyScheme = iota
+	// KeyHashed stores a node under node:<first 8 hex digits of sha1(id)>:<id>.
+	// Clustered IDs such as sequence numbers then spread across the keyspace instead
+	// of all landing in one hot range, while the key is still derived from the ID
+	// alone, so lookups by ID need no index. Nodes are iterated in hash order.
+	KeyHashed
 )
 
+// ParseKeyScheme converts a config value into a KeyScheme
+func ParseKeyScheme(s string) (KeyScheme, error) {
+	switch s {
+	case "", "plain":
+		return KeyPlain, nil
+	case "hashed":
+		return KeyHashed, nil
+	}
+	return KeyPlain, fmt.Errorf("unknown key scheme %q", s)
+}
+
+// Options configure NewNodeRepositoryWithOptions
+type Options struct {
+	// KeyScheme is the node key layout. It must match the layout the store was
+	// written with; nodes stored under the other scheme are not visible.
+	KeyScheme KeyScheme
+}
+
 // It abstracts the storage layer from the business logic
 type NodeRepositoryInterface interface {
 	PutNode(node *models.Node) error
+	PutNodeCounted(node *models.Node, counter string) error
+	GetCounter(name string) (uint64, error)
 	GetNode(id string) (*models.Node, error)
+	HasNode(id string) (bool, error)
+	DeleteNode(id string) error
+	DeleteNodes(ids []string) error
 	GetAllNodes() ([]*models.Node, error)
+	EachNode(fn func(*models.Node) error) error
+	ListNodes(order NodeOrder) ([]*models.Node, error)
 	PutCheckpoint(cp *models.Checkpoint) error
+	PutCheckpointWithNodes(cp *models.Checkpoint, digests map[string]string, frozen []string) error
+	HasCheckpoint(id string) (bool, error)
+	GetCheckpoint(id string) (*models.Checkpoint, error)
+	GetCheckpointNodes(id string) (map[string]string, error)
+	GetCheckpointFrozen(id string) ([]string, error)
 	GetLatestCheckpoint() (*models.Checkpoint, error)
+	PutParked(p *models.ParkedNode) error
+	DeleteParked(id string) error
+	GetAllParked() ([]*models.ParkedNode, error)
+	Ping() error
 }
 
 // NodeRepository implements the NodeRepositoryInterface using LevelDB as the storage backend
 type NodeRepository struct {
-	db *db.LevelDB
+	db   *db.LevelDB
+	opts Options
 }
 
-// NewNodeRepository creates and returns a new NodeRepository instance
+// NewNodeRepository creates and returns a new NodeRepository instance using plain node keys
 func NewNodeRepository(db *db.LevelDB) *NodeRepository {
-	return &NodeRepository{db: db}
+	return NewNodeRepositoryWithOptions(db, Options{})
+}
+
+// NewNodeRepositoryWithOptions creates a NodeRepository with the given key layout
+func NewNodeRepositoryWithOptions(db *db.LevelDB, opts Options) *NodeRepository {
+	return &NodeRepository{db: db, opts: opts}
+}
+
+// nodeKey derives the storage key of a node ID under the configured scheme
+func (r *NodeRepository) nodeKey(id string) []byte {
+	if r.opts.KeyScheme != KeyHashed {
+		return []byte(nodePrefix + id)
+	}
+	sum := sha1.Sum([]byte(id))
+	return []byte(nodePrefix + hex.EncodeToString(sum[:])[:8] + ":" + id)
+}
+
+// ownsKey reports whether a key under nodePrefix was written by the configured
+// scheme. Hashed keys continue with 8 hex digits and ':'; the DAG rejects node IDs
+// containing ':', so no plain key has that shape.
+func (r *NodeRepository) ownsKey(key []byte) bool {
+	rest := string(key[len(nodePrefix):])
+	hashed := len(rest) > 8 && rest[8] == ':'
+	if hashed {
+		_, err := hex.DecodeString(rest[:8])
+		hashed = err == nil
+	}
+	return hashed == (r.opts.KeyScheme == KeyHashed)
 }
 
 // PutNode stores a node in the LevelDB storage
@@ -31,12 +179,61 @@ func (r *NodeRepository) PutNode(node *models.Node) error {
 	if err != nil {
 		return err
 	}
-	return r.db.Put([]byte(node.ID), data)
+	return r.db.Put(r.nodeKey(node.ID), data)
+}
+
+// PutNodes stores several nodes in one atomic batch instead of one write per node,
+// for bulk imports. Nothing is written if any node fails to marshal.
+func (r *NodeRepository) PutNodes(nodes []*models.Node) error {
+	pairs := make(map[string][]byte, len(nodes))
+	for _, node := range nodes {
+		data, err := json.Marshal(node)
+		if err != nil {
+			return fmt.Errorf("marshaling node %s: %w", node.ID, err)
+		}
+		pairs[string(r.nodeKey(node.ID))] = data
+	}
+	return r.db.PutBatch(pairs)
+}
+
+// PutNodeCounted stores a node and increments the named lifetime counter in one atomic batch
+func (r *NodeRepository) PutNodeCounted(node *models.Node, counter string) error {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	count, err := r.GetCounter(counter)
+	if err != nil {
+		return err
+	}
+
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, count+1)
+
+	batch := new(leveldb.Batch)
+	batch.Put(r.nodeKey(node.ID), data)
+	batch.Put([]byte(counterPrefix+counter), value)
+	return r.db.Write(batch)
+}
+
+// GetCounter returns the value of a lifetime counter, zero if it was never incremented
+func (r *NodeRepository) GetCounter(name string) (uint64, error) {
+	data, err := r.db.Get([]byte(counterPrefix + name))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, fmt.Errorf("corrupt counter %q", name)
+	}
+	return binary.BigEndian.Uint64(data), nil
 }
 
 // GetNode retrieves a node from LevelDB storage by its ID
 func (r *NodeRepository) GetNode(id string) (*models.Node, error) {
-	data, err := r.db.Get([]byte(id))
+	data, err := r.db.Get(r.nodeKey(id))
 	if err != nil {
 		return nil, err
 	}
@@ -47,20 +244,114 @@ func (r *NodeRepository) GetNode(id string) (*models.Node, error) {
 	return &node, nil
 }
 
+// HasNode reports whether a node with the given ID is stored
+func (r *NodeRepository) HasNode(id string) (bool, error) {
+	return r.db.Has(r.nodeKey(id))
+}
+
+// DeleteNode removes a node's record. It doesn't touch nodes referencing it.
+func (r *NodeRepository) DeleteNode(id string) error {
+	return r.db.Delete(r.nodeKey(id))
+}
+
+// DeleteNodes removes several nodes' records in one atomic batch
+func (r *NodeRepository) DeleteNodes(ids []string) error {
+	batch := new(leveldb.Batch)
+	for _, id := range ids {
+		batch.Delete(r.nodeKey(id))
+	}
+	return r.db.Write(batch)
+}
+
 // GetAllNodes retrieves all nodes from the LevelDB storage
 func (r *NodeRepository) GetAllNodes() ([]*models.Node, error) {
-	iter := r.db.NewIterator()
+	var nodes []*models.Node
+	err := r.EachNode(func(node *models.Node) error {
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// EachNode calls fn for every stored node in key order straight from the iterator,
+// so nothing is materialized. A non-nil error from fn stops the iteration and is returned.
+// Node keys of both schemes share one prefix and are iterated as one range; keys
+// written under the other scheme are skipped.
+func (r *NodeRepository) EachNode(fn func(*models.Node) error) error {
+	iter := r.db.NewPrefixIterator([]byte(nodePrefix))
 	defer iter.Release()
 
-	var nodes []*models.Node
 	for iter.Next() {
+		if !r.ownsKey(iter.Key()) {
+			continue
+		}
 		var node models.Node
 		if err := json.Unmarshal(iter.Value(), &node); err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(&node); err != nil {
+			return err
 		}
-		nodes = append(nodes, &node)
 	}
-	return nodes, iter.Error()
+	return iter.Error()
+}
+
+// MigrateLegacyKeys moves nodes stored under their bare ID, the plain layout
+// before node keys were namespaced, to their key under the configured scheme, and
+// returns how many it moved. Each batch writes the new keys and deletes the old
+// ones atomically, so an interrupted migration resumes on the next call. Stores
+// without legacy keys are left untouched, so it is safe to call on every startup.
+func (r *NodeRepository) MigrateLegacyKeys() (int, error) {
+	iter := r.db.NewIterator()
+	defer iter.Release()
+
+	moved := 0
+	batch := new(leveldb.Batch)
+	ok := iter.First()
+	for ok {
+		key := iter.Key()
+		if prefix := reservedPrefixOf(string(key)); prefix != "" {
+			ok = iter.Seek(util.BytesPrefix([]byte(prefix)).Limit)
+			continue
+		}
+		var node models.Node
+		if err := json.Unmarshal(iter.Value(), &node); err != nil {
+			return moved, fmt.Errorf("legacy node key %q: %w", key, err)
+		}
+		batch.Put(r.nodeKey(node.ID), append([]byte(nil), iter.Value()...))
+		batch.Delete(append([]byte(nil), key...))
+		if batch.Len() >= 2*migrationBatchSize {
+			if err := r.db.Write(batch); err != nil {
+				return moved, err
+			}
+			moved += batch.Len() / 2
+			batch.Reset()
+		}
+		ok = iter.Next()
+	}
+	if err := iter.Error(); err != nil {
+		return moved, err
+	}
+	if batch.Len() > 0 {
+		if err := r.db.Write(batch); err != nil {
+			return moved, err
+		}
+		moved += batch.Len() / 2
+	}
+	return moved, nil
+}
+
+// ListNodes retrieves all nodes in the requested order
+func (r *NodeRepository) ListNodes(order NodeOrder) ([]*models.Node, error) {
+	nodes, err := r.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	SortNodes(nodes, order)
+	return nodes, nil
 }
 
 // Creates a new checkpoint by storing the current state of the DAG
@@ -69,28 +360,153 @@ func (r *NodeRepository) PutCheckpoint(cp *models.Checkpoint) error {
 	if err != nil {
 		return err
 	}
-	key := []byte("checkpoint:" + cp.ID)
+	key := []byte(checkpointPrefix + cp.ID)
 	return r.db.Put(key, data)
 }
 
-// Retrieves the most recent checkpoint to restore the DAG state
+// PutCheckpointWithNodes stores a checkpoint together with the per-node digests
+// (node ID to digest) it covers and the IDs of the nodes frozen at that point, in
+// one batch so none of them exists without the others
+func (r *NodeRepository) PutCheckpointWithNodes(cp *models.Checkpoint, digests map[string]string, frozen []string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	nodes, err := json.Marshal(digests)
+	if err != nil {
+		return err
+	}
+	if frozen == nil {
+		frozen = []string{}
+	}
+	frozenIDs, err := json.Marshal(frozen)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(checkpointPrefix+cp.ID), data)
+	batch.Put([]byte(checkpointNodesPrefix+cp.ID), nodes)
+	batch.Put([]byte(checkpointFrozenPrefix+cp.ID), frozenIDs)
+	return r.db.Write(batch)
+}
+
+// HasCheckpoint reports whether a checkpoint with the given ID is stored
+func (r *NodeRepository) HasCheckpoint(id string) (bool, error) {
+	return r.db.Has([]byte(checkpointPrefix + id))
+}
+
+// GetCheckpoint retrieves a checkpoint by ID
+func (r *NodeRepository) GetCheckpoint(id string) (*models.Checkpoint, error) {
+	data, err := r.db.Get([]byte(checkpointPrefix + id))
+	if err != nil {
+		return nil, err
+	}
+	var cp models.Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// GetCheckpointNodes returns the per-node digests stored with a checkpoint, or nil
+// when the checkpoint was stored without them
+func (r *NodeRepository) GetCheckpointNodes(id string) (map[string]string, error) {
+	data, err := r.db.Get([]byte(checkpointNodesPrefix + id))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var digests map[string]string
+	if err := json.Unmarshal(data, &digests); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// GetCheckpointFrozen returns the IDs of the nodes frozen when a checkpoint was
+// taken, or nil when the checkpoint was stored without them
+func (r *NodeRepository) GetCheckpointFrozen(id string) ([]string, error) {
+	data, err := r.db.Get([]byte(checkpointFrozenPrefix + id))
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	frozen := []string{}
+	if err := json.Unmarshal(data, &frozen); err != nil {
+		return nil, err
+	}
+	return frozen, nil
+}
+
+// Retrieves the most recent checkpoint to restore the DAG state, iterating only the
+// checkpoint range
 func (r *NodeRepository) GetLatestCheckpoint() (*models.Checkpoint, error) {
-	iter := r.db.NewIterator()
+	iter := r.db.NewPrefixIterator([]byte(checkpointPrefix))
 	defer iter.Release()
 
 	var latest *models.Checkpoint
 	for iter.Next() {
-		key := string(iter.Key())
-		if len(key) >= 11 && key[:11] == "checkpoint:" {
-			var cp models.Checkpoint
-			if err := json.Unmarshal(iter.Value(), &cp); err != nil {
-				return nil, err
-			}
-			if latest == nil || cp.Timestamp > latest.Timestamp {
-				latest = &cp
-			}
+		var cp models.Checkpoint
+		if err := json.Unmarshal(iter.Value(), &cp); err != nil {
+			return nil, err
+		}
+		if latest == nil || cp.Timestamp > latest.Timestamp {
+			latest = &cp
 		}
 	}
 	return latest, iter.Error()
 }
-	
\ No newline at end of file
+
+// PutParked stores an approval parked until its missing parents arrive, so it
+// survives a restart; Missing is not stored, it is derived again on load
+func (r *NodeRepository) PutParked(p *models.ParkedNode) error {
+	record := *p
+	record.Missing = nil
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	return r.db.Put([]byte(parkedPrefix+p.Node.ID), data)
+}
+
+// DeleteParked removes a parked approval once it is released or dropped
+func (r *NodeRepository) DeleteParked(id string) error {
+	return r.db.Delete([]byte(parkedPrefix + id))
+}
+
+// GetAllParked returns every stored parked approval, in ID order
+func (r *NodeRepository) GetAllParked() ([]*models.ParkedNode, error) {
+	iter := r.db.NewPrefixIterator([]byte(parkedPrefix))
+	defer iter.Release()
+
+	var parked []*models.ParkedNode
+	for iter.Next() {
+		var p models.ParkedNode
+		if err := json.Unmarshal(iter.Value(), &p); err != nil {
+			return nil, err
+		}
+		parked = append(parked, &p)
+	}
+	return parked, iter.Error()
+}
+
+// Ping reports whether the storage answers reads, looking up a sentinel key
+func (r *NodeRepository) Ping() error {
+	_, err := r.db.Has([]byte(healthProbeKey))
+	return err
+}
+
+// reservedPrefixOf returns the reserved prefix a key belongs to, or "" for a legacy node key
+func reservedPrefixOf(key string) string {
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+package repository_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"dag-project/db"
+	"dag-project/models"
+	"dag-project/repository"
+)
+
+func newTestRepo(tb testing.TB, scheme repository.KeyScheme) (*repository.NodeRepository, *db.LevelDB) {
+	tb.Helper()
+	ldb, err := db.NewLevelDB(filepath.Join(tb.TempDir(), "data"))
+	if err != nil {
+		tb.Fatalf("failed to open leveldb: %v", err)
+	}
+	tb.Cleanup(func() { ldb.Close() })
+	return repository.NewNodeRepositoryWithOptions(ldb, repository.Options{KeyScheme: scheme}), ldb
+}
+
+func TestPing(t *testing.T) {
+	repo, ldb := newTestRepo(t, repository.KeyPlain)
+
+	if err := repo.Ping(); err != nil {
+		t.Fatalf("expected an open store to answer, got %v", err)
+	}
+	if ok, _ := ldb.Has([]byte("health:probe")); ok {
+		t.Fatal("ping must not write its sentinel key")
+	}
+	ldb.Close()
+	if err := repo.Ping(); err == nil {
+		t.Fatal("expected a closed store to fail the ping")
+	}
+}
+
+func TestHashedKeyScheme(t *testing.T) {
+	repo, ldb := newTestRepo(t, repository.KeyHashed)
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := repo.PutNode(&models.Node{ID: id}); err != nil {
+			t.Fatalf("failed to put %s: %v", id, err)
+		}
+	}
+	if err := repo.PutCheckpoint(&models.Checkpoint{ID: "cp"}); err != nil {
+		t.Fatalf("failed to put checkpoint: %v", err)
+	}
+
+	node, err := repo.GetNode("2")
+	if err != nil || node.ID != "2" {
+		t.Fatalf("expected lookup by original ID, got %v (err %v)", node, err)
+	}
+	if ok, _ := ldb.Has([]byte("2")); ok {
+		t.Fatalf("node must not be stored under its plain key")
+	}
+	if ok, _ := repo.HasNode("3"); !ok {
+		t.Fatalf("expected HasNode to find node 3")
+	}
+
+	nodes, err := repo.GetAllNodes()
+	if err != nil {
+		t.Fatalf("GetAllNodes failed: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected 3 nodes without the checkpoint, got %d", len(nodes))
+	}
+	if cp, err := repo.GetLatestCheckpoint(); err != nil || cp == nil || cp.ID != "cp" {
+		t.Fatalf("expected checkpoint cp, got %v (err %v)", cp, err)
+	}
+}
+
+func TestPlainKeyScheme_PrefixIsolation(t *testing.T) {
+	repo, _ := newTestRepo(t, repository.KeyPlain)
+
+	// "checkpoint" and "counters" sort next to the reserved ranges without being in them
+	ids := []string{"a", "checkpoint", "counters", "d", "z"}
+	for _, id := range ids {
+		if err := repo.PutNodeCounted(&models.Node{ID: id}, repository.CounterAdditions); err != nil {
+			t.Fatalf("failed to put %s: %v", id, err)
+		}
+	}
+	for i, id := range []string{"cp1", "cp2", "cp0"} {
+		if err := repo.PutCheckpoint(&models.Checkpoint{ID: id, Timestamp: int64(i)}); err != nil {
+			t.Fatalf("failed to put checkpoint %s: %v", id, err)
+		}
+	}
+
+	nodes, err := repo.GetAllNodes()
+	if err != nil {
+		t.Fatalf("GetAllNodes failed: %v", err)
+	}
+	if len(nodes) != len(ids) {
+		t.Fatalf("expected %d nodes, got %d", len(ids), len(nodes))
+	}
+	for i, id := range ids {
+		if nodes[i].ID != id {
+			t.Fatalf("node %d: expected %s, got %s", i, id, nodes[i].ID)
+		}
+	}
+	if cp, err := repo.GetLatestCheckpoint(); err != nil || cp == nil || cp.ID != "cp0" {
+		t.Fatalf("expected latest checkpoint cp0, got %v (err %v)", cp, err)
+	}
+}
+
+func TestNodeKeys_DontCollideWithCheckpoints(t *testing.T) {
+	repo, ldb := newTestRepo(t, repository.KeyPlain)
+
+	if err := repo.PutNode(&models.Node{ID: "checkpoint:x"}); err != nil {
+		t.Fatalf("failed to put node: %v", err)
+	}
+	if ok, _ := ldb.Has([]byte("checkpoint:x")); ok {
+		t.Fatal("node must not be stored under the checkpoint namespace")
+	}
+	if cp, err := repo.GetLatestCheckpoint(); err != nil || cp != nil {
+		t.Fatalf("expected no checkpoint, got %v (err %v)", cp, err)
+	}
+	if node, err := repo.GetNode("checkpoint:x"); err != nil || node.ID != "checkpoint:x" {
+		t.Fatalf("expected the node to be readable by ID, got %v (err %v)", node, err)
+	}
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	for _, scheme := range []repository.KeyScheme{repository.KeyPlain, repository.KeyHashed} {
+		repo, ldb := newTestRepo(t, scheme)
+
+		// a store written before node keys were namespaced
+		for _, id := range []string{"a", "b", "z"} {
+			data, _ := json.Marshal(&models.Node{ID: id, Weight: 1})
+			ldb.Put([]byte(id), data)
+		}
+		repo.PutCheckpoint(&models.Checkpoint{ID: "cp"})
+		repo.PutNodeCounted(&models.Node{ID: "new"}, repository.CounterAdditions)
+
+		moved, err := repo.MigrateLegacyKeys()
+		if err != nil || moved != 3 {
+			t.Fatalf("expected 3 legacy nodes moved, got %d (err %v)", moved, err)
+		}
+		if ok, _ := ldb.Has([]byte("a")); ok {
+			t.Fatal("expected the legacy key to be removed")
+		}
+		if node, err := repo.GetNode("a"); err != nil || node.Weight != 1 {
+			t.Fatalf("expected a under its new key, got %v (err %v)", node, err)
+		}
+		if nodes, _ := repo.GetAllNodes(); len(nodes) != 4 {
+			t.Fatalf("expected 4 nodes after migration, got %d", len(nodes))
+		}
+		if cp, _ := repo.GetLatestCheckpoint(); cp == nil || cp.ID != "cp" {
+			t.Fatalf("expected the checkpoint to survive migration, got %v", cp)
+		}
+		if moved, err := repo.MigrateLegacyKeys(); err != nil || moved != 0 {
+			t.Fatalf("expected a second migration to be a no-op, got %d (err %v)", moved, err)
+		}
+	}
+}
+
+func TestKeySchemes_IgnoreEachOthersKeys(t *testing.T) {
+	_, ldb := newTestRepo(t, repository.KeyPlain)
+	plain := repository.NewNodeRepositoryWithOptions(ldb, repository.Options{KeyScheme: repository.KeyPlain})
+	hashed := repository.NewNodeRepositoryWithOptions(ldb, repository.Options{KeyScheme: repository.KeyHashed})
+
+	plain.PutNode(&models.Node{ID: "p"})
+	hashed.PutNode(&models.Node{ID: "h"})
+	for _, tc := range []struct {
+		repo *repository.NodeRepository
+		want string
+	}{{plain, "p"}, {hashed, "h"}} {
+		nodes, err := tc.repo.GetAllNodes()
+		if err != nil || len(nodes) != 1 || nodes[0].ID != tc.want {
+			t.Fatalf("expected only %s, got %v (err %v)", tc.want, nodes, err)
+		}
+	}
+}
+
+func TestPutNodes_Atomic(t *testing.T) {
+	for _, scheme := range []repository.KeyScheme{repository.KeyPlain, repository.KeyHashed} {
+		repo, _ := newTestRepo(t, scheme)
+
+		nodes := []*models.Node{{ID: "1"}, {ID: "2", Parents: []string{"1"}}, {ID: "3", Parents: []string{"2"}}}
+		if err := repo.PutNodes(nodes); err != nil {
+			t.Fatalf("PutNodes failed: %v", err)
+		}
+		if node, err := repo.GetNode("3"); err != nil || node.Parents[0] != "2" {
+			t.Fatalf("expected node 3 to be stored, got %v (err %v)", node, err)
+		}
+
+		// a node that cannot be marshaled aborts the whole batch
+		broken := []*models.Node{{ID: "4"}, {ID: "5", Data: json.RawMessage("{")}}
+		if err := repo.PutNodes(broken); err == nil {
+			t.Fatal("expected a marshal error")
+		}
+		if ok, _ := repo.HasNode("4"); ok {
+			t.Fatal("expected no node of a failed batch to be stored")
+		}
+	}
+}
+
+func BenchmarkPutNodes_Batch(b *testing.B) {
+	repo, _ := newTestRepo(b, repository.KeyPlain)
+	nodes := make([]*models.Node, 0, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nodes = append(nodes, &models.Node{ID: fmt.Sprintf("tx-%012d", i)})
+		if len(nodes) == cap(nodes) || i == b.N-1 {
+			if err := repo.PutNodes(nodes); err != nil {
+				b.Fatal(err)
+			}
+			nodes = nodes[:0]
+		}
+	}
+}
+
+// benchmarkClusteredWrites writes sequential IDs, the pattern that concentrates
+// plain keys in one range
+func benchmarkClusteredWrites(b *testing.B, scheme repository.KeyScheme) {
+	repo, _ := newTestRepo(b, scheme)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := repo.PutNode(&models.Node{ID: fmt.Sprintf("tx-%012d", i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPutNode_ClusteredIDs_Plain(b *testing.B) {
+	benchmarkClusteredWrites(b, repository.KeyPlain)
+}
+
+func BenchmarkPutNode_ClusteredIDs_Hashed(b *testing.B) {
+	benchmarkClusteredWrites(b, repository.KeyHashed)
+}
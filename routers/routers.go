@@ -1,36 +1,182 @@
 package routers
 
 import (
+	"net/http"
+
 	"dag-project/handlers"
 
 	"github.com/gorilla/mux"
 )
 
+// EndpointFilter reports whether the named endpoint should be served
+type EndpointFilter func(name string) bool
+
 // RegisterRoutes sets up all the HTTP routes for the DAG
 func RegisterRoutes(r *mux.Router, h *handlers.Handler) {
+	RegisterRoutesFiltered(r, h, nil)
+}
+
+// RegisterRoutesFiltered sets up the HTTP routes accepted by enabled and returns the
+// names of the endpoints it disabled. A disabled route's handler is never registered;
+// its path answers 404 explicitly so it isn't mistaken for a method mismatch on a
+// neighbouring pattern like /nodes/{id}. A nil filter enables every endpoint.
+func RegisterRoutesFiltered(r *mux.Router, h *handlers.Handler, enabled EndpointFilter) []string {
+	var disabled []string
+	handle := func(name, path string, fn http.HandlerFunc, method string) {
+		if enabled != nil && !enabled(name) {
+			disabled = append(disabled, name)
+			r.HandleFunc(path, http.NotFound).Methods(method)
+			return
+		}
+		r.HandleFunc(path, fn).Methods(method)
+	}
 
 	// Creates a new node in the DAG with no parents initially
-	r.HandleFunc("/nodes", h.AddNode).Methods("POST")
+	handle("nodes.add", "/nodes", h.AddNode, "POST")
+
+	// Lists one page of nodes, ?limit= and ?offset=
+	handle("nodes.list", "/nodes", h.ListNodes, "GET")
+
+	// Creates a parentless genesis node, rejecting any parents
+	handle("nodes.genesis", "/nodes/genesis", h.CreateGenesis, "POST")
 
 	// Approves a new node that references existing nodes as parents
-	r.HandleFunc("/nodes/approve", h.ApproveNode).Methods("POST")
+	handle("nodes.approve", "/nodes/approve", h.ApproveNode, "POST")
+
+	// Selects tips and approves a new node against them atomically
+	handle("nodes.attach", "/nodes/attach", h.AttachNode, "POST")
+
+	// Approves a new node against exactly two MCMC-selected tips
+	handle("nodes.submit", "/nodes/submit", h.SubmitNode, "POST")
+
+	// Approves many nodes in one request, streaming NDJSON progress
+	handle("nodes.approve_batch", "/nodes/approve/batch", h.ApproveNodesBatch, "POST")
+
+	// Deletes a set of nodes atomically, children before parents
+	handle("nodes.delete_batch", "/nodes/delete/batch", h.DeleteNodesBatch, "POST")
 
 	// Used for identifying the most referenced/important nodes in the graph
-	r.HandleFunc("/nodes/highest-weight", h.GetHighestWeightNode).Methods("GET")
+	handle("nodes.highest_weight", "/nodes/highest-weight", h.GetHighestWeightNode, "GET")
 
 	// Used for identifying the most important nodes including indirect approvals
-	r.HandleFunc("/nodes/highest-cumulative-weight", h.GetHighestCumulativeWeightNode).Methods("GET")
+	handle("nodes.highest_cumulative_weight", "/nodes/highest-cumulative-weight", h.GetHighestCumulativeWeightNode, "GET")
+
+	// Streams every node as NDJSON with constant server memory
+	handle("nodes.stream", "/nodes/stream", h.StreamNodes, "GET")
+
+	// Longest genesis-to-tip path, showing how tall the graph has grown
+	handle("nodes.longest_chain", "/nodes/longest-chain", h.GetLongestChain, "GET")
 
 	// Retrieves a tip using the MCMC algorithm
-	r.HandleFunc("/nodes/tip-selection", h.GetTipMCMC).Methods("GET")
+	handle("nodes.tip_selection", "/nodes/tip-selection", h.GetTipMCMC, "GET")
+
+	// Runs many independent tip-selection walks in one request
+	handle("nodes.tips_bulk", "/nodes/tips/bulk", h.GetTipsBulk, "POST")
+
+	// Lists every current tip, the candidate approval targets
+	handle("nodes.tips", "/nodes/tips", h.GetTips, "GET")
+
+	// Lists every node in topological order, parents before children
+	handle("nodes.topological", "/nodes/topological", h.GetTopological, "GET")
+
+	// Shortest approval path between two nodes, ?from= and ?to=
+	handle("nodes.path", "/nodes/path", h.GetPath, "GET")
 
 	// Creates a new checkpoint by storing the current state of the DAG.
-	r.HandleFunc("/checkpoints", h.CreateCheckpoint).Methods("POST")
+	handle("checkpoints.create", "/checkpoints", h.CreateCheckpoint, "POST")
 
 	// Retrieves the most recent checkpoint to restore the DAG state.
-	r.HandleFunc("/checkpoints/latest", h.GetLatestCheckpoint).Methods("GET")
+	handle("checkpoints.latest", "/checkpoints/latest", h.GetLatestCheckpoint, "GET")
+
+	// Compares two checkpoints: node-count delta and added, removed and changed nodes.
+	handle("checkpoints.diff", "/checkpoints/diff", h.GetCheckpointDiff, "GET")
+
+	// Checks whether a checkpoint's root still matches the current nodes.
+	handle("checkpoints.verify", "/checkpoints/{id}/verify", h.VerifyCheckpoint, "GET")
 
 	// Retrieves the current synchronization state.
-	r.HandleFunc("/sync/state", h.GetSyncState).Methods("GET")
+	handle("sync.state", "/sync/state", h.GetSyncState, "GET")
+
+	// Dumps every node so another instance can merge them.
+	handle("sync.export", "/sync/export", h.ExportNodes, "GET")
+
+	// Merges another instance's export into this DAG.
+	handle("sync.merge", "/sync/merge", h.MergeExport, "POST")
+
+	// Reads a single node with an ETag for conditional polling
+	handle("nodes.get", "/nodes/{id}", h.GetNode, "GET")
+
+	// Cheap existence check for a single node, no body is returned
+	handle("nodes.exists", "/nodes/{id}", h.NodeExists, "HEAD")
+
+	// Longest descendant path below a node, with its confirmation status
+	handle("nodes.depth_below", "/nodes/{id}/depth-below", h.GetDepthBelow, "GET")
+
+	// Yes/no check whether the from node is an ancestor of this one
+	handle("nodes.reachable", "/nodes/{id}/reachable", h.IsReachable, "GET")
+
+	// Every ancestor with its minimum hop distance, for layered provenance views
+	handle("nodes.lineage", "/nodes/{id}/lineage", h.GetLineage, "GET")
+
+	// Other children of a node's parents, for spotting competing approvals
+	handle("nodes.siblings", "/nodes/{id}/siblings", h.GetSiblings, "GET")
+
+	// Every node reachable upward from a node, for audits
+	handle("nodes.ancestors", "/nodes/{id}/ancestors", h.GetAncestors, "GET")
+
+	// Every node reachable downward from a node, for audits
+	handle("nodes.descendants", "/nodes/{id}/descendants", h.GetDescendants, "GET")
+
+	// Merkle inclusion proof of a node, for light clients
+	handle("nodes.proof", "/nodes/{id}/proof", h.GetNodeProof, "GET")
+
+	// Replaces a node's parents, adjusting old and new parents' weights
+	handle("nodes.reparent", "/nodes/{id}/reparent", h.ReparentNode, "POST")
+
+	// Soft-deletes a node, keeping it stored for its children
+	handle("nodes.archive", "/nodes/{id}/archive", h.ArchiveNode, "POST")
+
+	// Removes a node nobody approves, e.g. one added by mistake
+	handle("nodes.delete", "/nodes/{id}", h.DeleteNode, "DELETE")
+
+	// Sets or removes operational notes on a node without touching its content
+	handle("nodes.annotate", "/nodes/{id}/annotations", h.AnnotateNode, "PATCH")
+
+	// Retrieves runtime statistics such as tip-selection latency.
+	handle("stats.runtime", "/stats", h.GetStats, "GET")
+
+	// Durable counters of nodes ever added and approved, surviving restarts.
+	handle("stats.lifetime", "/stats/lifetime", h.GetLifetimeStats, "GET")
+
+	// Components, diameter and out-degree distribution of the graph.
+	handle("stats.shape", "/stats/shape", h.GetShapeReport, "GET")
+
+	// Share of confirmed nodes and ages of unconfirmed tips, for Tangle research.
+	handle("stats.confirmation", "/stats/confirmation", h.GetConfirmationReport, "GET")
+
+	// Plaintext summary for quick curl checks during operations.
+	handle("status", "/status", h.GetStatus, "GET")
+
+	// Liveness probe for load balancers; answers as long as the process serves HTTP.
+	handle("health", "/health", h.Health, "GET")
+
+	// Readiness probe; answers 503 while LevelDB can't be read.
+	handle("ready", "/ready", h.Ready, "GET")
+
+	// Approvals parked until their missing parents arrive.
+	handle("pending", "/pending", h.GetPending, "GET")
+
+	// Toggles read-only mode, rejecting mutations during maintenance.
+	handle("admin.read_only", "/admin/read-only", h.SetReadOnlyMode, "POST")
+
+	// Zeroes ephemeral runtime stats such as the tip-selection latency average.
+	handle("admin.stats_reset", "/admin/stats/reset", h.ResetStats, "POST")
+
+	// Blocks until queued weight propagations are applied, e.g. before a backup.
+	handle("admin.flush", "/admin/flush", h.Flush, "POST")
+
+	// Lists raw LevelDB keys and value sizes; only served when debugging is enabled.
+	handle("debug.keys", "/debug/keys", h.DebugKeys, "GET")
 
+	return disabled
 }
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"dag-project/logger"
+	"dag-project/models"
+
+	"go.uber.org/zap"
+)
+
+// Headers set on every delivery
+const (
+	EventHeader     = "X-DAG-Event"
+	SignatureHeader = "X-DAG-Signature" // "sha256=" + hex HMAC-SHA256 of the body
+)
+
+// Defaults applied to zero Config fields
+const (
+	defaultQueueSize  = 1024
+	defaultMaxRetries = 3
+	defaultTimeout    = 5 * time.Second
+	defaultBackoff    = 500 * time.Millisecond
+)
+
+// Config describes where and how events are delivered
+type Config struct {
+	// URLs receive every subscribed event as a JSON POST
+	URLs []string
+	// Events lists the subscribed event types; empty subscribes to approvals only
+	Events []string
+	// Secret signs payloads with HMAC-SHA256 when set
+	Secret string
+	// QueueSize bounds undelivered events; events beyond it are dropped and logged
+	QueueSize int
+	// MaxRetries is how often a failed delivery is retried per URL
+	MaxRetries int
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration
+	// Backoff is the delay before the first retry, doubled on each further retry
+	Backoff time.Duration
+}
+
+// Dispatcher delivers events to webhooks from a background worker so publishing
+// never blocks the write path. It implements dag.EventSink.
+type Dispatcher struct {
+	cfg    Config
+	events map[string]bool
+	client *http.Client
+	queue  chan models.Event
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewDispatcher starts a dispatcher for cfg
+func NewDispatcher(cfg Config) *Dispatcher {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if len(cfg.Events) == 0 {
+		cfg.Events = []string{models.EventNodeApproved}
+	}
+
+	d := &Dispatcher{
+		cfg:    cfg,
+		events: make(map[string]bool, len(cfg.Events)),
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan models.Event, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	for _, event := range cfg.Events {
+		d.events[event] = true
+	}
+	go d.run()
+	return d
+}
+
+// Publish queues a subscribed event without blocking; it is dropped with a warning
+// when the queue is full or the dispatcher is closed
+func (d *Dispatcher) Publish(event models.Event) {
+	if !d.events[event.Type] {
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.queue <- event:
+	default:
+		logger.Logger.Warn("Webhook queue full, dropping event", zap.String("event", event.Type))
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are delivered
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+	<-d.done
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for event := range d.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			logger.Logger.Error("Failed to encode webhook event", zap.String("event", event.Type), zap.Error(err))
+			continue
+		}
+		for _, url := range d.cfg.URLs {
+			d.deliver(url, event.Type, body)
+		}
+	}
+}
+
+// deliver posts body to url, retrying with exponential backoff
+func (d *Dispatcher) deliver(url, eventType string, body []byte) {
+	backoff := d.cfg.Backoff
+	var err error
+	for attempt := 0; attempt <= d.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = d.post(url, eventType, body); err == nil {
+			return
+		}
+	}
+	logger.Logger.Warn("Webhook delivery failed",
+		zap.String("url", url), zap.String("event", eventType),
+		zap.Int("attempts", d.cfg.MaxRetries+1), zap.Error(err))
+}
+
+func (d *Dispatcher) post(url, eventType string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	if d.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by the hex
+// HMAC-SHA256 of body keyed with secret. Receivers recompute it to verify payloads.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
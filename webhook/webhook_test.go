@@ -0,0 +1,60 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"dag-project/logger"
+	"dag-project/models"
+	"dag-project/webhook"
+)
+
+func TestDispatcher_SignsAndRetries(t *testing.T) {
+	logger.Logger = zap.NewNop()
+
+	var attempts atomic.Int32
+	received := make(chan models.Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt fails so the delivery has to be retried
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(webhook.SignatureHeader); got != webhook.Sign("secret", body) {
+			t.Errorf("unexpected signature %q", got)
+		}
+		var event models.Event
+		json.Unmarshal(body, &event)
+		received <- event
+	}))
+	defer server.Close()
+
+	d := webhook.NewDispatcher(webhook.Config{
+		URLs:    []string{server.URL},
+		Secret:  "secret",
+		Backoff: time.Millisecond,
+	})
+	d.Publish(models.Event{Type: models.EventNodeAdded, Node: &models.Node{ID: "ignored"}})
+	d.Publish(models.Event{Type: models.EventNodeApproved, Node: &models.Node{ID: "B"}})
+	d.Close()
+
+	select {
+	case event := <-received:
+		if event.Type != models.EventNodeApproved || event.Node.ID != "B" {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	default:
+		t.Fatal("expected the approval to be delivered before Close returned")
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Fatalf("expected 2 attempts (one retry), got %d; unsubscribed events must not be sent", n)
+	}
+}